@@ -0,0 +1,411 @@
+package bucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/daidokoro/qaz/clients"
+	"github.com/daidokoro/qaz/log"
+)
+
+// default lifecycle settings of bootstrapped buckets
+const (
+	defaultNoncurrentDays = 30
+	defaultAbortDays      = 7
+	lifecycleRuleID       = "qaz-artifacts"
+)
+
+// error codes of bucket settings that are not set
+const (
+	errNoEncryption = "ServerSideEncryptionConfigurationNotFoundError"
+	errNoLifecycle  = "NoSuchLifecycleConfiguration"
+	errNoPolicy     = "NoSuchBucketPolicy"
+)
+
+// Options - settings applied to bootstrapped buckets
+type Options struct {
+	// Region - bucket region, defaults to the session region
+	Region string
+
+	// Encryption - default bucket encryption, SSE-S3 if not set
+	Encryption *Encryption
+
+	// NoncurrentDays - days after which noncurrent object versions expire
+	NoncurrentDays int64
+
+	// Prefix - key prefix of qaz objects, the lifecycle rule only applies
+	// to keys under it. Existing buckets only get the rule if it is set.
+	Prefix string
+
+	// RestrictToAccount - adds a bucket policy denying access from other
+	// accounts than the deploying account and requests without TLS
+	RestrictToAccount bool
+
+	// Force - replaces the settings of existing buckets, including their
+	// lifecycle rules & policy, and enables versioning, which can't be undone
+	Force bool
+}
+
+// DefaultOptions - returns the default bootstrap options for the given region
+func DefaultOptions(region string) Options {
+	return Options{
+		Region:         region,
+		Encryption:     &Encryption{SSE: s3.ServerSideEncryptionAes256},
+		NoncurrentDays: defaultNoncurrentDays,
+	}
+}
+
+// Bootstrap - creates the bucket in the given region if it does not exist and
+// applies default encryption, versioning, a public access block, a lifecycle
+// rule expiring noncurrent versions and, optionally, the account policy.
+// Existing buckets may be shared, their settings are only replaced when
+// opts.Force is set. Otherwise the encryption is set if the bucket has none,
+// the lifecycle rule & policy statements are merged into the existing
+// configuration and versioning & the public access block are left as is.
+func Bootstrap(bucket string, opts Options, sess *session.Session, p clients.Provider) error {
+	if opts.Region == "" {
+		opts.Region = aws.StringValue(sess.Config.Region)
+	}
+
+	svc := clients.Default(p).S3(sess, aws.NewConfig().WithRegion(opts.Region))
+
+	exists, _ := Exists(bucket, sess, p)
+	if !exists {
+		params := &s3.CreateBucketInput{
+			Bucket: aws.String(bucket),
+		}
+
+		// us-east-1 is the default location & may not be set as a constraint
+		if opts.Region != "" && opts.Region != "us-east-1" {
+			params.CreateBucketConfiguration = &s3.CreateBucketConfiguration{
+				LocationConstraint: aws.String(opts.Region),
+			}
+		}
+
+		log.Debug("calling S3 [CreateBucket] with parameters: %s", params)
+		if _, err := svc.CreateBucket(params); err != nil {
+			return err
+		}
+
+		if err := svc.WaitUntilBucketExists(&s3.HeadBucketInput{Bucket: aws.String(bucket)}); err != nil {
+			return err
+		}
+		log.Info("bucket created: [%s] - %s", bucket, opts.Region)
+	}
+
+	b := &bootstrapper{svc: svc, bucket: bucket, replace: !exists || opts.Force}
+	if exists && opts.Force {
+		log.Warn("replacing the settings of existing bucket [%s]", bucket)
+	}
+
+	for _, fn := range []func() error{
+		func() error { return b.encryption(opts.Encryption) },
+		b.versioning,
+		b.publicAccessBlock,
+		func() error { return b.lifecycle(opts.NoncurrentDays, opts.Prefix) },
+	} {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+
+	if !opts.RestrictToAccount {
+		return nil
+	}
+
+	identity, err := clients.Default(p).STS(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return err
+	}
+	return b.policy(aws.StringValue(identity.Account))
+}
+
+// bootstrapper - applies bootstrap settings to a bucket, existing settings
+// are kept or merged unless replace is set
+type bootstrapper struct {
+	svc     s3iface.S3API
+	bucket  string
+	replace bool
+}
+
+// encryption - sets the default encryption, buckets with default
+// encryption keep it unless replaced
+func (b *bootstrapper) encryption(enc *Encryption) error {
+	if !b.replace {
+		_, err := b.svc.GetBucketEncryption(&s3.GetBucketEncryptionInput{Bucket: aws.String(b.bucket)})
+		switch {
+		case err == nil:
+			log.Debug("keeping default encryption of existing bucket [%s]", b.bucket)
+			return nil
+		case errorCode(err) != errNoEncryption:
+			return fmt.Errorf("failed to read encryption of [%s]: %v", b.bucket, err)
+		}
+		log.Info("setting default encryption of existing bucket [%s]", b.bucket)
+	}
+
+	if enc == nil || enc.SSE == "" {
+		enc = &Encryption{SSE: s3.ServerSideEncryptionAes256}
+	}
+
+	sse := &s3.ServerSideEncryptionByDefault{SSEAlgorithm: aws.String(enc.SSE)}
+	if enc.KMSKeyID != "" {
+		sse.KMSMasterKeyID = aws.String(enc.KMSKeyID)
+	}
+
+	params := &s3.PutBucketEncryptionInput{
+		Bucket: aws.String(b.bucket),
+		ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+			Rules: []*s3.ServerSideEncryptionRule{{ApplyServerSideEncryptionByDefault: sse}},
+		},
+	}
+
+	log.Debug("calling S3 [PutBucketEncryption] with parameters: %s", params)
+	if _, err := b.svc.PutBucketEncryption(params); err != nil {
+		return fmt.Errorf("failed to set encryption on [%s]: %v", b.bucket, err)
+	}
+	return nil
+}
+
+// versioning - enables versioning, versioning can't be disabled once
+// enabled so it's only enabled on existing buckets if replaced
+func (b *bootstrapper) versioning() error {
+	if !b.replace {
+		resp, err := b.svc.GetBucketVersioning(&s3.GetBucketVersioningInput{Bucket: aws.String(b.bucket)})
+		if err != nil {
+			return fmt.Errorf("failed to read versioning of [%s]: %v", b.bucket, err)
+		}
+
+		if aws.StringValue(resp.Status) != s3.BucketVersioningStatusEnabled {
+			log.Warn("versioning is not enabled on existing bucket [%s], use --force to enable it", b.bucket)
+		}
+		return nil
+	}
+
+	params := &s3.PutBucketVersioningInput{
+		Bucket: aws.String(b.bucket),
+		VersioningConfiguration: &s3.VersioningConfiguration{
+			Status: aws.String(s3.BucketVersioningStatusEnabled),
+		},
+	}
+
+	log.Debug("calling S3 [PutBucketVersioning] with parameters: %s", params)
+	if _, err := b.svc.PutBucketVersioning(params); err != nil {
+		return fmt.Errorf("failed to enable versioning on [%s]: %v", b.bucket, err)
+	}
+	return nil
+}
+
+// publicAccessBlock - blocks public access, the public access block of
+// existing buckets is left as is unless replaced
+func (b *bootstrapper) publicAccessBlock() error {
+	if !b.replace {
+		log.Debug("keeping public access block of existing bucket [%s]", b.bucket)
+		return nil
+	}
+
+	params := &s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(b.bucket),
+		PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	}
+
+	log.Debug("calling S3 [PutPublicAccessBlock] with parameters: %s", params)
+	if _, err := b.svc.PutPublicAccessBlock(params); err != nil {
+		return fmt.Errorf("failed to block public access on [%s]: %v", b.bucket, err)
+	}
+	return nil
+}
+
+// lifecycle - sets the qaz-artifacts lifecycle rule for keys under prefix,
+// other rules of existing buckets are kept unless replaced. Existing buckets
+// may hold other objects, so without a prefix the rule is not added to them.
+func (b *bootstrapper) lifecycle(days int64, prefix string) error {
+	if days <= 0 {
+		days = defaultNoncurrentDays
+	}
+
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		prefix += "/"
+	}
+
+	if !b.replace && prefix == "" {
+		log.Warn("not adding lifecycle rule [%s] to existing bucket [%s], set an artifacts prefix or use --force to apply it to the whole bucket", lifecycleRuleID, b.bucket)
+		return nil
+	}
+
+	rules := []*s3.LifecycleRule{{
+		ID:     aws.String(lifecycleRuleID),
+		Status: aws.String(s3.ExpirationStatusEnabled),
+		Filter: &s3.LifecycleRuleFilter{Prefix: aws.String(prefix)},
+		NoncurrentVersionExpiration: &s3.NoncurrentVersionExpiration{
+			NoncurrentDays: aws.Int64(days),
+		},
+		AbortIncompleteMultipartUpload: &s3.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: aws.Int64(defaultAbortDays),
+		},
+	}}
+
+	if !b.replace {
+		resp, err := b.svc.GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(b.bucket)})
+		if err != nil && errorCode(err) != errNoLifecycle {
+			return fmt.Errorf("failed to read lifecycle rules of [%s]: %v", b.bucket, err)
+		}
+
+		if resp != nil {
+			for _, r := range resp.Rules {
+				if aws.StringValue(r.ID) == lifecycleRuleID {
+					continue
+				}
+
+				// rules with the legacy top-level prefix can't be mixed with
+				// filtered rules, the equivalent prefix filter is used instead
+				if r.Filter == nil && r.Prefix != nil {
+					r.Filter = &s3.LifecycleRuleFilter{Prefix: r.Prefix}
+					r.Prefix = nil
+				}
+				rules = append(rules, r)
+			}
+		}
+		log.Info("merging lifecycle rule [%s] into the %d existing rule(s) of [%s]", lifecycleRuleID, len(rules)-1, b.bucket)
+	}
+
+	params := &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(b.bucket),
+		LifecycleConfiguration: &s3.BucketLifecycleConfiguration{Rules: rules},
+	}
+
+	log.Debug("calling S3 [PutBucketLifecycleConfiguration] with parameters: %s", params)
+	if _, err := b.svc.PutBucketLifecycleConfiguration(params); err != nil {
+		return fmt.Errorf("failed to set lifecycle rule on [%s]: %v", b.bucket, err)
+	}
+	return nil
+}
+
+// policy - sets the account policy, the statements are merged into the
+// policy of existing buckets unless replaced
+func (b *bootstrapper) policy(account string) error {
+	var existing string
+	if !b.replace {
+		resp, err := b.svc.GetBucketPolicy(&s3.GetBucketPolicyInput{Bucket: aws.String(b.bucket)})
+		if err != nil && errorCode(err) != errNoPolicy {
+			return fmt.Errorf("failed to read bucket policy of [%s]: %v", b.bucket, err)
+		}
+
+		if resp != nil {
+			existing = aws.StringValue(resp.Policy)
+		}
+		log.Info("merging account policy statements into the bucket policy of [%s]", b.bucket)
+	}
+
+	policy, err := MergePolicy(existing, b.bucket, account)
+	if err != nil {
+		return fmt.Errorf("failed to merge bucket policy of [%s]: %v", b.bucket, err)
+	}
+
+	params := &s3.PutBucketPolicyInput{
+		Bucket: aws.String(b.bucket),
+		Policy: aws.String(policy),
+	}
+
+	log.Debug("calling S3 [PutBucketPolicy] with parameters: %s", params)
+	if _, err := b.svc.PutBucketPolicy(params); err != nil {
+		return fmt.Errorf("failed to set bucket policy on [%s]: %v", b.bucket, err)
+	}
+	return nil
+}
+
+// errorCode - returns the aws error code of err, empty if not an aws error
+func errorCode(err error) string {
+	if e, ok := err.(awserr.Error); ok {
+		return e.Code()
+	}
+	return ""
+}
+
+// Policy - returns a bucket policy denying requests without TLS and
+// requests from principals outside the given account
+func Policy(bucket, account string) (string, error) {
+	return MergePolicy("", bucket, account)
+}
+
+// MergePolicy - adds the statements of Policy to an existing bucket policy,
+// statements with the same Sid are replaced and others are kept
+func MergePolicy(existing, bucket, account string) (string, error) {
+	doc := map[string]interface{}{"Version": "2012-10-17"}
+	var statements []interface{}
+
+	if existing != "" {
+		if err := json.Unmarshal([]byte(existing), &doc); err != nil {
+			return "", err
+		}
+
+		// a single statement may be given as an object
+		switch s := doc["Statement"].(type) {
+		case []interface{}:
+			statements = s
+		case map[string]interface{}:
+			statements = []interface{}{s}
+		}
+	}
+
+	ours := policyStatements(bucket, account)
+	var merged []interface{}
+	for _, s := range statements {
+		if m, ok := s.(map[string]interface{}); ok {
+			if _, replaced := ours[fmt.Sprint(m["Sid"])]; replaced {
+				continue
+			}
+		}
+		merged = append(merged, s)
+	}
+
+	for _, sid := range policySids {
+		merged = append(merged, ours[sid])
+	}
+	doc["Statement"] = merged
+
+	b, err := json.MarshalIndent(doc, "", "  ")
+	return string(b), err
+}
+
+// policySids - ids of the statements added by Policy, in order
+var policySids = []string{"DenyInsecureTransport", "DenyOtherAccounts"}
+
+// policyStatements - returns the statements of Policy by Sid
+func policyStatements(bucket, account string) map[string]interface{} {
+	resources := []string{
+		fmt.Sprintf("arn:aws:s3:::%s", bucket),
+		fmt.Sprintf("arn:aws:s3:::%s/*", bucket),
+	}
+
+	statement := func(sid string, condition map[string]map[string]string) map[string]interface{} {
+		return map[string]interface{}{
+			"Sid":       sid,
+			"Effect":    "Deny",
+			"Principal": "*",
+			"Action":    "s3:*",
+			"Resource":  resources,
+			"Condition": condition,
+		}
+	}
+
+	return map[string]interface{}{
+		"DenyInsecureTransport": statement("DenyInsecureTransport", map[string]map[string]string{
+			"Bool": {"aws:SecureTransport": "false"},
+		}),
+		"DenyOtherAccounts": statement("DenyOtherAccounts", map[string]map[string]string{
+			"StringNotEquals": {"aws:PrincipalAccount": account},
+		}),
+	}
+}
@@ -2,21 +2,25 @@ package bucket
 
 import (
 	"bytes"
+	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/daidokoro/qaz/clients"
 	"github.com/daidokoro/qaz/log"
 )
 
 // -- Contains all things S3
 
 // S3Read - Reads the content of a given s3 url endpoint and returns the content string.
-func S3Read(URL string, sess *session.Session) (string, error) {
-	svc := s3.New(sess)
+func S3Read(URL string, sess *session.Session, p clients.Provider) (string, error) {
+	svc := clients.Default(p).S3(sess)
 
 	src, err := url.Parse(URL)
 	if err != nil {
@@ -46,8 +50,8 @@ func S3Read(URL string, sess *session.Session) (string, error) {
 }
 
 // S3write - Writes a file to s3 and returns the presigned url
-func S3write(bucket string, key string, body string, sess *session.Session) (string, error) {
-	svc := s3.New(sess)
+func S3write(bucket string, key string, body string, sess *session.Session, p clients.Provider) (string, error) {
+	svc := clients.Default(p).S3(sess)
 	params := &s3.PutObjectInput{
 		Bucket: &bucket,
 		Key:    &key,
@@ -77,38 +81,183 @@ func S3write(bucket string, key string, body string, sess *session.Session) (str
 }
 
 // Create - create s3 bucket
-func Create(bucket string, sess *session.Session) error {
-	svc := s3.New(sess)
+func Create(bucket string, sess *session.Session, p clients.Provider) error {
+	return Bootstrap(bucket, DefaultOptions(aws.StringValue(sess.Config.Region)), sess, p)
+}
 
-	params := &s3.CreateBucketInput{
+// Exists - checks if bucket exists - if err, then its assumed that the bucket does not exist.
+func Exists(bucket string, sess *session.Session, p clients.Provider) (bool, error) {
+	svc := clients.Default(p).S3(sess)
+	params := &s3.HeadBucketInput{
 		Bucket: &bucket,
 	}
 
-	log.Debug("calling S3 [CreateBucket] with parameters: %s", params)
-	_, err := svc.CreateBucket(params)
+	log.Debug("calling S3 [HeadBucket] with parameters: %s", params)
+	_, err := svc.HeadBucket(params)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	if err := svc.WaitUntilBucketExists(&s3.HeadBucketInput{Bucket: aws.String(bucket)}); err != nil {
-		return err
-	}
+	return true, nil
+}
 
-	return nil
+// Encryption - server-side encryption of uploaded objects, SSE is either
+// AES256 (SSE-S3) or aws:kms (SSE-KMS), the default KMS key is used if
+// KMSKeyID is not set
+type Encryption struct {
+	SSE      string
+	KMSKeyID string
 }
 
-// Exists - checks if bucket exists - if err, then its assumed that the bucket does not exist.
-func Exists(bucket string, sess *session.Session) (bool, error) {
-	svc := s3.New(sess)
-	params := &s3.HeadBucketInput{
-		Bucket: &bucket,
+// Object - summary of a bucket object
+type Object struct {
+	Key          string
+	LastModified time.Time
+	Size         int64
+}
+
+// Put - writes body to the given bucket key
+func Put(bucket, key string, body []byte, enc *Encryption, sess *session.Session, p clients.Provider) error {
+	svc := clients.Default(p).S3(sess)
+	params := &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(body),
+		Metadata: map[string]*string{
+			"created_by": aws.String("qaz"),
+		},
 	}
 
-	log.Debug("calling S3 [HeadBucket] with parameters: %s", params)
-	_, err := svc.HeadBucket(params)
+	if enc != nil && enc.SSE != "" {
+		params.ServerSideEncryption = aws.String(enc.SSE)
+		if enc.KMSKeyID != "" {
+			params.SSEKMSKeyId = aws.String(enc.KMSKeyID)
+		}
+	}
+
+	log.Debug("calling S3 [PutObject] with parameters: %s", params)
+	_, err := svc.PutObject(params)
+	return err
+}
+
+// Upload - writes body to the given bucket key if the key does not
+// exist, returns true if the object was uploaded. Keys are expected to
+// be content-addressed, i.e. an existing key has the same content.
+func Upload(bucket, key string, body []byte, enc *Encryption, sess *session.Session, p clients.Provider) (bool, error) {
+	exists, err := ObjectExists(bucket, key, sess, p)
 	if err != nil {
 		return false, err
 	}
 
+	if exists {
+		log.Debug("object [s3://%s/%s] already exists, skipping upload", bucket, key)
+		return false, nil
+	}
+
+	if err := Put(bucket, key, body, enc, sess, p); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// List - returns the objects under the given prefix
+func List(bucket, prefix string, sess *session.Session, p clients.Provider) ([]Object, error) {
+	svc := clients.Default(p).S3(sess)
+	params := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}
+
+	var objects []Object
+	log.Debug("calling S3 [ListObjectsV2] with parameters: %s", params)
+	err := svc.ListObjectsV2Pages(params, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, o := range page.Contents {
+			objects = append(objects, Object{
+				Key:          aws.StringValue(o.Key),
+				LastModified: aws.TimeValue(o.LastModified),
+				Size:         aws.Int64Value(o.Size),
+			})
+		}
+		return true
+	})
+	return objects, err
+}
+
+// Delete - deletes the given keys from the bucket
+func Delete(bucket string, keys []string, sess *session.Session, p clients.Provider) error {
+	svc := clients.Default(p).S3(sess)
+
+	// DeleteObjects accepts up to 1000 keys per request
+	for i := 0; i < len(keys); i += 1000 {
+		end := i + 1000
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		var objects []*s3.ObjectIdentifier
+		for _, k := range keys[i:end] {
+			objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(k)})
+		}
+
+		params := &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		}
+
+		log.Debug("calling S3 [DeleteObjects] with parameters: %s", params)
+		resp, err := svc.DeleteObjects(params)
+		if err != nil {
+			return err
+		}
+
+		if len(resp.Errors) > 0 {
+			e := resp.Errors[0]
+			return fmt.Errorf("failed to delete %d object(s), [%s]: %s", len(resp.Errors), aws.StringValue(e.Key), aws.StringValue(e.Message))
+		}
+	}
+	return nil
+}
+
+// ObjectExists - checks if the given key exists in the bucket
+func ObjectExists(bucket, key string, sess *session.Session, p clients.Provider) (bool, error) {
+	svc := clients.Default(p).S3(sess)
+	params := &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+
+	log.Debug("calling S3 [HeadObject] with parameters: %s", params)
+	if _, err := svc.HeadObject(params); err != nil {
+		if e, ok := err.(awserr.RequestFailure); ok && e.StatusCode() == http.StatusNotFound {
+			return false, nil
+		}
+		return false, err
+	}
 	return true, nil
 }
+
+// URL - returns the https url of an object in the given region
+func URL(bucket, key, region string) string {
+	if region == "" || region == "us-east-1" {
+		return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", bucket, key)
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, key)
+}
+
+// ObjectURL - returns the url of an object as resolved by the session, custom
+// S3 endpoints & path-style addressing of the session are respected
+func ObjectURL(bucket, key string, sess *session.Session) string {
+	req, _ := s3.New(sess).GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+
+	if err := req.Build(); err != nil {
+		log.Debug("failed to resolve url of [s3://%s/%s]: %v", bucket, key, err)
+		return URL(bucket, key, aws.StringValue(sess.Config.Region))
+	}
+
+	u := *req.HTTPRequest.URL
+	u.RawQuery = ""
+	return u.String()
+}
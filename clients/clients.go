@@ -0,0 +1,76 @@
+// Package clients creates the AWS service clients used by qaz. Clients are
+// created by a Provider carried by each project & stack, so that they can be
+// given other backends, e.g. the in-memory backends of the fake package in
+// tests and mock runs, without affecting other projects in the process.
+package clients
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// Provider - creates the AWS service clients of a session
+type Provider interface {
+	// CloudFormation - returns a CloudFormation client
+	CloudFormation(p client.ConfigProvider, cfgs ...*aws.Config) cloudformationiface.CloudFormationAPI
+
+	// S3 - returns an S3 client
+	S3(p client.ConfigProvider, cfgs ...*aws.Config) s3iface.S3API
+
+	// Lambda - returns a Lambda client
+	Lambda(p client.ConfigProvider, cfgs ...*aws.Config) lambdaiface.LambdaAPI
+
+	// KMS - returns a KMS client
+	KMS(p client.ConfigProvider, cfgs ...*aws.Config) kmsiface.KMSAPI
+
+	// STS - returns an STS client
+	STS(p client.ConfigProvider, cfgs ...*aws.Config) stsiface.STSAPI
+}
+
+// SDK - provider of AWS SDK clients
+var SDK Provider = sdk{}
+
+// Default - returns p, or the SDK provider if p is nil
+func Default(p Provider) Provider {
+	if p == nil {
+		return SDK
+	}
+	return p
+}
+
+type sdk struct{}
+
+// CloudFormation - returns a CloudFormation client
+func (sdk) CloudFormation(p client.ConfigProvider, cfgs ...*aws.Config) cloudformationiface.CloudFormationAPI {
+	return cloudformation.New(p, cfgs...)
+}
+
+// S3 - returns an S3 client
+func (sdk) S3(p client.ConfigProvider, cfgs ...*aws.Config) s3iface.S3API {
+	return s3.New(p, cfgs...)
+}
+
+// Lambda - returns a Lambda client
+func (sdk) Lambda(p client.ConfigProvider, cfgs ...*aws.Config) lambdaiface.LambdaAPI {
+	return lambda.New(p, cfgs...)
+}
+
+// KMS - returns a KMS client
+func (sdk) KMS(p client.ConfigProvider, cfgs ...*aws.Config) kmsiface.KMSAPI {
+	return kms.New(p, cfgs...)
+}
+
+// STS - returns an STS client
+func (sdk) STS(p client.ConfigProvider, cfgs ...*aws.Config) stsiface.STSAPI {
+	return sts.New(p, cfgs...)
+}
@@ -0,0 +1,570 @@
+package fake
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// number of events per DescribeStackEvents page
+const eventPageSize = 100
+
+// CreateStackWithContext - creates a stack, stacks that fail to create are
+// rolled back unless OnFailure or DisableRollback say otherwise
+func (c *CloudFormation) CreateStackWithContext(ctx aws.Context, in *cloudformation.CreateStackInput, opts ...request.Option) (*cloudformation.CreateStackOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name := aws.StringValue(in.StackName)
+	if _, err := c.lookup(name); err == nil {
+		return nil, requestError(http.StatusBadRequest, cloudformation.ErrCodeAlreadyExistsException, "Stack [%s] already exists", name)
+	}
+
+	body, err := c.templateBody(in.TemplateBody, in.TemplateURL)
+	if err != nil {
+		return nil, err
+	}
+
+	st := c.newStack(name)
+	next, changes, err := c.prepare(st, body, in.Parameters, in.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkCapabilities(next.parsed, in.Capabilities); err != nil {
+		return nil, err
+	}
+
+	st.capabilities = in.Capabilities
+	st.notifications = in.NotificationARNs
+	st.disableRollback = aws.BoolValue(in.DisableRollback)
+	st.protection = aws.BoolValue(in.EnableTerminationProtection)
+	st.policy = aws.StringValue(in.StackPolicyBody)
+	c.register(st)
+
+	onFailure := aws.StringValue(in.OnFailure)
+	if onFailure == "" {
+		onFailure = cloudformation.OnFailureRollback
+		if st.disableRollback {
+			onFailure = cloudformation.OnFailureDoNothing
+		}
+	}
+
+	c.create(st, next, changes, onFailure)
+	return &cloudformation.CreateStackOutput{StackId: aws.String(st.id)}, nil
+}
+
+// UpdateStackWithContext - updates a stack, tags are kept if not given
+func (c *CloudFormation) UpdateStackWithContext(ctx aws.Context, in *cloudformation.UpdateStackInput, opts ...request.Option) (*cloudformation.UpdateStackOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st, err := c.lookup(aws.StringValue(in.StackName))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := st.updatable(); err != nil {
+		return nil, err
+	}
+
+	body := st.template
+	if !aws.BoolValue(in.UsePreviousTemplate) {
+		if body, err = c.templateBody(in.TemplateBody, in.TemplateURL); err != nil {
+			return nil, err
+		}
+	}
+
+	tags := in.Tags
+	if tags == nil {
+		tags = st.tags
+	}
+
+	next, changes, err := c.prepare(st, body, in.Parameters, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.unchanged(st, next) {
+		return nil, validationError("No updates are to be performed.")
+	}
+
+	if err := checkCapabilities(next.parsed, in.Capabilities); err != nil {
+		return nil, err
+	}
+
+	st.capabilities = in.Capabilities
+	if in.NotificationARNs != nil {
+		st.notifications = in.NotificationARNs
+	}
+
+	c.update(st, next, changes)
+	return &cloudformation.UpdateStackOutput{StackId: aws.String(st.id)}, nil
+}
+
+// unchanged - returns true if the template, parameters & tags of next are those of the stack
+func (c *CloudFormation) unchanged(st *stack, next *state) bool {
+	return next.template == st.template &&
+		len(changedParameters(st.parameters, next.parameters)) == 0 &&
+		reflect.DeepEqual(next.tags, st.tags)
+}
+
+// DeleteStackWithContext - deletes a stack, deleting a stack that does not exist succeeds
+func (c *CloudFormation) DeleteStackWithContext(ctx aws.Context, in *cloudformation.DeleteStackInput, opts ...request.Option) (*cloudformation.DeleteStackOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st, err := c.lookup(aws.StringValue(in.StackName))
+	if err != nil {
+		return &cloudformation.DeleteStackOutput{}, nil
+	}
+
+	if st.protection {
+		return nil, validationError("Stack [%s] cannot be deleted while TerminationProtection is enabled", st.name)
+	}
+
+	status, _ := st.status()
+	switch {
+	case status == cloudformation.StackStatusDeleteInProgress:
+		return &cloudformation.DeleteStackOutput{}, nil
+	case strings.HasSuffix(status, "_IN_PROGRESS") && status != cloudformation.StackStatusReviewInProgress:
+		return nil, validationError("Stack [%s] cannot be deleted while in status %s", st.name, status)
+	case len(in.RetainResources) > 0 && status != cloudformation.StackStatusDeleteFailed:
+		return nil, validationError("Invalid operation on stack [%s]. RetainResources can only be specified when the stack is in the DELETE_FAILED state", st.name)
+	}
+
+	c.delete(st, in.RetainResources)
+	return &cloudformation.DeleteStackOutput{}, nil
+}
+
+// CancelUpdateStack - rolls back an update in progress
+func (c *CloudFormation) CancelUpdateStack(in *cloudformation.CancelUpdateStackInput) (*cloudformation.CancelUpdateStackOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st, err := c.lookup(aws.StringValue(in.StackName))
+	if err != nil {
+		return nil, err
+	}
+
+	if status, _ := st.status(); status != cloudformation.StackStatusUpdateInProgress {
+		return nil, validationError("CancelUpdateStack cannot be called from current stack status")
+	}
+
+	// events of the update that are not yet revealed never happen
+	now := time.Now()
+	for i, e := range st.events {
+		if e.visible.After(now) {
+			st.events = st.events[:i]
+			break
+		}
+	}
+
+	op := c.operation(st)
+	op.stack(cloudformation.StackStatusUpdateRollbackInProgress, "Stack update cancelled")
+	op.stack(cloudformation.StackStatusUpdateRollbackComplete, "")
+	st.state = st.previous
+	return &cloudformation.CancelUpdateStackOutput{}, nil
+}
+
+// ContinueUpdateRollbackWithContext - completes the rollback of a stack in UPDATE_ROLLBACK_FAILED
+func (c *CloudFormation) ContinueUpdateRollbackWithContext(ctx aws.Context, in *cloudformation.ContinueUpdateRollbackInput, opts ...request.Option) (*cloudformation.ContinueUpdateRollbackOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st, err := c.lookup(aws.StringValue(in.StackName))
+	if err != nil {
+		return nil, err
+	}
+
+	if status, _ := st.status(); status != cloudformation.StackStatusUpdateRollbackFailed {
+		return nil, validationError("Stack %s is in %s state and can not continue update rollback", st.name, status)
+	}
+
+	op := c.operation(st)
+	op.stack(cloudformation.StackStatusUpdateRollbackInProgress, userInitiated)
+	op.stack(cloudformation.StackStatusUpdateRollbackComplete, "")
+	st.state = st.previous
+	return &cloudformation.ContinueUpdateRollbackOutput{}, nil
+}
+
+// DescribeStacks - describes a stack by name or id, all stacks if no name is given
+func (c *CloudFormation) DescribeStacks(in *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := &cloudformation.DescribeStacksOutput{}
+	if in.StackName == nil {
+		for _, name := range sortedKeys(c.names) {
+			if st, err := c.lookup(name); err == nil {
+				out.Stacks = append(out.Stacks, st.describe())
+			}
+		}
+		return out, nil
+	}
+
+	st, err := c.lookup(aws.StringValue(in.StackName))
+	if err != nil {
+		return nil, err
+	}
+
+	out.Stacks = []*cloudformation.Stack{st.describe()}
+	return out, nil
+}
+
+// DescribeStacksWithContext - see DescribeStacks
+func (c *CloudFormation) DescribeStacksWithContext(ctx aws.Context, in *cloudformation.DescribeStacksInput, opts ...request.Option) (*cloudformation.DescribeStacksOutput, error) {
+	return c.DescribeStacks(in)
+}
+
+// DescribeStackEventsWithContext - returns the revealed events of a stack, newest first
+func (c *CloudFormation) DescribeStackEventsWithContext(ctx aws.Context, in *cloudformation.DescribeStackEventsInput, opts ...request.Option) (*cloudformation.DescribeStackEventsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st, err := c.lookup(aws.StringValue(in.StackName))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var events []*cloudformation.StackEvent
+	for i := len(st.events) - 1; i >= 0; i-- {
+		if !st.events[i].visible.After(now) {
+			events = append(events, st.events[i].StackEvent)
+		}
+	}
+
+	var start int
+	if in.NextToken != nil {
+		if start, err = strconv.Atoi(*in.NextToken); err != nil || start > len(events) {
+			return nil, validationError("Invalid NextToken")
+		}
+	}
+
+	end := start + eventPageSize
+	if end > len(events) {
+		end = len(events)
+	}
+
+	out := &cloudformation.DescribeStackEventsOutput{StackEvents: events[start:end]}
+	if end < len(events) {
+		out.NextToken = aws.String(strconv.Itoa(end))
+	}
+	return out, nil
+}
+
+// DescribeStackEventsPagesWithContext - calls fn for each page of events until fn returns false
+func (c *CloudFormation) DescribeStackEventsPagesWithContext(ctx aws.Context, in *cloudformation.DescribeStackEventsInput, fn func(*cloudformation.DescribeStackEventsOutput, bool) bool, opts ...request.Option) error {
+	params := *in
+	for {
+		page, err := c.DescribeStackEventsWithContext(ctx, &params)
+		if err != nil {
+			return err
+		}
+
+		if !fn(page, page.NextToken == nil) || page.NextToken == nil {
+			return nil
+		}
+		params.NextToken = page.NextToken
+	}
+}
+
+// wait - blocks until the stack is no longer in progress, returns a waiter
+// error if the final status is not success. Stacks that no longer exist
+// are a success if gone is set.
+func (c *CloudFormation) wait(ctx aws.Context, in *cloudformation.DescribeStacksInput, success string, gone bool) error {
+	poll := c.Step
+	if poll < time.Millisecond {
+		poll = time.Millisecond
+	}
+
+	for {
+		c.mu.Lock()
+		st, err := c.lookup(aws.StringValue(in.StackName))
+		var status string
+		if err == nil {
+			status, _ = st.status()
+		}
+		c.mu.Unlock()
+
+		switch {
+		case err != nil && gone, status == success:
+			return nil
+		case err != nil, !strings.HasSuffix(status, "_IN_PROGRESS"):
+			return awserr.New(request.WaiterResourceNotReadyErrorCode, "failed waiting for successful resource state", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return awserr.New(request.CanceledErrorCode, "waiter context canceled", ctx.Err())
+		case <-time.After(poll):
+		}
+	}
+}
+
+// WaitUntilStackCreateCompleteWithContext - waits for CREATE_COMPLETE
+func (c *CloudFormation) WaitUntilStackCreateCompleteWithContext(ctx aws.Context, in *cloudformation.DescribeStacksInput, opts ...request.WaiterOption) error {
+	return c.wait(ctx, in, cloudformation.StackStatusCreateComplete, false)
+}
+
+// WaitUntilStackUpdateCompleteWithContext - waits for UPDATE_COMPLETE
+func (c *CloudFormation) WaitUntilStackUpdateCompleteWithContext(ctx aws.Context, in *cloudformation.DescribeStacksInput, opts ...request.WaiterOption) error {
+	return c.wait(ctx, in, cloudformation.StackStatusUpdateComplete, false)
+}
+
+// WaitUntilStackImportCompleteWithContext - waits for IMPORT_COMPLETE
+func (c *CloudFormation) WaitUntilStackImportCompleteWithContext(ctx aws.Context, in *cloudformation.DescribeStacksInput, opts ...request.WaiterOption) error {
+	return c.wait(ctx, in, cloudformation.StackStatusImportComplete, false)
+}
+
+// WaitUntilStackDeleteCompleteWithContext - waits for DELETE_COMPLETE
+func (c *CloudFormation) WaitUntilStackDeleteCompleteWithContext(ctx aws.Context, in *cloudformation.DescribeStacksInput, opts ...request.WaiterOption) error {
+	return c.wait(ctx, in, cloudformation.StackStatusDeleteComplete, true)
+}
+
+// GetTemplate - returns the template of a stack or change-set
+func (c *CloudFormation) GetTemplate(in *cloudformation.GetTemplateInput) (*cloudformation.GetTemplateOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if in.ChangeSetName != nil {
+		_, cs, err := c.changeSet(in.StackName, in.ChangeSetName)
+		if err != nil {
+			return nil, err
+		}
+		return &cloudformation.GetTemplateOutput{TemplateBody: aws.String(cs.next.template)}, nil
+	}
+
+	st, err := c.lookup(aws.StringValue(in.StackName))
+	if err != nil {
+		return nil, err
+	}
+	return &cloudformation.GetTemplateOutput{TemplateBody: aws.String(st.template)}, nil
+}
+
+// GetTemplateWithContext - see GetTemplate
+func (c *CloudFormation) GetTemplateWithContext(ctx aws.Context, in *cloudformation.GetTemplateInput, opts ...request.Option) (*cloudformation.GetTemplateOutput, error) {
+	return c.GetTemplate(in)
+}
+
+// ValidateTemplate - parses the template & returns its parameters
+func (c *CloudFormation) ValidateTemplate(in *cloudformation.ValidateTemplateInput) (*cloudformation.ValidateTemplateOutput, error) {
+	body, err := c.templateBody(in.TemplateBody, in.TemplateURL)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := parseTemplate(body)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &cloudformation.ValidateTemplateOutput{}
+	if t.Description != "" {
+		out.Description = aws.String(t.Description)
+	}
+
+	for _, key := range sortedKeys(t.Parameters) {
+		p := t.Parameters[key]
+		tp := &cloudformation.TemplateParameter{
+			ParameterKey: aws.String(key),
+			NoEcho:       aws.Bool(fmt.Sprint(p.NoEcho) == "true"),
+		}
+
+		if p.Default != nil {
+			tp.DefaultValue = aws.String(fmt.Sprint(p.Default))
+		}
+
+		if p.Description != "" {
+			tp.Description = aws.String(p.Description)
+		}
+		out.Parameters = append(out.Parameters, tp)
+	}
+
+	if checkCapabilities(t, nil) != nil {
+		out.Capabilities = aws.StringSlice([]string{cloudformation.CapabilityCapabilityIam})
+		out.CapabilitiesReason = aws.String("The template contains IAM resources")
+	}
+	return out, nil
+}
+
+// ListExports - returns the exports of all stacks, sorted by name
+func (c *CloudFormation) ListExports(in *cloudformation.ListExportsInput) (*cloudformation.ListExportsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	exports := c.exports()
+	out := &cloudformation.ListExportsOutput{}
+	for _, name := range sortedKeys(exports) {
+		out.Exports = append(out.Exports, &cloudformation.Export{
+			Name:             aws.String(name),
+			Value:            aws.String(exports[name].value),
+			ExportingStackId: aws.String(exports[name].stack.id),
+		})
+	}
+	return out, nil
+}
+
+// UpdateTerminationProtection - enables or disables termination protection
+func (c *CloudFormation) UpdateTerminationProtection(in *cloudformation.UpdateTerminationProtectionInput) (*cloudformation.UpdateTerminationProtectionOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st, err := c.lookup(aws.StringValue(in.StackName))
+	if err != nil {
+		return nil, err
+	}
+
+	st.protection = aws.BoolValue(in.EnableTerminationProtection)
+	return &cloudformation.UpdateTerminationProtectionOutput{StackId: aws.String(st.id)}, nil
+}
+
+// UpdateTerminationProtectionWithContext - see UpdateTerminationProtection
+func (c *CloudFormation) UpdateTerminationProtectionWithContext(ctx aws.Context, in *cloudformation.UpdateTerminationProtectionInput, opts ...request.Option) (*cloudformation.UpdateTerminationProtectionOutput, error) {
+	return c.UpdateTerminationProtection(in)
+}
+
+// SetStackPolicy - sets the stack policy, the policy is not enforced
+func (c *CloudFormation) SetStackPolicy(in *cloudformation.SetStackPolicyInput) (*cloudformation.SetStackPolicyOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st, err := c.lookup(aws.StringValue(in.StackName))
+	if err != nil {
+		return nil, err
+	}
+
+	st.policy = aws.StringValue(in.StackPolicyBody)
+	return &cloudformation.SetStackPolicyOutput{}, nil
+}
+
+// DetectStackDriftWithContext - starts drift detection, stacks never drift
+func (c *CloudFormation) DetectStackDriftWithContext(ctx aws.Context, in *cloudformation.DetectStackDriftInput, opts ...request.Option) (*cloudformation.DetectStackDriftOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st, err := c.lookup(aws.StringValue(in.StackName))
+	if err != nil {
+		return nil, err
+	}
+
+	c.seq++
+	id := fmt.Sprintf("fake-drift-%06d", c.seq)
+	c.drifts[id] = st.id
+	return &cloudformation.DetectStackDriftOutput{StackDriftDetectionId: aws.String(id)}, nil
+}
+
+// DescribeStackDriftDetectionStatusWithContext - returns a completed, in sync detection
+func (c *CloudFormation) DescribeStackDriftDetectionStatusWithContext(ctx aws.Context, in *cloudformation.DescribeStackDriftDetectionStatusInput, opts ...request.Option) (*cloudformation.DescribeStackDriftDetectionStatusOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id, ok := c.drifts[aws.StringValue(in.StackDriftDetectionId)]
+	if !ok {
+		return nil, validationError("Drift detection [%s] does not exist", aws.StringValue(in.StackDriftDetectionId))
+	}
+
+	return &cloudformation.DescribeStackDriftDetectionStatusOutput{
+		StackDriftDetectionId:     in.StackDriftDetectionId,
+		StackId:                   aws.String(id),
+		DetectionStatus:           aws.String(cloudformation.StackDriftDetectionStatusDetectionComplete),
+		StackDriftStatus:          aws.String(cloudformation.StackDriftStatusInSync),
+		DriftedStackResourceCount: aws.Int64(0),
+		Timestamp:                 aws.Time(time.Now()),
+	}, nil
+}
+
+// DescribeStackResourceDriftsWithContext - returns all stack resources as in sync
+func (c *CloudFormation) DescribeStackResourceDriftsWithContext(ctx aws.Context, in *cloudformation.DescribeStackResourceDriftsInput, opts ...request.Option) (*cloudformation.DescribeStackResourceDriftsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st, err := c.lookup(aws.StringValue(in.StackName))
+	if err != nil {
+		return nil, err
+	}
+
+	out := &cloudformation.DescribeStackResourceDriftsOutput{}
+	for _, id := range sortedKeys(st.resources) {
+		r := st.resources[id]
+		out.StackResourceDrifts = append(out.StackResourceDrifts, &cloudformation.StackResourceDrift{
+			StackId:                  aws.String(st.id),
+			LogicalResourceId:        aws.String(id),
+			PhysicalResourceId:       aws.String(r.physical),
+			ResourceType:             aws.String(r.typ),
+			StackResourceDriftStatus: aws.String(cloudformation.StackResourceDriftStatusInSync),
+			Timestamp:                aws.Time(time.Now()),
+		})
+	}
+	return out, nil
+}
+
+// DescribeStackSetWithContext - stack sets are not supported, no stack set exists
+func (c *CloudFormation) DescribeStackSetWithContext(ctx aws.Context, in *cloudformation.DescribeStackSetInput, opts ...request.Option) (*cloudformation.DescribeStackSetOutput, error) {
+	return nil, requestError(http.StatusNotFound, cloudformation.ErrCodeStackSetNotFoundException, "StackSet %s not found", aws.StringValue(in.StackSetName))
+}
+
+// CreateStackSetWithContext - not supported
+func (c *CloudFormation) CreateStackSetWithContext(aws.Context, *cloudformation.CreateStackSetInput, ...request.Option) (*cloudformation.CreateStackSetOutput, error) {
+	return nil, notSupported("CreateStackSet")
+}
+
+// UpdateStackSetWithContext - not supported
+func (c *CloudFormation) UpdateStackSetWithContext(aws.Context, *cloudformation.UpdateStackSetInput, ...request.Option) (*cloudformation.UpdateStackSetOutput, error) {
+	return nil, notSupported("UpdateStackSet")
+}
+
+// DeleteStackSetWithContext - not supported
+func (c *CloudFormation) DeleteStackSetWithContext(aws.Context, *cloudformation.DeleteStackSetInput, ...request.Option) (*cloudformation.DeleteStackSetOutput, error) {
+	return nil, notSupported("DeleteStackSet")
+}
+
+// CreateStackInstancesWithContext - not supported
+func (c *CloudFormation) CreateStackInstancesWithContext(aws.Context, *cloudformation.CreateStackInstancesInput, ...request.Option) (*cloudformation.CreateStackInstancesOutput, error) {
+	return nil, notSupported("CreateStackInstances")
+}
+
+// DeleteStackInstancesWithContext - not supported
+func (c *CloudFormation) DeleteStackInstancesWithContext(aws.Context, *cloudformation.DeleteStackInstancesInput, ...request.Option) (*cloudformation.DeleteStackInstancesOutput, error) {
+	return nil, notSupported("DeleteStackInstances")
+}
+
+// ListStackInstancesWithContext - not supported
+func (c *CloudFormation) ListStackInstancesWithContext(aws.Context, *cloudformation.ListStackInstancesInput, ...request.Option) (*cloudformation.ListStackInstancesOutput, error) {
+	return nil, notSupported("ListStackInstances")
+}
+
+// DescribeStackSetOperationWithContext - not supported
+func (c *CloudFormation) DescribeStackSetOperationWithContext(aws.Context, *cloudformation.DescribeStackSetOperationInput, ...request.Option) (*cloudformation.DescribeStackSetOperationOutput, error) {
+	return nil, notSupported("DescribeStackSetOperation")
+}
+
+// ListStackSetOperationResultsWithContext - not supported
+func (c *CloudFormation) ListStackSetOperationResultsWithContext(aws.Context, *cloudformation.ListStackSetOperationResultsInput, ...request.Option) (*cloudformation.ListStackSetOperationResultsOutput, error) {
+	return nil, notSupported("ListStackSetOperationResults")
+}
+
+// Stacks - returns the names of all stacks that are not deleted, sorted
+func (c *CloudFormation) Stacks() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var names []string
+	for name := range c.names {
+		if _, err := c.lookup(name); err == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
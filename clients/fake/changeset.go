@@ -0,0 +1,280 @@
+package fake
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// reason of change-sets without changes
+const noChanges = "The submitted information didn't contain changes. Submit different information to create a change set."
+
+type changeSet struct {
+	id        string
+	name      string
+	typ       string
+	created   time.Time
+	status    string
+	reason    string
+	execution string
+	next      *state
+	changes   []change
+}
+
+// changeSet - returns a change-set by id, or by name & stack, the lock must be held
+func (c *CloudFormation) changeSet(stackName, name *string) (*stack, *changeSet, error) {
+	for _, st := range c.stacks {
+		for _, cs := range st.changeSets {
+			if cs.id == aws.StringValue(name) {
+				return st, cs, nil
+			}
+		}
+	}
+
+	if st, err := c.lookup(aws.StringValue(stackName)); err == nil {
+		for _, cs := range st.changeSets {
+			if cs.name == aws.StringValue(name) {
+				return st, cs, nil
+			}
+		}
+	}
+	return nil, nil, requestError(http.StatusNotFound, cloudformation.ErrCodeChangeSetNotFoundException, "ChangeSet [%s] does not exist", aws.StringValue(name))
+}
+
+// CreateChangeSetWithContext - creates a change-set, CREATE change-sets create
+// the stack in REVIEW_IN_PROGRESS. Change-sets are complete when created.
+func (c *CloudFormation) CreateChangeSetWithContext(ctx aws.Context, in *cloudformation.CreateChangeSetInput, opts ...request.Option) (*cloudformation.CreateChangeSetOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name, csName := aws.StringValue(in.StackName), aws.StringValue(in.ChangeSetName)
+	typ := aws.StringValue(in.ChangeSetType)
+	if typ == "" {
+		typ = cloudformation.ChangeSetTypeUpdate
+	}
+
+	st, err := c.lookup(name)
+	switch {
+	case typ == cloudformation.ChangeSetTypeCreate && err == nil:
+		if status, _ := st.status(); status != cloudformation.StackStatusReviewInProgress {
+			return nil, validationError("Stack [%s] already exists and cannot be created again with the changeSet [%s].", name, csName)
+		}
+	case typ == cloudformation.ChangeSetTypeCreate:
+		st = c.newStack(name)
+	case err != nil:
+		return nil, err
+	}
+
+	for _, cs := range st.changeSets {
+		if cs.name == csName {
+			return nil, requestError(http.StatusBadRequest, cloudformation.ErrCodeAlreadyExistsException, "ChangeSet [%s] already exists", csName)
+		}
+	}
+
+	body, err := c.templateBody(in.TemplateBody, in.TemplateURL)
+	if err != nil {
+		return nil, err
+	}
+
+	next, changes, err := c.prepare(st, body, in.Parameters, in.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkCapabilities(next.parsed, in.Capabilities); err != nil {
+		return nil, err
+	}
+
+	if typ == cloudformation.ChangeSetTypeImport {
+		changes = nil
+		for _, r := range in.ResourcesToImport {
+			id := aws.StringValue(r.LogicalResourceId)
+			res, ok := next.resources[id]
+			if !ok {
+				return nil, validationError("Resource [%s] to import is not defined in the template", id)
+			}
+
+			for _, k := range sortedKeys(r.ResourceIdentifier) {
+				res.physical = aws.StringValue(r.ResourceIdentifier[k])
+				break
+			}
+			changes = append(changes, change{cloudformation.ChangeActionImport, id, aws.StringValue(r.ResourceType)})
+		}
+	}
+
+	c.seq++
+	cs := &changeSet{
+		id:        fmt.Sprintf("arn:aws:cloudformation:%s:%s:changeSet/%s/fake-%06d", c.region, Account, csName, c.seq),
+		name:      csName,
+		typ:       typ,
+		created:   time.Now(),
+		status:    cloudformation.ChangeSetStatusCreateComplete,
+		execution: cloudformation.ExecutionStatusAvailable,
+		next:      next,
+		changes:   changes,
+	}
+
+	if typ == cloudformation.ChangeSetTypeUpdate && c.unchanged(st, next) {
+		cs.status, cs.reason, cs.execution = cloudformation.ChangeSetStatusFailed, noChanges, cloudformation.ExecutionStatusUnavailable
+	}
+
+	if _, ok := c.stacks[st.id]; !ok {
+		c.register(st)
+		c.operation(st).stack(cloudformation.StackStatusReviewInProgress, userInitiated)
+	}
+
+	st.capabilities = in.Capabilities
+	st.changeSets = append(st.changeSets, cs)
+	return &cloudformation.CreateChangeSetOutput{Id: aws.String(cs.id), StackId: aws.String(st.id)}, nil
+}
+
+// ExecuteChangeSetWithContext - creates, updates or imports into the stack,
+// other change-sets of the stack become obsolete
+func (c *CloudFormation) ExecuteChangeSetWithContext(ctx aws.Context, in *cloudformation.ExecuteChangeSetInput, opts ...request.Option) (*cloudformation.ExecuteChangeSetOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st, cs, err := c.changeSet(in.StackName, in.ChangeSetName)
+	if err != nil {
+		return nil, err
+	}
+
+	if cs.execution != cloudformation.ExecutionStatusAvailable {
+		return nil, requestError(http.StatusBadRequest, cloudformation.ErrCodeInvalidChangeSetStatusException, "ChangeSet [%s] cannot be executed in its current execution status of [%s]", cs.id, cs.execution)
+	}
+
+	switch cs.typ {
+	case cloudformation.ChangeSetTypeCreate:
+		c.create(st, cs.next, cs.changes, cloudformation.OnFailureRollback)
+	case cloudformation.ChangeSetTypeImport:
+		c.imprt(st, cs.next, cs.changes)
+	default:
+		if err := st.updatable(); err != nil {
+			return nil, err
+		}
+		c.update(st, cs.next, cs.changes)
+	}
+
+	for _, o := range st.changeSets {
+		o.execution = cloudformation.ExecutionStatusObsolete
+	}
+	cs.execution = cloudformation.ExecutionStatusExecuteComplete
+	return &cloudformation.ExecuteChangeSetOutput{}, nil
+}
+
+// DescribeChangeSet - describes a change-set & its resource changes
+func (c *CloudFormation) DescribeChangeSet(in *cloudformation.DescribeChangeSetInput) (*cloudformation.DescribeChangeSetOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st, cs, err := c.changeSet(in.StackName, in.ChangeSetName)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &cloudformation.DescribeChangeSetOutput{
+		ChangeSetId:     aws.String(cs.id),
+		ChangeSetName:   aws.String(cs.name),
+		StackId:         aws.String(st.id),
+		StackName:       aws.String(st.name),
+		Status:          aws.String(cs.status),
+		ExecutionStatus: aws.String(cs.execution),
+		CreationTime:    aws.Time(cs.created),
+		Parameters:      cs.next.parameters,
+		Tags:            cs.next.tags,
+		Capabilities:    st.capabilities,
+	}
+
+	if cs.reason != "" {
+		out.StatusReason = aws.String(cs.reason)
+	}
+
+	for _, ch := range cs.changes {
+		rc := &cloudformation.ResourceChange{
+			Action:            aws.String(ch.action),
+			LogicalResourceId: aws.String(ch.logical),
+			ResourceType:      aws.String(ch.typ),
+		}
+
+		switch ch.action {
+		case cloudformation.ChangeActionModify:
+			rc.Replacement = aws.String(cloudformation.ReplacementFalse)
+			rc.PhysicalResourceId = aws.String(cs.next.resources[ch.logical].physical)
+		case cloudformation.ChangeActionImport:
+			rc.PhysicalResourceId = aws.String(cs.next.resources[ch.logical].physical)
+		case cloudformation.ChangeActionRemove:
+			if r, ok := st.resources[ch.logical]; ok {
+				rc.PhysicalResourceId = aws.String(r.physical)
+			}
+		}
+
+		out.Changes = append(out.Changes, &cloudformation.Change{
+			Type:           aws.String(cloudformation.ChangeTypeResource),
+			ResourceChange: rc,
+		})
+	}
+	return out, nil
+}
+
+// DescribeChangeSetWithContext - see DescribeChangeSet
+func (c *CloudFormation) DescribeChangeSetWithContext(ctx aws.Context, in *cloudformation.DescribeChangeSetInput, opts ...request.Option) (*cloudformation.DescribeChangeSetOutput, error) {
+	return c.DescribeChangeSet(in)
+}
+
+// ListChangeSets - lists the change-sets of a stack
+func (c *CloudFormation) ListChangeSets(in *cloudformation.ListChangeSetsInput) (*cloudformation.ListChangeSetsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st, err := c.lookup(aws.StringValue(in.StackName))
+	if err != nil {
+		return nil, err
+	}
+
+	out := &cloudformation.ListChangeSetsOutput{}
+	for _, cs := range st.changeSets {
+		s := &cloudformation.ChangeSetSummary{
+			ChangeSetId:     aws.String(cs.id),
+			ChangeSetName:   aws.String(cs.name),
+			StackId:         aws.String(st.id),
+			StackName:       aws.String(st.name),
+			Status:          aws.String(cs.status),
+			ExecutionStatus: aws.String(cs.execution),
+			CreationTime:    aws.Time(cs.created),
+		}
+
+		if cs.reason != "" {
+			s.StatusReason = aws.String(cs.reason)
+		}
+		out.Summaries = append(out.Summaries, s)
+	}
+	return out, nil
+}
+
+// ListChangeSetsWithContext - see ListChangeSets
+func (c *CloudFormation) ListChangeSetsWithContext(ctx aws.Context, in *cloudformation.ListChangeSetsInput, opts ...request.Option) (*cloudformation.ListChangeSetsOutput, error) {
+	return c.ListChangeSets(in)
+}
+
+// DeleteChangeSet - deletes a change-set
+func (c *CloudFormation) DeleteChangeSet(in *cloudformation.DeleteChangeSetInput) (*cloudformation.DeleteChangeSetOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st, cs, err := c.changeSet(in.StackName, in.ChangeSetName)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, o := range st.changeSets {
+		if o == cs {
+			st.changeSets = append(st.changeSets[:i], st.changeSets[i+1:]...)
+			break
+		}
+	}
+	return &cloudformation.DeleteChangeSetOutput{}, nil
+}
@@ -0,0 +1,581 @@
+package fake
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+)
+
+// reason of the stack event that starts a stack operation
+const userInitiated = "User Initiated"
+
+// stackType - resource type of stack events
+const stackType = "AWS::CloudFormation::Stack"
+
+// CloudFormation - in-memory CloudFormation. Operations take effect when
+// requested, their events are revealed one every Step and the stack status
+// follows the revealed events. Resources are not provisioned, physical ids
+// and output values are derived from the template.
+type CloudFormation struct {
+	cloudformationiface.CloudFormationAPI
+
+	// Fail - logical resource ids mapped to the failure reason of any
+	// create, update or delete of the resource
+	Fail map[string]string
+
+	// Step - time between the events of an operation, all events are
+	// revealed immediately if zero
+	Step time.Duration
+
+	region string
+	s3     *S3
+
+	mu     sync.Mutex
+	stacks map[string]*stack // stacks by id
+	names  map[string]string // stack names to the id of the latest stack
+	drifts map[string]string // drift detection ids to stack ids
+	seq    int
+}
+
+// NewCloudFormation - returns a backend without stacks, template urls are read from s3
+func NewCloudFormation(region string, s3 *S3) *CloudFormation {
+	return &CloudFormation{
+		region: region,
+		s3:     s3,
+		stacks: make(map[string]*stack),
+		names:  make(map[string]string),
+		drifts: make(map[string]string),
+	}
+}
+
+// state - template, parameters & resources of a stack
+type state struct {
+	template   string
+	parsed     *template
+	parameters []*cloudformation.Parameter
+	tags       []*cloudformation.Tag
+	resources  map[string]*resource
+	outputs    []*cloudformation.Output
+}
+
+type resource struct {
+	typ        string
+	physical   string
+	definition string
+}
+
+type stack struct {
+	state
+
+	// previous - state before the last update, restored if the update is cancelled
+	previous state
+
+	id              string
+	name            string
+	capabilities    []*string
+	notifications   []*string
+	disableRollback bool
+	protection      bool
+	policy          string
+	created         time.Time
+	updated         *time.Time
+	events          []event // chronological
+	changeSets      []*changeSet
+}
+
+// event - a stack event & the time it is revealed
+type event struct {
+	*cloudformation.StackEvent
+	visible time.Time
+}
+
+// status - returns the status & reason of the latest revealed stack event
+func (st *stack) status() (string, string) {
+	now := time.Now()
+	for i := len(st.events) - 1; i >= 0; i-- {
+		e := st.events[i]
+		if e.visible.After(now) || aws.StringValue(e.PhysicalResourceId) != st.id {
+			continue
+		}
+		return aws.StringValue(e.ResourceStatus), aws.StringValue(e.ResourceStatusReason)
+	}
+	return "", ""
+}
+
+// updatable - returns an error if the stack status does not allow updates
+func (st *stack) updatable() error {
+	status, _ := st.status()
+	switch status {
+	case cloudformation.StackStatusCreateComplete,
+		cloudformation.StackStatusUpdateComplete,
+		cloudformation.StackStatusUpdateRollbackComplete,
+		cloudformation.StackStatusImportComplete,
+		cloudformation.StackStatusImportRollbackComplete:
+		return nil
+	}
+	return validationError("Stack:%s is in %s state and can not be updated.", st.id, status)
+}
+
+// lookup - returns a stack by name or id, deleted stacks are only returned by id.
+// The lock must be held.
+func (c *CloudFormation) lookup(name string) (*stack, error) {
+	if st, ok := c.stacks[name]; ok {
+		return st, nil
+	}
+
+	if id, ok := c.names[name]; ok {
+		st := c.stacks[id]
+		if status, _ := st.status(); status != cloudformation.StackStatusDeleteComplete {
+			return st, nil
+		}
+	}
+	return nil, validationError("Stack with id %s does not exist", name)
+}
+
+// newStack - returns an unregistered stack without resources
+func (c *CloudFormation) newStack(name string) *stack {
+	c.seq++
+	return &stack{
+		id:      fmt.Sprintf("arn:aws:cloudformation:%s:%s:stack/%s/fake-%06d", c.region, Account, name, c.seq),
+		name:    name,
+		created: time.Now(),
+		state:   state{resources: make(map[string]*resource)},
+	}
+}
+
+// register - adds a stack, replacing deleted stacks of the same name
+func (c *CloudFormation) register(st *stack) {
+	c.stacks[st.id] = st
+	c.names[st.name] = st.id
+}
+
+// templateBody - returns the template body or the template at the url
+func (c *CloudFormation) templateBody(body, url *string) (string, error) {
+	if body != nil {
+		return *body, nil
+	}
+
+	if url == nil {
+		return "", validationError("Either Template URL or Template Body must be specified.")
+	}
+
+	if c.s3 != nil {
+		if b, ok := c.s3.objectURL(*url); ok {
+			return string(b), nil
+		}
+	}
+	return "", validationError("S3 error: Access Denied, template [%s] could not be read", *url)
+}
+
+// prepare - returns the state of the stack after applying the template,
+// parameters & tags and the resource changes to get there
+func (c *CloudFormation) prepare(st *stack, body string, params []*cloudformation.Parameter, tags []*cloudformation.Tag) (*state, []change, error) {
+	t, err := parseTemplate(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resolved, err := t.parameters(params, st.parameters)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	next := &state{
+		template:   body,
+		parsed:     t,
+		parameters: resolved,
+		tags:       tags,
+		resources:  make(map[string]*resource),
+	}
+
+	for _, id := range sortedKeys(t.Resources) {
+		r := &resource{typ: t.resourceType(id), definition: t.definition(id)}
+		if cur, ok := st.resources[id]; ok {
+			r.physical = cur.physical
+		} else {
+			c.seq++
+			r.physical = fmt.Sprintf("%s-%s-%012X", st.name, id, c.seq)
+		}
+		next.resources[id] = r
+	}
+
+	if next.outputs, err = c.outputs(st, next); err != nil {
+		return nil, nil, err
+	}
+	return next, diff(st.resources, t, changedParameters(st.parameters, resolved)), nil
+}
+
+// export - an exported output value
+type export struct {
+	value string
+	stack *stack
+}
+
+// exports - returns the exports of all stacks by name, the lock must be held
+func (c *CloudFormation) exports() map[string]export {
+	exports := make(map[string]export)
+	for _, st := range c.stacks {
+		switch status, _ := st.status(); status {
+		case "", cloudformation.StackStatusDeleteComplete, cloudformation.StackStatusRollbackComplete, cloudformation.StackStatusReviewInProgress:
+			continue
+		}
+
+		for _, o := range st.outputs {
+			if o.ExportName != nil {
+				exports[*o.ExportName] = export{aws.StringValue(o.OutputValue), st}
+			}
+		}
+	}
+	return exports
+}
+
+// outputs - resolves the template outputs of the next state of the stack,
+// export names may not be exported by another stack
+func (c *CloudFormation) outputs(st *stack, next *state) ([]*cloudformation.Output, error) {
+	exports := c.exports()
+	r := &resolver{
+		values: map[string]string{
+			"AWS::AccountId": Account,
+			"AWS::NoValue":   "",
+			"AWS::Partition": "aws",
+			"AWS::Region":    c.region,
+			"AWS::StackId":   st.id,
+			"AWS::StackName": st.name,
+			"AWS::URLSuffix": "amazonaws.com",
+		},
+		resources: next.resources,
+		exports:   make(map[string]string),
+	}
+
+	for _, p := range next.parameters {
+		r.values[aws.StringValue(p.ParameterKey)] = aws.StringValue(p.ParameterValue)
+	}
+
+	for name, e := range exports {
+		r.exports[name] = e.value
+	}
+
+	var outputs []*cloudformation.Output
+	for _, key := range sortedKeys(next.parsed.Outputs) {
+		o := next.parsed.Outputs[key]
+		out := &cloudformation.Output{
+			OutputKey:   aws.String(key),
+			OutputValue: aws.String(r.value(o.Value)),
+		}
+
+		if o.Description != "" {
+			out.Description = aws.String(o.Description)
+		}
+
+		if o.Export.Name != nil {
+			name := r.value(o.Export.Name)
+			if e, ok := exports[name]; ok && e.stack != st {
+				return nil, validationError("Export with name %s is already exported by stack %s", name, e.stack.name)
+			}
+			out.ExportName = aws.String(name)
+		}
+		outputs = append(outputs, out)
+	}
+	return outputs, nil
+}
+
+// checkCapabilities - returns an error if the template defines IAM resources
+// and no IAM capability is acknowledged
+func checkCapabilities(t *template, caps []*string) error {
+	iam := false
+	for id := range t.Resources {
+		if strings.HasPrefix(t.resourceType(id), "AWS::IAM::") {
+			iam = true
+		}
+	}
+
+	if !iam {
+		return nil
+	}
+
+	for _, c := range caps {
+		switch aws.StringValue(c) {
+		case cloudformation.CapabilityCapabilityIam, cloudformation.CapabilityCapabilityNamedIam:
+			return nil
+		}
+	}
+	return requestError(http.StatusBadRequest, cloudformation.ErrCodeInsufficientCapabilitiesException, "Requires capabilities : [%s]", cloudformation.CapabilityCapabilityIam)
+}
+
+// operation - records the events of a stack operation
+type operation struct {
+	c     *CloudFormation
+	st    *stack
+	start time.Time // reveal time of the first event
+	at    time.Time // timestamp of the first event
+	n     int
+}
+
+// operation - starts recording an operation on the stack, event timestamps
+// always follow the events of previous operations
+func (c *CloudFormation) operation(st *stack) *operation {
+	now := time.Now()
+	at := now
+	if n := len(st.events); n > 0 {
+		if last := aws.TimeValue(st.events[n-1].Timestamp); !at.After(last) {
+			at = last.Add(time.Millisecond)
+		}
+	}
+	return &operation{c: c, st: st, start: now, at: at}
+}
+
+// event - records a resource event
+func (o *operation) event(logical, physical, typ, status, reason string) {
+	gap := o.c.Step
+	if gap < time.Millisecond {
+		gap = time.Millisecond
+	}
+
+	o.c.seq++
+	e := &cloudformation.StackEvent{
+		EventId:           aws.String(fmt.Sprintf("%s-%s-%06d", logical, status, o.c.seq)),
+		StackId:           aws.String(o.st.id),
+		StackName:         aws.String(o.st.name),
+		LogicalResourceId: aws.String(logical),
+		ResourceType:      aws.String(typ),
+		ResourceStatus:    aws.String(status),
+		Timestamp:         aws.Time(o.at.Add(time.Duration(o.n) * gap)),
+	}
+
+	if physical != "" {
+		e.PhysicalResourceId = aws.String(physical)
+	}
+
+	if reason != "" {
+		e.ResourceStatusReason = aws.String(reason)
+	}
+
+	o.st.events = append(o.st.events, event{
+		StackEvent: e,
+		visible:    o.start.Add(time.Duration(o.n) * o.c.Step),
+	})
+	o.n++
+}
+
+// stack - records a stack event
+func (o *operation) stack(status, reason string) {
+	o.event(o.st.name, o.st.id, stackType, status, reason)
+}
+
+// apply - creates & updates the resources of the changes in order, resources
+// after a failed resource are cancelled. Returns the applied changes & the
+// ids of failed resources.
+func (c *CloudFormation) apply(op *operation, next *state, changes []change) (done []change, failed []string) {
+	for _, ch := range changes {
+		verb, cancelled := "CREATE", "Resource creation cancelled"
+		switch ch.action {
+		case cloudformation.ChangeActionRemove:
+			continue
+		case cloudformation.ChangeActionModify:
+			verb, cancelled = "UPDATE", "Resource update cancelled"
+		}
+
+		physical := next.resources[ch.logical].physical
+		if len(failed) > 0 {
+			op.event(ch.logical, physical, ch.typ, verb+"_FAILED", cancelled)
+			failed = append(failed, ch.logical)
+			continue
+		}
+
+		op.event(ch.logical, physical, ch.typ, verb+"_IN_PROGRESS", "")
+		if reason, ok := c.Fail[ch.logical]; ok {
+			op.event(ch.logical, physical, ch.typ, verb+"_FAILED", reason)
+			failed = append(failed, ch.logical)
+			continue
+		}
+
+		op.event(ch.logical, physical, ch.typ, verb+"_COMPLETE", "")
+		done = append(done, ch)
+	}
+	return done, failed
+}
+
+// remove - deletes the given resources in reverse order, resources are
+// removed from res unless their deletion failed. Fail is ignored for
+// rollbacks. Returns the ids of failed resources.
+func (c *CloudFormation) remove(op *operation, res map[string]*resource, ids []string, retain map[string]bool, rollback bool) (failed []string) {
+	for i := len(ids) - 1; i >= 0; i-- {
+		id := ids[i]
+		r, ok := res[id]
+		if !ok {
+			continue
+		}
+
+		if retain[id] {
+			op.event(id, r.physical, r.typ, cloudformation.ResourceStatusDeleteSkipped, "")
+			delete(res, id)
+			continue
+		}
+
+		op.event(id, r.physical, r.typ, cloudformation.ResourceStatusDeleteInProgress, "")
+		if reason, ok := c.Fail[id]; ok && !rollback {
+			op.event(id, r.physical, r.typ, cloudformation.ResourceStatusDeleteFailed, reason)
+			failed = append(failed, id)
+			continue
+		}
+
+		op.event(id, r.physical, r.typ, cloudformation.ResourceStatusDeleteComplete, "")
+		delete(res, id)
+	}
+	return failed
+}
+
+// create - creates the stack resources, on failure the stack is rolled back,
+// deleted or left as is depending on onFailure
+func (c *CloudFormation) create(st *stack, next *state, changes []change, onFailure string) {
+	op := c.operation(st)
+	op.stack(cloudformation.StackStatusCreateInProgress, userInitiated)
+
+	done, failed := c.apply(op, next, changes)
+	if len(failed) == 0 {
+		op.stack(cloudformation.StackStatusCreateComplete, "")
+		st.state = *next
+		return
+	}
+
+	created := make(map[string]*resource)
+	var ids []string
+	for _, ch := range done {
+		created[ch.logical] = next.resources[ch.logical]
+		ids = append(ids, ch.logical)
+	}
+
+	st.state = *next
+	st.resources = created
+	st.outputs = nil
+
+	reason := fmt.Sprintf("The following resource(s) failed to create: [%s]. ", strings.Join(failed, ", "))
+	if onFailure == cloudformation.OnFailureDoNothing {
+		op.stack(cloudformation.StackStatusCreateFailed, reason)
+		return
+	}
+
+	op.stack(cloudformation.StackStatusRollbackInProgress, reason+"Rollback requested by user.")
+	c.remove(op, st.resources, ids, nil, true)
+	op.stack(cloudformation.StackStatusRollbackComplete, "")
+
+	if onFailure == cloudformation.OnFailureDelete {
+		op.stack(cloudformation.StackStatusDeleteInProgress, "")
+		op.stack(cloudformation.StackStatusDeleteComplete, "")
+	}
+}
+
+// update - applies the changes, removed resources are deleted once all other
+// changes succeeded. On failure the applied changes are rolled back.
+func (c *CloudFormation) update(st *stack, next *state, changes []change) {
+	op := c.operation(st)
+	op.stack(cloudformation.StackStatusUpdateInProgress, userInitiated)
+
+	now := time.Now()
+	st.updated = &now
+	st.previous = st.state
+
+	done, failed := c.apply(op, next, changes)
+	if len(failed) == 0 {
+		op.stack(cloudformation.StackStatusUpdateCompleteCleanupInProgress, "")
+
+		var removed []string
+		old := make(map[string]*resource)
+		for _, ch := range changes {
+			if ch.action == cloudformation.ChangeActionRemove {
+				removed = append(removed, ch.logical)
+				old[ch.logical] = st.resources[ch.logical]
+			}
+		}
+
+		// resources that fail to delete during cleanup are retained
+		c.remove(op, old, removed, nil, false)
+		op.stack(cloudformation.StackStatusUpdateComplete, "")
+		st.state = *next
+		return
+	}
+
+	op.stack(cloudformation.StackStatusUpdateRollbackInProgress, fmt.Sprintf("The following resource(s) failed to update: [%s]. ", strings.Join(failed, ", ")))
+	for i := len(done) - 1; i >= 0; i-- {
+		ch := done[i]
+		r := next.resources[ch.logical]
+		if ch.action == cloudformation.ChangeActionAdd {
+			op.event(ch.logical, r.physical, ch.typ, cloudformation.ResourceStatusDeleteInProgress, "")
+			op.event(ch.logical, r.physical, ch.typ, cloudformation.ResourceStatusDeleteComplete, "")
+			continue
+		}
+		op.event(ch.logical, r.physical, ch.typ, cloudformation.ResourceStatusUpdateInProgress, "")
+		op.event(ch.logical, r.physical, ch.typ, cloudformation.ResourceStatusUpdateComplete, "")
+	}
+	op.stack(cloudformation.StackStatusUpdateRollbackCompleteCleanupInProgress, "")
+	op.stack(cloudformation.StackStatusUpdateRollbackComplete, "")
+}
+
+// imprt - imports the resources of the changes
+func (c *CloudFormation) imprt(st *stack, next *state, changes []change) {
+	op := c.operation(st)
+	op.stack(cloudformation.StackStatusImportInProgress, userInitiated)
+	for _, ch := range changes {
+		physical := next.resources[ch.logical].physical
+		op.event(ch.logical, physical, ch.typ, cloudformation.ResourceStatusImportInProgress, "")
+		op.event(ch.logical, physical, ch.typ, cloudformation.ResourceStatusImportComplete, "")
+	}
+	op.stack(cloudformation.StackStatusImportComplete, "")
+	st.state = *next
+}
+
+// delete - deletes the stack resources in reverse order, retained resources are skipped
+func (c *CloudFormation) delete(st *stack, retain []*string) {
+	op := c.operation(st)
+	op.stack(cloudformation.StackStatusDeleteInProgress, userInitiated)
+
+	keep := make(map[string]bool)
+	for _, id := range retain {
+		keep[aws.StringValue(id)] = true
+	}
+
+	st.outputs = nil
+	if failed := c.remove(op, st.resources, sortedKeys(st.resources), keep, false); len(failed) > 0 {
+		op.stack(cloudformation.StackStatusDeleteFailed, fmt.Sprintf("The following resource(s) failed to delete: [%s]. ", strings.Join(failed, ", ")))
+		return
+	}
+	op.stack(cloudformation.StackStatusDeleteComplete, "")
+}
+
+// describe - returns the stack description
+func (st *stack) describe() *cloudformation.Stack {
+	status, reason := st.status()
+	out := &cloudformation.Stack{
+		StackId:                     aws.String(st.id),
+		StackName:                   aws.String(st.name),
+		StackStatus:                 aws.String(status),
+		CreationTime:                aws.Time(st.created),
+		LastUpdatedTime:             st.updated,
+		Parameters:                  st.parameters,
+		Outputs:                     st.outputs,
+		Tags:                        st.tags,
+		Capabilities:                st.capabilities,
+		NotificationARNs:            st.notifications,
+		DisableRollback:             aws.Bool(st.disableRollback),
+		EnableTerminationProtection: aws.Bool(st.protection),
+	}
+
+	if reason != "" {
+		out.StackStatusReason = aws.String(reason)
+	}
+
+	if st.parsed != nil && st.parsed.Description != "" {
+		out.Description = aws.String(st.parsed.Description)
+	}
+
+	if status == cloudformation.StackStatusDeleteComplete {
+		out.DeletionTime = st.events[len(st.events)-1].Timestamp
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+// Package fake provides in-memory implementations of the AWS services used
+// by qaz, for offline tests and mock runs. Only the operations called by qaz
+// are implemented, other operations panic.
+package fake
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/daidokoro/qaz/clients"
+)
+
+// Account - id of the account of all fake resources
+const Account = "123456789012"
+
+// Backend - in-memory AWS services sharing one region & account
+type Backend struct {
+	CloudFormation *CloudFormation
+	S3             *S3
+	Lambda         *Lambda
+	KMS            *KMS
+	STS            *STS
+}
+
+// New - returns an empty backend, region is used in stack ids & exports
+func New(region string) *Backend {
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	s3 := NewS3(region)
+	return &Backend{
+		CloudFormation: NewCloudFormation(region, s3),
+		S3:             s3,
+		Lambda:         &Lambda{},
+		KMS:            &KMS{},
+		STS:            &STS{},
+	}
+}
+
+// Clients - returns a client provider serving all clients from the backend,
+// for qaz.Options & stacks. Sessions & configs passed to it are ignored.
+func (b *Backend) Clients() clients.Provider {
+	return provider{b}
+}
+
+// provider - clients.Provider of a backend
+type provider struct {
+	b *Backend
+}
+
+// CloudFormation - returns the backend CloudFormation service
+func (p provider) CloudFormation(client.ConfigProvider, ...*aws.Config) cloudformationiface.CloudFormationAPI {
+	return p.b.CloudFormation
+}
+
+// S3 - returns the backend S3 service
+func (p provider) S3(client.ConfigProvider, ...*aws.Config) s3iface.S3API {
+	return p.b.S3
+}
+
+// Lambda - returns the backend Lambda service
+func (p provider) Lambda(client.ConfigProvider, ...*aws.Config) lambdaiface.LambdaAPI {
+	return p.b.Lambda
+}
+
+// KMS - returns the backend KMS service
+func (p provider) KMS(client.ConfigProvider, ...*aws.Config) kmsiface.KMSAPI {
+	return p.b.KMS
+}
+
+// STS - returns the backend STS service
+func (p provider) STS(client.ConfigProvider, ...*aws.Config) stsiface.STSAPI {
+	return p.b.STS
+}
+
+// requestError - returns an error as returned by the service for a failed request
+func requestError(status int, code, format string, a ...interface{}) error {
+	return awserr.NewRequestFailure(awserr.New(code, fmt.Sprintf(format, a...), nil), status, "")
+}
+
+// validationError - returns a CloudFormation ValidationError
+func validationError(format string, a ...interface{}) error {
+	return requestError(http.StatusBadRequest, "ValidationError", format, a...)
+}
+
+// notSupported - returns the error of operations not supported by the fake
+func notSupported(op string) error {
+	return requestError(http.StatusBadRequest, "NotSupported", "[%s] is not supported by the fake backend", op)
+}
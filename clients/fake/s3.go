@@ -0,0 +1,368 @@
+package fake
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// S3 - in-memory S3 object store, bucket settings are stored but not enforced
+type S3 struct {
+	s3iface.S3API
+
+	region   string
+	mu       sync.Mutex
+	buckets  map[string]map[string]object
+	settings map[string]*BucketSettings
+}
+
+// BucketSettings - settings of a fake bucket
+type BucketSettings struct {
+	Encryption        *s3.ServerSideEncryptionConfiguration
+	Versioning        string
+	PublicAccessBlock *s3.PublicAccessBlockConfiguration
+	Lifecycle         []*s3.LifecycleRule
+	Policy            string
+}
+
+type object struct {
+	body     []byte
+	modified time.Time
+}
+
+// NewS3 - returns an S3 backend without buckets
+func NewS3(region string) *S3 {
+	return &S3{
+		region:   region,
+		buckets:  make(map[string]map[string]object),
+		settings: make(map[string]*BucketSettings),
+	}
+}
+
+// Object - returns the body of an object, false if it does not exist
+func (s *S3) Object(bucket, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.buckets[bucket][key]
+	return o.body, ok
+}
+
+// objectURL - returns the body of the object at an https or s3 url
+func (s *S3) objectURL(u string) ([]byte, bool) {
+	src, err := url.Parse(u)
+	if err != nil {
+		return nil, false
+	}
+
+	b := src.Host
+	if src.Scheme != "s3" {
+		b = strings.SplitN(src.Host, ".s3", 2)[0]
+	}
+	return s.Object(b, strings.TrimPrefix(src.Path, "/"))
+}
+
+// bucket - returns the objects of a bucket, the lock must be held
+func (s *S3) bucket(name *string) (map[string]object, error) {
+	b, ok := s.buckets[aws.StringValue(name)]
+	if !ok {
+		return nil, requestError(http.StatusNotFound, s3.ErrCodeNoSuchBucket, "The specified bucket does not exist")
+	}
+	return b, nil
+}
+
+// Settings - returns a copy of the settings of a bucket, false if it does not exist
+func (s *S3) Settings(bucket string) (BucketSettings, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.settings[bucket]
+	if !ok {
+		return BucketSettings{}, false
+	}
+	return *b, true
+}
+
+// configure - calls fn with the settings of the bucket, returns
+// an error if the bucket does not exist
+func (s *S3) configure(name *string, fn func(*BucketSettings) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.bucket(name); err != nil {
+		return err
+	}
+	return fn(s.settings[aws.StringValue(name)])
+}
+
+// CreateBucket - creates an empty bucket
+func (s *S3) CreateBucket(in *s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := aws.StringValue(in.Bucket)
+	if _, ok := s.buckets[name]; ok {
+		return nil, requestError(http.StatusConflict, s3.ErrCodeBucketAlreadyOwnedByYou, "Your previous request to create the named bucket succeeded and you already own it.")
+	}
+
+	s.buckets[name] = make(map[string]object)
+	s.settings[name] = &BucketSettings{}
+	return &s3.CreateBucketOutput{Location: aws.String("/" + name)}, nil
+}
+
+// DeleteBucket - deletes an empty bucket
+func (s *S3) DeleteBucket(in *s3.DeleteBucketInput) (*s3.DeleteBucketOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.bucket(in.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) > 0 {
+		return nil, requestError(http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty")
+	}
+
+	delete(s.buckets, aws.StringValue(in.Bucket))
+	delete(s.settings, aws.StringValue(in.Bucket))
+	return &s3.DeleteBucketOutput{}, nil
+}
+
+// HeadBucket - returns a NotFound error if the bucket does not exist
+func (s *S3) HeadBucket(in *s3.HeadBucketInput) (*s3.HeadBucketOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[aws.StringValue(in.Bucket)]; !ok {
+		return nil, requestError(http.StatusNotFound, "NotFound", "Not Found")
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+// WaitUntilBucketExists - returns an error if the bucket does not exist
+func (s *S3) WaitUntilBucketExists(in *s3.HeadBucketInput) error {
+	_, err := s.HeadBucket(in)
+	return err
+}
+
+// PutBucketEncryption - stores the default encryption of the bucket
+func (s *S3) PutBucketEncryption(in *s3.PutBucketEncryptionInput) (*s3.PutBucketEncryptionOutput, error) {
+	return &s3.PutBucketEncryptionOutput{}, s.configure(in.Bucket, func(b *BucketSettings) error {
+		b.Encryption = in.ServerSideEncryptionConfiguration
+		return nil
+	})
+}
+
+// GetBucketEncryption - returns the default encryption of the bucket
+func (s *S3) GetBucketEncryption(in *s3.GetBucketEncryptionInput) (out *s3.GetBucketEncryptionOutput, err error) {
+	err = s.configure(in.Bucket, func(b *BucketSettings) error {
+		if b.Encryption == nil {
+			return requestError(http.StatusNotFound, "ServerSideEncryptionConfigurationNotFoundError", "The server side encryption configuration was not found")
+		}
+		out = &s3.GetBucketEncryptionOutput{ServerSideEncryptionConfiguration: b.Encryption}
+		return nil
+	})
+	return
+}
+
+// PutBucketVersioning - stores the versioning status of the bucket
+func (s *S3) PutBucketVersioning(in *s3.PutBucketVersioningInput) (*s3.PutBucketVersioningOutput, error) {
+	return &s3.PutBucketVersioningOutput{}, s.configure(in.Bucket, func(b *BucketSettings) error {
+		b.Versioning = aws.StringValue(in.VersioningConfiguration.Status)
+		return nil
+	})
+}
+
+// GetBucketVersioning - returns the versioning status of the bucket
+func (s *S3) GetBucketVersioning(in *s3.GetBucketVersioningInput) (out *s3.GetBucketVersioningOutput, err error) {
+	err = s.configure(in.Bucket, func(b *BucketSettings) error {
+		out = &s3.GetBucketVersioningOutput{}
+		if b.Versioning != "" {
+			out.Status = aws.String(b.Versioning)
+		}
+		return nil
+	})
+	return
+}
+
+// PutPublicAccessBlock - stores the public access block of the bucket
+func (s *S3) PutPublicAccessBlock(in *s3.PutPublicAccessBlockInput) (*s3.PutPublicAccessBlockOutput, error) {
+	return &s3.PutPublicAccessBlockOutput{}, s.configure(in.Bucket, func(b *BucketSettings) error {
+		b.PublicAccessBlock = in.PublicAccessBlockConfiguration
+		return nil
+	})
+}
+
+// PutBucketLifecycleConfiguration - replaces the lifecycle rules of the bucket
+func (s *S3) PutBucketLifecycleConfiguration(in *s3.PutBucketLifecycleConfigurationInput) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	return &s3.PutBucketLifecycleConfigurationOutput{}, s.configure(in.Bucket, func(b *BucketSettings) error {
+		b.Lifecycle = in.LifecycleConfiguration.Rules
+		return nil
+	})
+}
+
+// GetBucketLifecycleConfiguration - returns the lifecycle rules of the bucket
+func (s *S3) GetBucketLifecycleConfiguration(in *s3.GetBucketLifecycleConfigurationInput) (out *s3.GetBucketLifecycleConfigurationOutput, err error) {
+	err = s.configure(in.Bucket, func(b *BucketSettings) error {
+		if len(b.Lifecycle) == 0 {
+			return requestError(http.StatusNotFound, "NoSuchLifecycleConfiguration", "The lifecycle configuration does not exist")
+		}
+		out = &s3.GetBucketLifecycleConfigurationOutput{Rules: b.Lifecycle}
+		return nil
+	})
+	return
+}
+
+// PutBucketPolicy - replaces the policy of the bucket
+func (s *S3) PutBucketPolicy(in *s3.PutBucketPolicyInput) (*s3.PutBucketPolicyOutput, error) {
+	return &s3.PutBucketPolicyOutput{}, s.configure(in.Bucket, func(b *BucketSettings) error {
+		b.Policy = aws.StringValue(in.Policy)
+		return nil
+	})
+}
+
+// GetBucketPolicy - returns the policy of the bucket
+func (s *S3) GetBucketPolicy(in *s3.GetBucketPolicyInput) (out *s3.GetBucketPolicyOutput, err error) {
+	err = s.configure(in.Bucket, func(b *BucketSettings) error {
+		if b.Policy == "" {
+			return requestError(http.StatusNotFound, "NoSuchBucketPolicy", "The bucket policy does not exist")
+		}
+		out = &s3.GetBucketPolicyOutput{Policy: aws.String(b.Policy)}
+		return nil
+	})
+	return
+}
+
+// PutObject - stores the object body
+func (s *S3) PutObject(in *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	var body []byte
+	if in.Body != nil {
+		b, err := ioutil.ReadAll(in.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.bucket(in.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	b[aws.StringValue(in.Key)] = object{body: body, modified: time.Now()}
+	return &s3.PutObjectOutput{}, nil
+}
+
+// GetObject - returns the object body
+func (s *S3) GetObject(in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.bucket(in.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	o, ok := b[aws.StringValue(in.Key)]
+	if !ok {
+		return nil, requestError(http.StatusNotFound, s3.ErrCodeNoSuchKey, "The specified key does not exist.")
+	}
+
+	return &s3.GetObjectOutput{
+		Body:          ioutil.NopCloser(bytes.NewReader(o.body)),
+		ContentLength: aws.Int64(int64(len(o.body))),
+		LastModified:  aws.Time(o.modified),
+	}, nil
+}
+
+// GetObjectRequest - returns a request that can be presigned, the url
+// points at the real S3 endpoint
+func (s *S3) GetObjectRequest(in *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput) {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String(s.region),
+		Credentials: credentials.NewStaticCredentials("fake", "fake", ""),
+	}))
+	return s3.New(sess).GetObjectRequest(in)
+}
+
+// HeadObject - returns a NotFound error if the object does not exist
+func (s *S3) HeadObject(in *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.bucket(in.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	o, ok := b[aws.StringValue(in.Key)]
+	if !ok {
+		return nil, requestError(http.StatusNotFound, "NotFound", "Not Found")
+	}
+
+	return &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(o.body))),
+		LastModified:  aws.Time(o.modified),
+	}, nil
+}
+
+// ListObjectsV2Pages - lists the objects under the prefix in a single page
+func (s *S3) ListObjectsV2Pages(in *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	s.mu.Lock()
+	b, err := s.bucket(in.Bucket)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+
+	page := &s3.ListObjectsV2Output{Name: in.Bucket, Prefix: in.Prefix}
+	for k, o := range b {
+		if strings.HasPrefix(k, aws.StringValue(in.Prefix)) {
+			page.Contents = append(page.Contents, &s3.Object{
+				Key:          aws.String(k),
+				LastModified: aws.Time(o.modified),
+				Size:         aws.Int64(int64(len(o.body))),
+			})
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(page.Contents, func(i, j int) bool {
+		return aws.StringValue(page.Contents[i].Key) < aws.StringValue(page.Contents[j].Key)
+	})
+	page.KeyCount = aws.Int64(int64(len(page.Contents)))
+
+	fn(page, true)
+	return nil
+}
+
+// DeleteObjects - deletes the given keys, missing keys are ignored
+func (s *S3) DeleteObjects(in *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.bucket(in.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &s3.DeleteObjectsOutput{}
+	for _, o := range in.Delete.Objects {
+		delete(b, aws.StringValue(o.Key))
+		out.Deleted = append(out.Deleted, &s3.DeletedObject{Key: o.Key})
+	}
+	return out, nil
+}
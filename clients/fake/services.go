@@ -0,0 +1,89 @@
+package fake
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// Lambda - invokes Handler for every function, the payload is echoed if not set
+type Lambda struct {
+	lambdaiface.LambdaAPI
+
+	// Handler - returns the response payload of the named function
+	Handler func(name string, payload []byte) ([]byte, error)
+}
+
+// Invoke - calls the handler, asynchronous invocations return 202
+func (l *Lambda) Invoke(in *lambda.InvokeInput) (*lambda.InvokeOutput, error) {
+	if aws.StringValue(in.InvocationType) == lambda.InvocationTypeEvent {
+		return &lambda.InvokeOutput{StatusCode: aws.Int64(http.StatusAccepted)}, nil
+	}
+
+	payload := in.Payload
+	if l.Handler != nil {
+		resp, err := l.Handler(aws.StringValue(in.FunctionName), in.Payload)
+		if err != nil {
+			return &lambda.InvokeOutput{
+				StatusCode:    aws.Int64(http.StatusOK),
+				FunctionError: aws.String(err.Error()),
+			}, nil
+		}
+		payload = resp
+	}
+
+	return &lambda.InvokeOutput{
+		StatusCode: aws.Int64(http.StatusOK),
+		Payload:    payload,
+	}, nil
+}
+
+// KMS - reversible, unencrypted stand-in for KMS encryption
+type KMS struct {
+	kmsiface.KMSAPI
+}
+
+// kmsPrefix - prefix of fake cipher blobs
+const kmsPrefix = "fake-kms:"
+
+// Encrypt - returns the key id & plaintext as the cipher blob
+func (k *KMS) Encrypt(in *kms.EncryptInput) (*kms.EncryptOutput, error) {
+	blob := append([]byte(kmsPrefix+aws.StringValue(in.KeyId)+":"), in.Plaintext...)
+	return &kms.EncryptOutput{CiphertextBlob: blob, KeyId: in.KeyId}, nil
+}
+
+// Decrypt - returns the plaintext of blobs returned by Encrypt
+func (k *KMS) Decrypt(in *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	blob := in.CiphertextBlob
+	if !bytes.HasPrefix(blob, []byte(kmsPrefix)) {
+		return nil, requestError(http.StatusBadRequest, kms.ErrCodeInvalidCiphertextException, "")
+	}
+
+	parts := bytes.SplitN(blob[len(kmsPrefix):], []byte(":"), 2)
+	if len(parts) != 2 {
+		return nil, requestError(http.StatusBadRequest, kms.ErrCodeInvalidCiphertextException, "")
+	}
+	return &kms.DecryptOutput{KeyId: aws.String(string(parts[0])), Plaintext: parts[1]}, nil
+}
+
+// STS - returns a fixed caller identity in Account
+type STS struct {
+	stsiface.STSAPI
+}
+
+// GetCallerIdentity - returns the identity of a user in Account
+func (s *STS) GetCallerIdentity(*sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String(Account),
+		Arn:     aws.String(fmt.Sprintf("arn:aws:iam::%s:user/qaz", Account)),
+		UserId:  aws.String("AIDAFAKEQAZUSER"),
+	}, nil
+}
@@ -0,0 +1,257 @@
+package fake
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// template - the parts of a template the fake acts on, short form intrinsic
+// function tags are dropped by the yaml decoder & their values kept
+type template struct {
+	Description string `yaml:"Description"`
+	Parameters  map[string]struct {
+		Default     interface{} `yaml:"Default"`
+		Description string      `yaml:"Description"`
+		NoEcho      interface{} `yaml:"NoEcho"`
+	} `yaml:"Parameters"`
+	Resources map[string]interface{} `yaml:"Resources"`
+	Outputs   map[string]struct {
+		Description string      `yaml:"Description"`
+		Value       interface{} `yaml:"Value"`
+		Export      struct {
+			Name interface{} `yaml:"Name"`
+		} `yaml:"Export"`
+	} `yaml:"Outputs"`
+}
+
+// parseTemplate - parses a json or yaml template body
+func parseTemplate(body string) (*template, error) {
+	var t template
+	if err := yaml.Unmarshal([]byte(body), &t); err != nil {
+		return nil, validationError("Template format error: %v", err)
+	}
+
+	if len(t.Resources) == 0 {
+		return nil, validationError("Template format error: At least one Resources member must be defined.")
+	}
+	return &t, nil
+}
+
+// resourceType - returns the Type of a resource definition
+func (t *template) resourceType(logical string) string {
+	if def, ok := t.Resources[logical].(map[interface{}]interface{}); ok {
+		return fmt.Sprint(def["Type"])
+	}
+	return ""
+}
+
+// definition - returns the resource definition as yaml, used to detect changes
+func (t *template) definition(logical string) string {
+	b, _ := yaml.Marshal(t.Resources[logical])
+	return string(b)
+}
+
+// parameters - resolves the given parameters against the template, missing
+// parameters take their default or, if UsePreviousValue is set, previous value
+func (t *template) parameters(given, previous []*cloudformation.Parameter) ([]*cloudformation.Parameter, error) {
+	values := make(map[string]string)
+	for _, p := range given {
+		key := aws.StringValue(p.ParameterKey)
+		if _, ok := t.Parameters[key]; !ok {
+			return nil, validationError("Parameters: [%s] do not exist in the template", key)
+		}
+
+		if !aws.BoolValue(p.UsePreviousValue) {
+			values[key] = aws.StringValue(p.ParameterValue)
+			continue
+		}
+
+		for _, prev := range previous {
+			if aws.StringValue(prev.ParameterKey) == key {
+				values[key] = aws.StringValue(prev.ParameterValue)
+			}
+		}
+	}
+
+	var (
+		params  []*cloudformation.Parameter
+		missing []string
+	)
+
+	for _, key := range sortedKeys(t.Parameters) {
+		v, ok := values[key]
+		if !ok {
+			def := t.Parameters[key].Default
+			if def == nil {
+				missing = append(missing, key)
+				continue
+			}
+			v = fmt.Sprint(def)
+		}
+
+		params = append(params, &cloudformation.Parameter{
+			ParameterKey:   aws.String(key),
+			ParameterValue: aws.String(v),
+		})
+	}
+
+	if len(missing) > 0 {
+		return nil, validationError("Parameters: [%s] must have values", strings.Join(missing, ", "))
+	}
+	return params, nil
+}
+
+// change - a resource change of a stack operation
+type change struct {
+	action  string // cloudformation.ChangeAction*
+	logical string
+	typ     string
+}
+
+// diff - returns the resource changes from the current resources to the template,
+// resources are modified if their definition or a parameter they refer to changed
+func diff(current map[string]*resource, t *template, changedParams []string) []change {
+	var changes []change
+	for _, id := range sortedKeys(t.Resources) {
+		r, ok := current[id]
+		switch {
+		case !ok:
+			changes = append(changes, change{cloudformation.ChangeActionAdd, id, t.resourceType(id)})
+		case r.definition != t.definition(id) || refers(r.definition, changedParams):
+			changes = append(changes, change{cloudformation.ChangeActionModify, id, t.resourceType(id)})
+		}
+	}
+
+	for _, id := range sortedKeys(current) {
+		if _, ok := t.Resources[id]; !ok {
+			changes = append(changes, change{cloudformation.ChangeActionRemove, id, current[id].typ})
+		}
+	}
+	return changes
+}
+
+// refers - returns true if the definition contains any of the names
+func refers(def string, names []string) bool {
+	for _, n := range names {
+		if strings.Contains(def, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// changedParameters - returns the keys of parameters with a different value in b
+func changedParameters(a, b []*cloudformation.Parameter) []string {
+	prev := make(map[string]string)
+	for _, p := range a {
+		prev[aws.StringValue(p.ParameterKey)] = aws.StringValue(p.ParameterValue)
+	}
+
+	var changed []string
+	for _, p := range b {
+		if v, ok := prev[aws.StringValue(p.ParameterKey)]; !ok || v != aws.StringValue(p.ParameterValue) {
+			changed = append(changed, aws.StringValue(p.ParameterKey))
+		}
+	}
+	return changed
+}
+
+var subExpr = regexp.MustCompile(`\$\{([^}!][^}]*)\}`)
+
+// resolver - resolves the intrinsic functions of output values
+type resolver struct {
+	values    map[string]string // parameters & pseudo parameters
+	resources map[string]*resource
+	exports   map[string]string
+}
+
+// value - returns the string value of v
+func (r *resolver) value(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return r.ref(v)
+	case []interface{}:
+		var parts []string
+		for _, i := range v {
+			parts = append(parts, r.value(i))
+		}
+		return strings.Join(parts, ",")
+	case map[interface{}]interface{}:
+		for fn, arg := range v {
+			switch fn {
+			case "Ref":
+				return r.ref(fmt.Sprint(arg))
+			case "Fn::GetAtt":
+				if l, ok := arg.([]interface{}); ok && len(l) == 2 {
+					return r.ref(fmt.Sprintf("%v.%v", l[0], l[1]))
+				}
+				return r.ref(fmt.Sprint(arg))
+			case "Fn::Sub":
+				if l, ok := arg.([]interface{}); ok && len(l) > 0 {
+					arg = l[0]
+				}
+				return r.sub(fmt.Sprint(arg))
+			case "Fn::Join":
+				if l, ok := arg.([]interface{}); ok && len(l) == 2 {
+					if items, ok := l[1].([]interface{}); ok {
+						var parts []string
+						for _, i := range items {
+							parts = append(parts, r.value(i))
+						}
+						return strings.Join(parts, fmt.Sprint(l[0]))
+					}
+				}
+			case "Fn::ImportValue":
+				return r.exports[r.value(arg)]
+			}
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+// ref - resolves a reference to a resource, attribute or parameter, other
+// values are returned as is
+func (r *resolver) ref(name string) string {
+	if strings.Contains(name, "${") {
+		return r.sub(name)
+	}
+
+	if res, ok := r.resources[name]; ok {
+		return res.physical
+	}
+
+	if v, ok := r.values[name]; ok {
+		return v
+	}
+
+	if i := strings.Index(name, "."); i > 0 {
+		if res, ok := r.resources[name[:i]]; ok {
+			return fmt.Sprintf("%s.%s", res.physical, name[i+1:])
+		}
+	}
+	return name
+}
+
+// sub - substitutes ${} references in s
+func (r *resolver) sub(s string) string {
+	return subExpr.ReplaceAllStringFunc(s, func(m string) string {
+		return r.ref(subExpr.FindStringSubmatch(m)[1])
+	})
+}
+
+// sortedKeys - returns the keys of a string keyed map in order
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
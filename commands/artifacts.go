@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/daidokoro/qaz/log"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/daidokoro/qaz/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// artifacts command
+	artifactsCmd = &cobra.Command{
+		Use:   "artifacts",
+		Short: "Manage templates uploaded to stack buckets",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	// artifacts prune command
+	pruneCmd = &cobra.Command{
+		Use:   "prune [stacks]",
+		Short: "Deletes all but the newest uploaded templates of stacks, the deployed template is always kept",
+		Example: strings.Join([]string{
+			"qaz artifacts prune --keep 5",
+			"qaz artifacts prune vpc subnet --keep 2 --dry-run -c path/to/config",
+		}, "\n"),
+		PreRun: initialise,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			if run.keep < 0 {
+				utils.HandleError(fmt.Errorf("--keep must not be negative"))
+			}
+
+			stks, err := Configure(run.cfgSource, run.cfgRaw)
+			utils.HandleError(err)
+
+			utils.HandleError(actionStacks(stks, args))
+
+			var failed bool
+			stks.Range(func(_ string, s *stacks.Stack) bool {
+				// only stacks with buckets have uploads
+				if !s.Actioned || s.Bucket == "" {
+					return true
+				}
+
+				keys, err := s.PruneArtifacts(run.keep, run.dryRun)
+				if err != nil {
+					log.Error("failed to prune artifacts for [%s]: %v", s.Name, err)
+					failed = true
+					return true
+				}
+
+				verb := "deleted"
+				if run.dryRun {
+					verb = "would delete"
+				}
+
+				for _, k := range keys {
+					log.Info("%s: [s3://%s/%s]", verb, s.Bucket, k)
+				}
+				log.Info("[%s]: %s %d template(s)", s.Name, verb, len(keys))
+				return true
+			})
+
+			if failed {
+				utils.HandleError(fmt.Errorf("failed to prune artifacts for one or more stacks"))
+			}
+		},
+	}
+)
@@ -12,6 +12,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/daidokoro/qaz/clients"
 	"github.com/spf13/cobra"
 )
 
@@ -21,8 +22,8 @@ type awsLambda struct {
 	response string
 }
 
-func (a *awsLambda) Invoke(sess *session.Session) error {
-	svc := lambda.New(sess)
+func (a *awsLambda) Invoke(sess *session.Session, p clients.Provider) error {
+	svc := clients.Default(p).Lambda(sess)
 
 	params := &lambda.InvokeInput{
 		FunctionName: aws.String(a.name),
@@ -89,7 +90,7 @@ var invokeCmd = &cobra.Command{
 			}
 		}
 
-		if err := f.Invoke(sess); err != nil {
+		if err := f.Invoke(sess, mockClients()); err != nil {
 			if strings.Contains(err.Error(), "Unhandled") {
 				log.Error("Unhandled Exception: Potential Issue with Lambda Function Logic: %s\n", f.name)
 			}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/daidokoro/qaz/bucket"
+	"github.com/daidokoro/qaz/log"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/daidokoro/qaz/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// bootstrap command
+var bootstrapCmd = &cobra.Command{
+	Use:   "bootstrap [stacks]",
+	Short: "Creates & secures stack buckets: encryption, versioning, public access block and lifecycle rule",
+	Example: strings.Join([]string{
+		"qaz bootstrap",
+		"qaz bootstrap vpc subnet -c path/to/config",
+		"qaz bootstrap --bucket my-artifacts --region eu-west-1 --restrict-to-account",
+		"qaz bootstrap --bucket shared-artifacts --force",
+	}, "\n"),
+	PreRun: initialise,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// bootstrap a single bucket without config
+		if run.bucket != "" {
+			sess, err := GetSession()
+			utils.HandleError(err)
+
+			opts := bucket.DefaultOptions(aws.StringValue(sess.Config.Region))
+			opts.RestrictToAccount = run.restrictAccount
+			opts.Force = run.force
+
+			utils.HandleError(bucket.Bootstrap(run.bucket, opts, sess, mockClients()))
+			log.Info("bucket bootstrapped: [%s] - %s", run.bucket, opts.Region)
+			return
+		}
+
+		stks, err := Configure(run.cfgSource, run.cfgRaw)
+		utils.HandleError(err)
+
+		utils.HandleError(actionStacks(stks, args))
+
+		// stacks commonly share a bucket, bootstrap each bucket once
+		done := make(map[string]bool)
+		var failed bool
+		stks.Range(func(_ string, s *stacks.Stack) bool {
+			if !s.Actioned || s.Bucket == "" || done[s.Bucket] {
+				return true
+			}
+			done[s.Bucket] = true
+
+			if err := s.Bootstrap(run.force); err != nil {
+				log.Error("failed to bootstrap bucket [%s] for [%s]: %v", s.Bucket, s.Name, err)
+				failed = true
+				return true
+			}
+
+			log.Info("bucket bootstrapped: [%s]", s.Bucket)
+			return true
+		})
+
+		if failed {
+			utils.HandleError(fmt.Errorf("failed to bootstrap one or more buckets"))
+		}
+
+		if len(done) == 0 {
+			log.Warn("no stack buckets to bootstrap")
+		}
+	},
+}
@@ -62,7 +62,7 @@ var create = &cobra.Command{
 		err = stks.MustGet(s).GenTimeParser()
 		utils.HandleError(err)
 
-		err = stks.MustGet(s).Change("create", run.changeName)
+		err = stks.MustGet(s).Change(interruptContext(), "create", run.changeName)
 		utils.HandleError(err)
 
 		log.Info("change-set [%s] creation successful", run.changeName)
@@ -94,7 +94,7 @@ var rm = &cobra.Command{
 			utils.HandleError(fmt.Errorf("Stack not found: [%s]", run.stackName))
 		}
 
-		err = stks.MustGet(run.stackName).Change("rm", run.changeName)
+		err = stks.MustGet(run.stackName).Change(interruptContext(), "rm", run.changeName)
 		utils.HandleError(err)
 
 	},
@@ -118,7 +118,14 @@ var list = &cobra.Command{
 			utils.HandleError(fmt.Errorf("Stack not found: [%s]", run.stackName))
 		}
 
-		err = stks.MustGet(run.stackName).Change("list", run.changeName)
+		if structured() {
+			changes, err := stks.MustGet(run.stackName).ChangeSets(interruptContext())
+			utils.HandleError(err)
+			utils.HandleError(printStructured(changes))
+			return
+		}
+
+		err = stks.MustGet(run.stackName).Change(interruptContext(), "list", run.changeName)
 		utils.HandleError(err)
 	},
 }
@@ -151,7 +158,7 @@ var execute = &cobra.Command{
 			utils.HandleError(fmt.Errorf("Stack not found: [%s]", run.stackName))
 		}
 
-		err = stks.MustGet(run.stackName).Change("execute", run.changeName)
+		err = stks.MustGet(run.stackName).Change(interruptContext(), "execute", run.changeName)
 		utils.HandleError(err)
 
 		log.Info("change-set [%s] execution successful", run.changeName)
@@ -186,7 +193,14 @@ var desc = &cobra.Command{
 			utils.HandleError(fmt.Errorf("Stack not found: [%s]", run.stackName))
 		}
 
-		err = stks.MustGet(run.stackName).Change("desc", run.changeName)
+		if structured() {
+			change, err := stks.MustGet(run.stackName).DescribeChangeSet(interruptContext(), run.changeName)
+			utils.HandleError(err)
+			utils.HandleError(printStructured(change))
+			return
+		}
+
+		err = stks.MustGet(run.stackName).Change(interruptContext(), "desc", run.changeName)
 		utils.HandleError(err)
 	},
 }
@@ -10,7 +10,6 @@ import (
 
 	yaml "gopkg.in/yaml.v2"
 
-	"github.com/daidokoro/qaz/stacks"
 	"github.com/daidokoro/qaz/utils"
 
 	"github.com/CrowdSurge/banner"
@@ -20,14 +19,13 @@ import (
 
 var t sync.Map
 
-// initialise - adds, logging and repo vars to dependecny functions
+// initialise - adds logging and output settings to dependecny functions
 var initialise = func(cmd *cobra.Command, args []string) {
 	// add logging
 	log.SetDefault(log.NewDefaultLogger(run.debug, run.colors))
+	utils.HandleError(setOutput())
+	setMock()
 	log.Debug("initialising command [%s]", cmd.Name())
-
-	// add repo
-	stacks.Git(&gitrepo)
 }
 
 var (
@@ -160,6 +158,11 @@ var (
 				utils.HandleError(fmt.Errorf("Stack [%s] not found in config", s))
 			}
 
+			if structured() {
+				utils.HandleError(printStructured(stks.MustGet(s).StackValues()))
+				return
+			}
+
 			values := stks.MustGet(s).TemplateValues[s].(map[string]interface{})
 
 			log.Debug("Converting stack outputs to JSON from: %s", values)
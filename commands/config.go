@@ -1,109 +1,35 @@
 package commands
 
 import (
-	"fmt"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/daidokoro/qaz/log"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/daidokoro/qaz/qaz"
 	"github.com/daidokoro/qaz/stacks"
-	yaml "gopkg.in/yaml.v2"
-
-	"github.com/daidokoro/hcl"
 )
 
 // Configure parses the config file and string and returns a stacks.Map
-func Configure(confSource string, conf string) (stks stacks.Map, err error) {
-
-	// set config session
-	config.Session, err = GetSession()
+func Configure(confSource string, conf string) (*stacks.Map, error) {
+	endpoints, err := endpointFlags()
 	if err != nil {
-		return
-	}
-
-	if conf == "" {
-		// utilise FetchSource to get sources
-		if err = stacks.FetchSource(confSource, &config); err != nil {
-			return
-		}
-	} else {
-		config.String = conf
+		return nil, err
 	}
 
-	// execute config Functions
-	if err = config.CallFunctions(GenTimeFunctions); err != nil {
-		err = fmt.Errorf("failed to run template functions in config: %s", err)
-		return
-	}
-
-	log.Debug("checking Config for HCL format...")
-	if err = hcl.Unmarshal([]byte(config.String), &config); err != nil {
-		// fmt.Println(err)
-		log.Debug("failed to parse hcl... moving to JSON/YAML... error: %v", err)
-		if err = yaml.Unmarshal([]byte(config.String), &config); err != nil {
-			return
-		}
-	}
-
-	log.Debug("Config File Read: %s", config.Project)
-
-	// stacks = make(map[string]*stks.Stack)
-
-	// Get Stack Values
-	for s, v := range config.Stacks {
-		stks.Add(s, &stacks.Stack{
-			Name:             s,
-			Profile:          v.Profile,
-			Region:           v.Region,
-			DependsOn:        v.DependsOn,
-			Policy:           v.Policy,
-			Source:           v.Source,
-			Stackname:        v.Name,
-			Bucket:           v.Bucket,
-			Role:             v.Role,
-			DeployDelims:     &config.DeployDelimiter,
-			GenDelims:        &config.GenerateDelimiter,
-			TemplateValues:   config.Vars(),
-			GenTimeFunc:      &GenTimeFunctions,
-			DeployTimeFunc:   &DeployTimeFunctions,
-			Project:          &config.Project,
-			Timeout:          v.Timeout,
-			NotificationARNs: v.NotificationARNs,
-		})
-
-		stks.MustGet(s).SetStackName()
-
-		// set session
-		stks.MustGet(s).Session, err = GetSession(func(opts *session.Options) {
-			if stks.MustGet(s).Profile != "" {
-				opts.Profile = stks.MustGet(s).Profile
-			}
-
-			// use config region
-			if config.Region != "" {
-				opts.Config.Region = aws.String(config.Region)
-			}
-
-			// stack region trumps all other regions if-set
-			if stks.MustGet(s).Region != "" {
-				opts.Config.Region = aws.String(stks.MustGet(s).Region)
-			}
-
-			return
-		})
-
-		if err != nil {
-			return
-		}
-
-		// set parameters and tags, if any
-		config.
-			Parameters(stks.MustGet(s)).
-			Tags(stks.MustGet(s))
-
-		// update DeployTimeFunctions
-		stks.AddMapFuncs(DeployTimeFunctions)
+	p, err := qaz.Load(qaz.Options{
+		ConfigSource:    confSource,
+		Config:          conf,
+		Env:             run.env,
+		Profile:         run.profile,
+		Region:          run.region,
+		Endpoints:       endpoints,
+		DisableRollback: run.rollback,
+		TokenProvider:   stscreds.StdinTokenProvider,
+		Repo:            &gitrepo,
+		Lenient:         run.lenient,
+		Clients:         mockClients(),
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return
+	config = *p.Config()
+	return p.Stacks()
 }
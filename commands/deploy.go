@@ -22,7 +22,7 @@ var (
 	// deploy command
 	deployCmd = &cobra.Command{
 		Use:   "deploy",
-		Short: "Deploys stack(s) to AWS",
+		Short: "Deploys stack(s) to AWS, existing stacks are updated",
 		Example: strings.Join([]string{
 			"qaz deploy stack -c path/to/config",
 			"qaz deploy -c path/to/config -t stack::s3://bucket/key",
@@ -36,6 +36,9 @@ var (
 			stks, err := Configure(run.cfgSource, run.cfgRaw)
 			utils.HandleError(err)
 
+			// pre-flight config validation
+			utils.HandleError(config.Validate())
+
 			run.stacks = make(map[string]string)
 
 			// Add run.stacks based on [templates] Flags
@@ -79,7 +82,7 @@ var (
 			})
 
 			// Deploy Stacks
-			stacks.DeployHandler(&stks)
+			handleResults(stacks.DeployHandler(interruptContext(), stks, handlerOptions()))
 
 		},
 	}
@@ -101,12 +104,9 @@ var (
 			repo, err := repo.New(args[0], run.gituser, run.gitrsa)
 			utils.HandleError(err)
 
-			// Passing repo to the global var
+			// file sources are read from the repo
 			gitrepo = *repo
 
-			// add repo
-			stacks.Git(&gitrepo)
-
 			if out, ok := repo.Files[run.cfgSource]; ok {
 				repo.Config = out
 			}
@@ -119,6 +119,9 @@ var (
 			stks, err := Configure(run.cfgSource, repo.Config)
 			utils.HandleError(err)
 
+			// pre-flight config validation
+			utils.HandleError(config.Validate())
+
 			//create set actioned stacks
 			stks.Range(func(_ string, s *stacks.Stack) bool {
 				s.Actioned = true
@@ -127,15 +130,16 @@ var (
 			})
 
 			// Deploy Stacks
-			stacks.DeployHandler(&stks)
+			handleResults(stacks.DeployHandler(interruptContext(), stks, handlerOptions()))
 		},
 	}
 
 	// update command
 	updateCmd = &cobra.Command{
-		Use:   "update",
+		Use:   "update [stacks]",
 		Short: "Updates a given stack",
 		Example: strings.Join([]string{
+			"qaz update vpc subnet -c path/to/config",
 			"qaz update -c path/to/config -t stack::path/to/template",
 			"qaz update -c path/to/config -t stack::s3://bucket/key",
 			"qaz update -c path/to/config -t stack::http://someurl",
@@ -153,6 +157,27 @@ var (
 				return
 			}
 
+			// pre-flight config validation
+			utils.HandleError(config.Validate())
+
+			// multiple stacks are updated in dependency order
+			if len(args) > 1 && run.tplSource == "" {
+				if run.interactive {
+					utils.HandleError(fmt.Errorf("interactive update supports a single stack"))
+				}
+
+				for _, s := range args {
+					if _, ok := stks.Get(s); !ok {
+						utils.HandleError(fmt.Errorf("stacks [%s] not found in config", s))
+					}
+					stks.MustGet(s).Actioned = true
+					utils.HandleError(stks.MustGet(s).GenTimeParser())
+				}
+
+				handleResults(stacks.UpdateHandler(interruptContext(), stks, handlerOptions()))
+				return
+			}
+
 			switch {
 
 			case run.tplSource != "":
@@ -177,6 +202,7 @@ var (
 
 			utils.HandleError(stks.MustGet(s).GenTimeParser())
 
+			ctx := interruptContext()
 			if run.interactive {
 				// random change-set name
 				run.changeName = fmt.Sprintf(
@@ -185,13 +211,13 @@ var (
 					strconv.Itoa((rand.Int())),
 				)
 
-				if err := stks.MustGet(s).Change("create", run.changeName); err != nil {
+				if err := stks.MustGet(s).Change(ctx, "create", run.changeName); err != nil {
 					log.Error(err.Error())
 					return
 				}
 
 				// describe change-set
-				if err := stks.MustGet(s).Change("desc", run.changeName); err != nil {
+				if err := stks.MustGet(s).Change(ctx, "desc", run.changeName); err != nil {
 					log.Error(err.Error())
 					return
 				}
@@ -208,14 +234,14 @@ var (
 					resp := scanner.Text()
 					switch strings.ToLower(resp) {
 					case "y":
-						if err := stks.MustGet(s).Change("execute", run.changeName); err != nil {
+						if err := stks.MustGet(s).Change(ctx, "execute", run.changeName); err != nil {
 							log.Error(err.Error())
 							return
 						}
 						log.Info("update completed successfully...")
 						return
 					case "n":
-						if err := stks.MustGet(s).Change("rm", run.changeName); err != nil {
+						if err := stks.MustGet(s).Change(ctx, "rm", run.changeName); err != nil {
 							log.Error(err.Error())
 							return
 						}
@@ -228,7 +254,18 @@ var (
 
 			} else {
 				// non-interactive mode
-				utils.HandleError(stks.MustGet(s).Update())
+				err := stks.MustGet(s).Update(ctx)
+				if err != nil && ctx.Err() != nil && run.cancelOnInterrupt {
+					if cerr := stks.MustGet(s).CancelUpdate(); cerr != nil {
+						log.Error("failed to cancel update for stack [%s]: %v", s, cerr)
+					}
+				}
+
+				if err == stacks.ErrNoUpdates {
+					log.Info("no updates to be performed: [%s]", s)
+					return
+				}
+				utils.HandleError(err)
 			}
 
 		},
@@ -249,6 +286,9 @@ var (
 			stks, err := Configure(run.cfgSource, "")
 			utils.HandleError(err)
 
+			// pre-flight config validation
+			utils.HandleError(config.Validate())
+
 			// select actioned stacks
 			for _, s := range args {
 				if _, ok := stks.Get(s); !ok {
@@ -266,7 +306,7 @@ var (
 			}
 
 			// Terminate Stacks
-			stacks.TerminateHandler(&stks)
+			handleResults(stacks.TerminateHandler(interruptContext(), stks, handlerOptions()))
 		},
 	}
 )
@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/daidokoro/qaz/log"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/daidokoro/qaz/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// exit code returned by drift when drift is detected
+const exitDriftDetected = 2
+
+var driftCmd = &cobra.Command{
+	Use:   "drift [stacks]",
+	Short: "Detects drift on deployed stacks, exits with code 2 if drift is found",
+	Example: strings.Join([]string{
+		"qaz drift",
+		"qaz drift vpc subnet --json",
+	}, "\n"),
+	PreRun: func(cmd *cobra.Command, args []string) {
+		// --json is kept as shorthand for --output json
+		if run.driftJSON {
+			run.output = outputJSON
+		}
+		initialise(cmd, args)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+
+		stks, err := Configure(run.cfgSource, run.cfgRaw)
+		utils.HandleError(err)
+
+		utils.HandleError(actionStacks(stks, args))
+
+		drifts, err := stacks.DriftHandler(interruptContext(), stks)
+		drifted, perr := printDrift(drifts)
+		utils.HandleError(perr)
+		utils.HandleError(err)
+
+		if drifted {
+			os.Exit(exitDriftDetected)
+		}
+	},
+}
+
+// actionStacks - sets the given stacks as actioned, all stacks are actioned if none are given
+func actionStacks(stks *stacks.Map, names []string) error {
+	for _, s := range names {
+		if _, ok := stks.Get(s); !ok {
+			return fmt.Errorf("stacks [%s] not found in config", s)
+		}
+	}
+
+	stks.Range(func(k string, s *stacks.Stack) bool {
+		s.Actioned = len(names) == 0 || utils.StringIn(k, names)
+		return true
+	})
+	return nil
+}
+
+// printDrift - prints drift results in the selected output format, returns true if any stack drifted
+func printDrift(drifts []*stacks.Drift) (bool, error) {
+	var drifted bool
+	for _, d := range drifts {
+		if d.Drifted() {
+			drifted = true
+		}
+	}
+
+	if structured() {
+		return drifted, printStructured(drifts)
+	}
+
+	fmt.Println("--")
+	for _, d := range drifts {
+		d.Print(os.Stdout)
+	}
+
+	if drifted {
+		log.Warn("drift detected")
+	}
+	return drifted, nil
+}
@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/daidokoro/qaz/log"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/daidokoro/qaz/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var eventsCmd = &cobra.Command{
+	Use:   "events [stack]",
+	Short: "Prints stack events, including events of nested stacks, in chronological order",
+	Example: strings.Join([]string{
+		"qaz events vpc --since 1h",
+		"qaz events vpc --follow",
+		"qaz events vpc --since 2020-01-01T00:00:00Z -o json",
+	}, "\n"),
+	PreRun: initialise,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if len(args) != 1 {
+			utils.HandleError(fmt.Errorf("please specify a stack, For details try --> qaz events --help"))
+		}
+
+		since, err := parseSince(run.since, time.Now())
+		utils.HandleError(err)
+
+		stks, err := Configure(run.cfgSource, run.cfgRaw)
+		utils.HandleError(err)
+
+		s, ok := stks.Get(args[0])
+		if !ok {
+			utils.HandleError(fmt.Errorf("stack [%s] not found in config", args[0]))
+		}
+
+		e := s.EventStreamer(since)
+		e.Emit = printEvent
+
+		if run.follow {
+			utils.HandleError(e.Stream(interruptContext()))
+			return
+		}
+
+		utils.HandleError(e.Poll(interruptContext()))
+	},
+}
+
+// printEvent - prints an event in the selected output format
+func printEvent(e stacks.Event) {
+	if structured() {
+		if run.output == outputYAML {
+			fmt.Println("---")
+		}
+		utils.HandleError(printStructured(e))
+		return
+	}
+
+	reason := e.Reason
+	if e.Failed() {
+		reason = log.ColorString(reason, log.RED)
+	}
+
+	fmt.Printf(
+		"%s%s - %s - %s - %s - %s %s\n",
+		log.ColorString("@", log.MAGENTA),
+		e.Timestamp.Local().Format(time.RFC850),
+		e.Stackname,
+		log.ColorMap(e.Status),
+		e.Type,
+		e.LogicalID,
+		reason,
+	)
+}
+
+// parseSince - parses a duration relative to now or an RFC3339 timestamp,
+// the zero time is returned if since is empty
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(since); err == nil {
+		return now.Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return t, fmt.Errorf("invalid --since [%s], must be a duration, e.g. 1h, or an RFC3339 timestamp", since)
+	}
+	return t, nil
+}
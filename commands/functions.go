@@ -3,248 +3,15 @@ package commands
 import (
 	"bytes"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"regexp"
 	"strings"
 	"text/template"
 
-	"github.com/daidokoro/qaz/bucket"
+	"github.com/daidokoro/qaz/log"
 	"github.com/daidokoro/qaz/utils"
 	"github.com/spf13/cobra"
-
-	"encoding/base64"
-	"encoding/json"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/kms"
-	"github.com/daidokoro/qaz/log"
-)
-
-// Common Functions - Both Deploy/Gen
-var (
-	kmsEncrypt = func(kid string, text string) string {
-		log.Debug("running template function: [kms_encrypt]")
-		sess, err := GetSession()
-		utils.HandleError(err)
-
-		svc := kms.New(sess)
-
-		params := &kms.EncryptInput{
-			KeyId:     aws.String(kid),
-			Plaintext: []byte(text),
-		}
-
-		resp, err := svc.Encrypt(params)
-		utils.HandleError(err)
-
-		return base64.StdEncoding.EncodeToString(resp.CiphertextBlob)
-	}
-
-	kmsDecrypt = func(cipher string) string {
-		log.Debug("running template function: [kms_decrypt]")
-		sess, err := GetSession()
-		utils.HandleError(err)
-
-		svc := kms.New(sess)
-
-		ciph, err := base64.StdEncoding.DecodeString(cipher)
-		utils.HandleError(err)
-
-		params := &kms.DecryptInput{
-			CiphertextBlob: []byte(ciph),
-		}
-
-		resp, err := svc.Decrypt(params)
-		utils.HandleError(err)
-
-		return string(resp.Plaintext)
-	}
-
-	httpGet = func(url string) interface{} {
-		log.Debug("Calling Template Function [GET] with arguments: %s", url)
-		resp, err := utils.Get(url)
-		utils.HandleError(err)
-
-		return resp
-	}
-
-	s3Read = func(url string, profile ...string) string {
-		log.Debug("Calling Template Function [S3Read] with arguments: %s", url)
-
-		sess, err := GetSession(func(opts *session.Options) {
-			if len(profile) < 1 {
-				log.Warn("No Profile specified for S3read, using: %s", run.profile)
-				return
-			}
-			opts.Profile = profile[0]
-			return
-		})
-
-		utils.HandleError(err)
-
-		resp, err := bucket.S3Read(url, sess)
-		utils.HandleError(err)
-
-		return resp
-	}
-
-	lambdaInvoke = func(name string, payload string) interface{} {
-		log.Debug("running template function: [invoke]")
-		f := awsLambda{name: name}
-		var m interface{}
-
-		if payload != "" {
-			f.payload = []byte(payload)
-		}
-
-		sess, err := GetSession()
-		utils.HandleError(err)
-
-		err = f.Invoke(sess)
-		utils.HandleError(err)
-
-		log.Debug("Lambda response: %s", f.response)
-
-		// parse json if possible
-		if err := json.Unmarshal([]byte(f.response), &m); err != nil {
-			log.Debug(err.Error())
-			return f.response
-		}
-
-		return m
-	}
-
-	prefix = func(s string, pre string) bool {
-		return strings.HasPrefix(s, pre)
-	}
-
-	suffix = func(s string, suf string) bool {
-		return strings.HasSuffix(s, suf)
-	}
-
-	contains = func(s string, con string) bool {
-		return strings.Contains(s, con)
-	}
-
-	loop = func(n int) []struct{} {
-		return make([]struct{}, n)
-	}
-
-	literal = func(str string) string {
-		return fmt.Sprintf("%#v", str)
-	}
-
-	// gentime function maps
-	GenTimeFunctions = template.FuncMap{
-		// simple additon function useful for counters in loops
-		"add": func(a int, b int) int {
-			log.Debug("Calling Template Function [add] with arguments: %s + %s", a, b)
-			return a + b
-		},
-
-		// strip function for removing characters from text
-		"strip": func(s string, rmv string) string {
-			log.Debug("Calling Template Function [strip] with arguments: (%s, %s) ", s, rmv)
-			return strings.Replace(s, rmv, "", -1)
-		},
-
-		// cat function for reading text from a given file under the files folder
-		"cat": func(path string) string {
-			log.Debug("Calling Template Function [cat] with arguments: %s", path)
-			b, err := ioutil.ReadFile(path)
-			utils.HandleError(err)
-			return string(b)
-		},
-
-		// literal - return raw/literal string with special chars and all
-		"literal": literal,
-
-		// suffix - returns true if string starts with given suffix
-		"suffix": suffix,
-
-		// prefix - returns true if string starts with given prefix
-		"prefix": prefix,
-
-		// contains - returns true if string contains
-		"contains": contains,
-
-		// loop - useful to range over an int (rather than a slice, map, or channel). see examples/loop
-		"loop": loop,
-
-		// Get get does an HTTP Get request of the given url and returns the output string
-		"GET": httpGet,
-
-		// S3Read reads content of file from s3 and returns string contents
-		"s3_read": s3Read,
-
-		// invoke - invokes a lambda function and returns a raw string/interface{}
-		"invoke": lambdaInvoke,
-
-		// kms-encrypt - Encrypts PlainText using KMS key
-		"kms_encrypt": kmsEncrypt,
-
-		// kms-decrypt - Descrypts CipherText
-		"kms_decrypt": kmsDecrypt,
-
-		// mod - returns remainder after division (modulus)
-		"mod": func(a int, b int) int {
-			log.Debug("Calling Template Function [mod] with arguments: %s % %s", a, b)
-			return a % b
-		},
-
-		// seq - returns a sequence of numbers
-		"seq": func(from, to int) []int {
-			log.Debug("Calling Template Function [seq] with arguments: %s % %s", from, to)
-			seq := make([]int, to-from+1)
-			for i := range seq {
-				seq[i] = from + i
-			}
-			return seq
-		},
-
-		// capitalize first letter
-		"title": func(s string) string {
-			log.Debug("Calling Template Function [title] with arguments: %s", s)
-			return strings.Title(s)
-		},
-	}
-
-	// deploytime function maps
-	DeployTimeFunctions = template.FuncMap{
-
-		// suffix - returns true if string starts with given suffix
-		"suffix": suffix,
-
-		// prefix - returns true if string starts with given prefix
-		"prefix": prefix,
-
-		// contains - returns true if string contains
-		"contains": contains,
-
-		// loop - useful to range over an int (rather than a slice, map, or channel). see examples/loop
-		"loop": loop,
-
-		// literal - return raw/literal string with special chars and all
-		"literal": literal,
-
-		// Get get does an HTTP Get request of the given url and returns the output string
-		"GET": httpGet,
-
-		// S3Read reads content of file from s3 and returns string contents
-		"s3_read": s3Read,
-
-		// invoke - invokes a lambda function and returns a raw string/interface{}
-		"invoke": lambdaInvoke,
-
-		// kms-encrypt - Encrypts PlainText using KMS key
-		"kms_encrypt": kmsEncrypt,
-
-		// kms-decrypt - Descrypts CipherText
-		"kms_decrypt": kmsDecrypt,
-	}
 )
 
 var templateFunctionDoc = `
@@ -270,6 +37,9 @@ Qaz has two levels of custom template functions, these are Gen-Time functions an
    
    Deploy-Time functions are delimted by << >>
 
+Templates are rendered strictly, referencing a key that is missing from the config values or a function returning an error fails the render with the template name, line and column of the error.
+Use the index function for optional keys, i.e index .stack "optional", or the --lenient flag to render missing keys as <no value>.
+
 --
 
 {{- range $_, $f := . }}
@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/daidokoro/qaz/log"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/daidokoro/qaz/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Renders the project dependency graph as DOT, Mermaid or ASCII",
+	Example: strings.Join([]string{
+		"",
+		"qaz graph",
+		"qaz graph --format dot | dot -Tpng > graph.png",
+		"qaz graph --format mermaid --status",
+	}, "\n"),
+	PreRun: initialise,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		stks, err := Configure(run.cfgSource, run.cfgRaw)
+		utils.HandleError(err)
+
+		g, err := stacks.NewGraph(stks)
+		utils.HandleError(err)
+
+		// annotate graph with live stack status
+		status := make(map[string]string)
+		if run.graphStatus {
+			var mu sync.Mutex
+			var wg sync.WaitGroup
+			stks.Range(func(k string, s *stacks.Stack) bool {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					stat, err := s.StackStatus()
+					if err != nil {
+						if !strings.Contains(err.Error(), "does not exist") {
+							log.Error("failed to fetch status for [%s]: %v", s.Stackname, err)
+							return
+						}
+						stat = "NOT_DEPLOYED"
+					}
+					mu.Lock()
+					status[k] = stat
+					mu.Unlock()
+				}()
+				return true
+			})
+			wg.Wait()
+		}
+
+		switch strings.ToLower(run.graphFormat) {
+		case "dot":
+			fmt.Print(g.DOT(config.Project, status))
+		case "mermaid":
+			fmt.Print(g.Mermaid(status))
+		case "ascii":
+			fmt.Print(g.ASCII(status))
+		default:
+			utils.HandleError(fmt.Errorf("unsupported graph format [%s], use one of: dot, mermaid, ascii", run.graphFormat))
+		}
+	},
+}
@@ -1,12 +1,28 @@
 package commands
 
-import "os"
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/daidokoro/qaz/log"
+	"github.com/daidokoro/qaz/stacks"
+)
 
 const (
 	defaultconfigA = "config.yml"
 	defaultconfigB = "config.yaml"
 )
 
+// exit codes for multi-stack operations
+const (
+	exitPartialFailure = 2
+	exitTotalFailure   = 3
+	exitInterrupted    = 130
+)
+
 // DefaultConfig - sets config based on ENV variable or default config.yml
 func defaultConfig() string {
 	if env := os.Getenv(configENV); env != "" {
@@ -20,3 +36,73 @@ func defaultConfig() string {
 	return defaultconfigA
 
 }
+
+// handlerOptions - returns multi-stack handler options based on run flags
+func handlerOptions() stacks.HandlerOptions {
+	return stacks.HandlerOptions{
+		Parallel:          run.parallel,
+		FailFast:          run.failFast,
+		CancelOnInterrupt: run.cancelOnInterrupt,
+	}
+}
+
+// interruptContext - returns a context that is cancelled on SIGINT or SIGTERM,
+// a second signal exits immediately
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		s := <-sig
+		log.Warn("received [%s], stopping... signal again to exit immediately", s)
+		cancel()
+
+		<-sig
+		log.Error("exiting immediately, stacks may still be in progress in cloudformation")
+		os.Exit(exitInterrupted)
+	}()
+
+	return ctx
+}
+
+// printResults - prints the handler summary table and logs handler errors
+func printResults(results stacks.Results, err error) {
+	if e, ok := err.(*stacks.HandlerError); ok && results == nil {
+		results = e.Results
+	}
+
+	if structured() {
+		if results == nil {
+			results = stacks.Results{}
+		}
+		if perr := printStructured(results); perr != nil {
+			log.Error(perr.Error())
+		}
+	} else if len(results) > 0 {
+		fmt.Println("--")
+		results.Table(os.Stdout)
+	}
+
+	if err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// handleResults - prints the handler summary table and exits with
+// a non-zero code if any stack failed, partial and total failures
+// have distinct exit codes
+func handleResults(results stacks.Results, err error) {
+	printResults(results, err)
+	if err == nil {
+		return
+	}
+
+	if e, ok := err.(*stacks.HandlerError); ok {
+		if e.Partial() {
+			os.Exit(exitPartialFailure)
+		}
+		os.Exit(exitTotalFailure)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/daidokoro/qaz/log"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/daidokoro/qaz/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import [stack]",
+	Short: "Imports existing resources into a stack using an IMPORT change-set",
+	Example: strings.Join([]string{
+		"qaz import vpc --resources path/to/resources.yml",
+		"qaz import vpc --resources resources.json --change-name vpc-import -c path/to/config",
+		"qaz import vpc --resources resources.yml --dry-run",
+		"qaz import vpc --resources resources.yml --yes",
+	}, "\n"),
+	PreRun: initialise,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if len(args) != 1 {
+			utils.HandleError(fmt.Errorf("please specify a stack to import resources into"))
+		}
+
+		if run.importFile == "" {
+			utils.HandleError(fmt.Errorf("please specify a resources-to-import mapping using --resources"))
+		}
+
+		b, err := ioutil.ReadFile(run.importFile)
+		utils.HandleError(err)
+
+		mapping, err := stacks.LoadImportMapping(b)
+		utils.HandleError(err)
+
+		stks, err := Configure(run.cfgSource, run.cfgRaw)
+		utils.HandleError(err)
+
+		s, ok := stks.Get(args[0])
+		if !ok {
+			utils.HandleError(fmt.Errorf("stacks [%s] not found in config", args[0]))
+		}
+
+		utils.HandleError(s.GenTimeParser())
+		s.Imports = mapping
+
+		if run.changeName == "" {
+			run.changeName = fmt.Sprintf("qaz-import-%d", time.Now().Unix())
+		}
+
+		ctx := interruptContext()
+		changes, err := s.ImportPlan(ctx, run.changeName)
+		utils.HandleError(err)
+
+		// unexecuted change-sets are removed, the plan is shown again on the next run
+		switch {
+		case run.dryRun:
+			log.Info("dry run: %d resources would be imported into [%s]", len(changes), s.Stackname)
+			utils.HandleError(s.Change(ctx, "rm", run.changeName))
+			return
+		case !run.yes && strings.ToLower(utils.GetInput(fmt.Sprintf("import %d resources into [%s]?", len(changes), s.Stackname), "N")) != "y":
+			log.Info("import cancelled")
+			utils.HandleError(s.Change(ctx, "rm", run.changeName))
+			return
+		}
+
+		utils.HandleError(s.ExecuteImport(ctx, run.changeName))
+	},
+}
@@ -43,6 +43,13 @@ func init() {
 	RootCmd.PersistentFlags().StringVarP(&run.profile, "profile", "p", "default", "configured aws profile")
 	RootCmd.PersistentFlags().StringVarP(&run.region, "region", "r", "", "configured aws region: if blank, the region is acquired via the profile")
 	RootCmd.PersistentFlags().BoolVarP(&run.debug, "debug", "", false, "Run in debug mode...")
+	RootCmd.PersistentFlags().StringVarP(&run.env, "env", "", os.Getenv(envENV), "environment overrides to apply to config, i.e config.<env>.yml")
+	RootCmd.PersistentFlags().StringVarP(&run.output, "output", "o", outputTable, "output format of command results: table, json or yaml")
+	RootCmd.PersistentFlags().BoolVarP(&run.mock, "mock", "", false, "dry-run against an in-memory AWS backend, nothing is deployed")
+	RootCmd.PersistentFlags().StringSliceVarP(&run.endpoints, "endpoint", "", []string{}, "custom AWS endpoint as service=url, or url for all services, i.e cloudformation=http://localhost:4566")
+	RootCmd.PersistentFlags().BoolVarP(&run.s3PathStyle, "s3-path-style", "", false, "use path-style S3 urls, required by most S3 compatible endpoints")
+	RootCmd.PersistentFlags().StringVarP(&run.caBundle, "ca-bundle", "", "", "path of a PEM bundle of certificate authorities trusted by AWS sessions")
+	RootCmd.PersistentFlags().BoolVarP(&run.lenient, "lenient", "", false, "render missing template keys as <no value> instead of failing")
 
 	// Define Lambda Invoke Flags
 	invokeCmd.Flags().StringVarP(&run.funcEvent, "event", "e", "", "JSON Event data for AWS Lambda invoke")
@@ -58,6 +65,68 @@ func init() {
 	// Define Update Command
 	updateCmd.Flags().BoolVarP(&run.interactive, "interactive", "i", false, "preview change-set and ask before executing it")
 
+	// Add --parallel & --fail-fast flags to multi-stack commands
+	for _, cmd := range []*cobra.Command{
+		deployCmd,
+		gitDeployCmd,
+		terminateCmd,
+		updateCmd,
+		shellCmd,
+		planCmd,
+		applyCmd,
+	} {
+		cmd.Flags().IntVarP(&run.parallel, "parallel", "", 0, "max number of stacks actioned concurrently, 0 for no limit")
+		cmd.Flags().BoolVarP(&run.failFast, "fail-fast", "", false, "stop starting new stacks after the first failure")
+	}
+
+	// Define Graph Flags
+	graphCmd.Flags().StringVarP(&run.graphFormat, "format", "f", "ascii", "graph output format: dot, mermaid or ascii")
+	graphCmd.Flags().BoolVarP(&run.graphStatus, "status", "s", false, "annotate graph with live stack status")
+
+	// Add --cancel-on-interrupt flag to commands that update stacks
+	for _, cmd := range []*cobra.Command{
+		deployCmd,
+		gitDeployCmd,
+		updateCmd,
+		applyCmd,
+	} {
+		cmd.Flags().BoolVarP(&run.cancelOnInterrupt, "cancel-on-interrupt", "", false, "cancel in-progress stack updates on interrupt, stacks are rolled back")
+	}
+
+	// Define Drift Flags
+	driftCmd.Flags().BoolVarP(&run.driftJSON, "json", "j", false, "print drift results as JSON, same as --output json")
+
+	// Define Recover Flags
+	recoverCmd.Flags().StringSliceVarP(&run.skip, "skip", "", nil, "resources to skip when continuing an update rollback")
+	recoverCmd.Flags().StringSliceVarP(&run.retain, "retain", "", nil, "resources to retain when retrying a failed delete")
+	recoverCmd.Flags().BoolVarP(&run.interactive, "interactive", "i", false, "list failed resources and prompt for resources to skip or retain")
+
+	// Define Import Flags
+	importCmd.Flags().StringVarP(&run.importFile, "resources", "", "", "path to resources-to-import mapping, logical ID to resource identifier (Required)")
+	importCmd.Flags().StringVarP(&run.changeName, "change-name", "", "", "name of the IMPORT change-set, defaults to qaz-import-<timestamp>")
+	importCmd.Flags().BoolVarP(&run.dryRun, "dry-run", "", false, "show the resources to import without importing them")
+	importCmd.Flags().BoolVarP(&run.yes, "yes", "y", false, "import without prompting for confirmation")
+
+	// Define Artifacts Flags
+	pruneCmd.Flags().IntVarP(&run.keep, "keep", "", 5, "number of most recent templates to keep per stack")
+	pruneCmd.Flags().BoolVarP(&run.dryRun, "dry-run", "", false, "list templates to delete without deleting them")
+	artifactsCmd.AddCommand(pruneCmd)
+
+	// Define Bootstrap Flags
+	bootstrapCmd.Flags().StringVarP(&run.bucket, "bucket", "", "", "bootstrap the named bucket instead of the buckets in config")
+	bootstrapCmd.Flags().BoolVarP(&run.restrictAccount, "restrict-to-account", "", false, "add a bucket policy denying access outside the deploying account, used with --bucket")
+	bootstrapCmd.Flags().BoolVarP(&run.force, "force", "", false, "replace the settings, lifecycle rules & policy of existing buckets and enable versioning")
+
+	// Define Events Flags
+	eventsCmd.Flags().StringVarP(&run.since, "since", "", "", "only print events since a duration ago, e.g. 1h, or an RFC3339 timestamp")
+	eventsCmd.Flags().BoolVarP(&run.follow, "follow", "f", false, "keep printing new events until interrupted")
+
+	// Define Plan & Apply Flags
+	planCmd.Flags().BoolVarP(&run.all, "all", "A", false, "plan all stacks")
+	for _, cmd := range []*cobra.Command{planCmd, applyCmd} {
+		cmd.Flags().StringVarP(&run.planFile, "plan-file", "", defaultPlanFile, "path to plan file")
+	}
+
 	// Add Config --config common flag
 	for _, cmd := range []interface{}{
 		checkCmd,
@@ -75,6 +144,17 @@ func init() {
 		protectCmd,
 		lintCmd,
 		parametersCmd,
+		validateConfigCmd,
+		graphCmd,
+		planCmd,
+		applyCmd,
+		driftCmd,
+		recoverCmd,
+		importCmd,
+		packageCmd,
+		pruneCmd,
+		bootstrapCmd,
+		eventsCmd,
 	} {
 		cmd.(*cobra.Command).Flags().StringVarP(&run.cfgSource, "config", "c", defaultConfig(), "path to config file")
 	}
@@ -85,6 +165,7 @@ func init() {
 		updateCmd,
 		checkCmd,
 		lintCmd,
+		packageCmd,
 	} {
 		cmd.(*cobra.Command).Flags().StringVarP(&run.tplSource, "template", "t", "", "path to template source Or stack::source")
 	}
@@ -126,6 +207,17 @@ func init() {
 		completionCmd,
 		lintCmd,
 		parametersCmd,
+		validateConfigCmd,
+		graphCmd,
+		planCmd,
+		applyCmd,
+		driftCmd,
+		recoverCmd,
+		importCmd,
+		packageCmd,
+		artifactsCmd,
+		bootstrapCmd,
+		eventsCmd,
 	)
 
 }
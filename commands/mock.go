@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"sync"
+	"time"
+
+	"github.com/daidokoro/qaz/clients"
+	"github.com/daidokoro/qaz/clients/fake"
+	"github.com/daidokoro/qaz/log"
+)
+
+// time between the events of mocked stack operations
+const mockStep = time.Millisecond * 200
+
+var (
+	// the mock backend is created once, shell commands share its stacks
+	mockOnce    sync.Once
+	mockBackend *fake.Backend
+)
+
+// setMock - creates the in-memory backend serving all AWS calls if --mock is set
+func setMock() {
+	if !run.mock {
+		return
+	}
+
+	mockOnce.Do(func() {
+		mockBackend = fake.New(run.region)
+		mockBackend.CloudFormation.Step = mockStep
+		log.Warn("mock mode: AWS calls are served by an in-memory backend, nothing is deployed")
+	})
+}
+
+// mockClients - returns the client provider of the mock backend, nil if
+// --mock is not set so that the AWS SDK clients are used
+func mockClients() clients.Provider {
+	if mockBackend == nil {
+		return nil
+	}
+	return mockBackend.Clients()
+}
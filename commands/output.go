@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/daidokoro/qaz/log"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// output formats of read commands
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// setOutput - validates the output format, logs are written to stderr
+// for structured formats so that stdout only contains the document
+func setOutput() error {
+	switch run.output {
+	case outputTable:
+		return nil
+	case outputJSON, outputYAML:
+		if l, ok := log.Default().(*log.DefaultLogger); ok {
+			l.SetOutput(os.Stderr)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid output format [%s], must be one of: %s, %s, %s", run.output, outputTable, outputJSON, outputYAML)
+}
+
+// structured - returns true if a machine-readable output format is set
+func structured() bool {
+	return run.output == outputJSON || run.output == outputYAML
+}
+
+// printStructured - writes v to stdout in the selected output format
+func printStructured(v interface{}) error {
+	var (
+		b   []byte
+		err error
+	)
+
+	switch run.output {
+	case outputYAML:
+		b, err = yaml.Marshal(v)
+	default:
+		b, err = json.MarshalIndent(v, "", "  ")
+		b = append(b, '\n')
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(b)
+	return err
+}
+
+// collect - calls fn concurrently for each name, results are returned in the
+// order of names. Failures are logged, an error is returned if any call failed.
+func collect(names []string, fn func(name string) (interface{}, error)) ([]interface{}, error) {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []string
+	)
+
+	results := make([]interface{}, len(names))
+	for i, n := range names {
+		wg.Add(1)
+		go func(i int, n string) {
+			defer wg.Done()
+			v, err := fn(n)
+			if err != nil {
+				log.Error("[%s]: %v", n, err)
+				mu.Lock()
+				failed = append(failed, n)
+				mu.Unlock()
+				return
+			}
+			results[i] = v
+		}(i, n)
+	}
+	wg.Wait()
+
+	// drop results of failed calls
+	out := []interface{}{}
+	for _, v := range results {
+		if v != nil {
+			out = append(out, v)
+		}
+	}
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return out, fmt.Errorf("failed for stacks: %s", failed)
+	}
+	return out, nil
+}
@@ -35,6 +35,21 @@ var (
 			stks, err := Configure(run.cfgSource, run.cfgRaw)
 			utils.HandleError(err)
 
+			if structured() {
+				for _, s := range args {
+					if _, ok := stks.Get(s); !ok {
+						utils.HandleError(fmt.Errorf("%s: does not Exist in Config", s))
+					}
+				}
+
+				outputs, err := collect(args, func(s string) (interface{}, error) {
+					return stks.MustGet(s).StackOutputs()
+				})
+				utils.HandleError(printStructured(outputs))
+				utils.HandleError(err)
+				return
+			}
+
 			for _, s := range args {
 				// check if stack exists
 				if _, ok := stks.Get(s); !ok {
@@ -79,7 +94,15 @@ var (
 		Run: func(cmd *cobra.Command, args []string) {
 			sess, err := GetSession()
 			utils.HandleError(err)
-			utils.HandleError(stacks.Exports(sess))
+
+			if structured() {
+				exports, err := stacks.ListExports(sess, mockClients())
+				utils.HandleError(err)
+				utils.HandleError(printStructured(exports))
+				return
+			}
+
+			utils.HandleError(stacks.Exports(sess, mockClients()))
 		},
 	}
 
@@ -99,6 +122,21 @@ var (
 			stks, err := Configure(run.cfgSource, run.cfgRaw)
 			utils.HandleError(err)
 
+			if structured() {
+				for _, s := range args {
+					if _, ok := stks.Get(s); !ok {
+						utils.HandleError(fmt.Errorf("%s: does not Exist in Config", s))
+					}
+				}
+
+				parameters, err := collect(args, func(s string) (interface{}, error) {
+					return stks.MustGet(s).StackParameters()
+				})
+				utils.HandleError(printStructured(parameters))
+				utils.HandleError(err)
+				return
+			}
+
 			for _, s := range args {
 				// check if stack exists
 				if _, ok := stks.Get(s); !ok {
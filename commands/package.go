@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/daidokoro/qaz/log"
+	"github.com/daidokoro/qaz/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var packageCmd = &cobra.Command{
+	Use:   "package [stack]",
+	Short: "Uploads local code & templates referenced by a stack template and prints the packaged template",
+	Example: strings.Join([]string{
+		"qaz package lambda -c config.yml",
+		"qaz package -c config.yml -t lambda::path/to/template.yml > packaged.yml",
+	}, "\n"),
+	PreRun: initialise,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		var s string
+		var source string
+
+		stks, err := Configure(run.cfgSource, run.cfgRaw)
+		utils.HandleError(err)
+
+		switch {
+		case run.tplSource != "":
+			s, source, err = utils.GetSource(run.tplSource)
+			utils.HandleError(err)
+		case len(args) > 0:
+			s = args[0]
+		}
+
+		stk, ok := stks.Get(s)
+		if !ok {
+			utils.HandleError(fmt.Errorf("stack [%s] not found in config", s))
+		}
+
+		if source != "" {
+			stk.Source = source
+		}
+
+		log.Debug("packaging a template for %s", stk.Name)
+		utils.HandleError(stk.GenTimeParser())
+		utils.HandleError(stk.DeployTimeParser())
+		utils.HandleError(stk.Package())
+
+		fmt.Println(stk.Template)
+	},
+}
@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/daidokoro/qaz/log"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/daidokoro/qaz/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// default plan file written by plan & read by apply
+const defaultPlanFile = "qaz.plan.json"
+
+var (
+	// plan command
+	planCmd = &cobra.Command{
+		Use:   "plan [stacks]",
+		Short: "Creates change-sets for actioned stacks and saves a project plan",
+		Example: strings.Join([]string{
+			"qaz plan --all",
+			"qaz plan vpc subnet -c path/to/config --plan-file vpc.plan.json",
+		}, "\n"),
+		PreRun: initialise,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			stks, err := Configure(run.cfgSource, run.cfgRaw)
+			utils.HandleError(err)
+
+			// pre-flight config validation
+			utils.HandleError(config.Validate())
+
+			if len(args) == 0 && !run.all {
+				utils.HandleError(fmt.Errorf("please specify stacks to plan or use --all"))
+			}
+
+			stks.Range(func(k string, s *stacks.Stack) bool {
+				s.Actioned = run.all || utils.StringIn(k, args)
+				return true
+			})
+
+			for _, s := range args {
+				if _, ok := stks.Get(s); !ok {
+					utils.HandleError(fmt.Errorf("stacks [%s] not found in config", s))
+				}
+			}
+
+			// run gentimeParser
+			stks.Range(func(_ string, s *stacks.Stack) bool {
+				if s.Actioned {
+					utils.HandleError(s.GenTimeParser())
+				}
+				return true
+			})
+
+			plan, err := stacks.PlanHandler(interruptContext(), stks, config.Project, handlerOptions())
+			if err != nil {
+				handleResults(nil, err)
+			}
+
+			fmt.Println("--")
+			plan.Print(os.Stdout)
+
+			utils.HandleError(plan.Save(run.planFile))
+			log.Info("plan saved to [%s], run [qaz apply --plan-file %s] to execute", run.planFile, run.planFile)
+		},
+	}
+
+	// apply command
+	applyCmd = &cobra.Command{
+		Use:   "apply",
+		Short: "Executes the change-sets of a saved plan in dependency order",
+		Example: strings.Join([]string{
+			"qaz apply",
+			"qaz apply -c path/to/config --plan-file vpc.plan.json",
+		}, "\n"),
+		PreRun: initialise,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			plan, err := stacks.LoadPlan(run.planFile)
+			utils.HandleError(err)
+
+			stks, err := Configure(run.cfgSource, run.cfgRaw)
+			utils.HandleError(err)
+
+			if plan.Project != config.Project {
+				utils.HandleError(fmt.Errorf("plan is for project [%s], config project is [%s]", plan.Project, config.Project))
+			}
+
+			handleResults(stacks.ApplyHandler(interruptContext(), stks, plan, handlerOptions()))
+		},
+	}
+)
@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/daidokoro/qaz/log"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/daidokoro/qaz/utils"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/spf13/cobra"
+)
+
+var recoverCmd = &cobra.Command{
+	Use:     "recover [stack]",
+	Aliases: []string{"rollback"},
+	Short:   "Recovers stacks stuck in UPDATE_ROLLBACK_FAILED or DELETE_FAILED",
+	Example: strings.Join([]string{
+		"qaz recover vpc -i",
+		"qaz recover vpc --skip Subnet,RouteTable",
+		"qaz recover vpc --retain Bucket",
+	}, "\n"),
+	PreRun: initialise,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if len(args) != 1 {
+			utils.HandleError(fmt.Errorf("please specify a stack to recover"))
+		}
+
+		stks, err := Configure(run.cfgSource, run.cfgRaw)
+		utils.HandleError(err)
+
+		s, ok := stks.Get(args[0])
+		if !ok {
+			utils.HandleError(fmt.Errorf("stacks [%s] not found in config", args[0]))
+		}
+
+		ctx := interruptContext()
+		status, failed, err := s.FailedResources(ctx)
+		utils.HandleError(err)
+
+		if !stacks.Recoverable(status) {
+			utils.HandleError(fmt.Errorf("stack [%s] is in %s, nothing to recover", s.Name, status))
+		}
+
+		log.Info("stack [%s] is in %s", s.Name, log.ColorMap(status))
+		var ids []string
+		for _, r := range failed {
+			ids = append(ids, r.LogicalID)
+			log.Warn("failed resource: %s - %s - %s - %s", r.LogicalID, r.Type, log.ColorMap(r.Status), r.Reason)
+		}
+
+		// flag for the recovery type, i.e. skip or retain
+		flag := "skip"
+		list := &run.skip
+		if status == cloudformation.StackStatusDeleteFailed {
+			flag = "retain"
+			list = &run.retain
+		}
+
+		if run.interactive {
+			resp := utils.GetInput(
+				fmt.Sprintf("resources to %s, comma separated, use - for none", flag),
+				strings.Join(ids, ","),
+			)
+
+			*list = nil
+			for _, r := range strings.Split(resp, ",") {
+				if r = strings.TrimSpace(r); r != "" && r != "-" {
+					*list = append(*list, r)
+				}
+			}
+
+			if strings.ToLower(utils.GetInput(fmt.Sprintf("recover [%s], %s %s?", s.Name, flag, *list), "N")) != "y" {
+				log.Info("recovery cancelled")
+				return
+			}
+		}
+
+		utils.HandleError(s.Recover(ctx, run.skip, run.retain))
+	},
+}
@@ -1,10 +1,13 @@
 package commands
 
 import (
+	"strings"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/daidokoro/qaz/log"
+	"github.com/daidokoro/qaz/stacks"
 )
 
 // GetSession - Returns aws session based on default run.profile and run.Region
@@ -29,11 +32,60 @@ func GetSession(options ...func(*session.Options)) (*session.Session, error) {
 		f(opts)
 	}
 
+	// apply custom endpoints, S3 addressing & CA bundle
+	endpoints, err := endpointConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := endpoints.Apply(opts); err != nil {
+		return nil, err
+	}
+
 	log.Debug("Creating AWS Session with options: %s", opts)
-	sess, err := session.NewSessionWithOptions(*opts)
+	sess, err = session.NewSessionWithOptions(*opts)
 	if err != nil {
 		return sess, err
 	}
 
 	return sess, nil
 }
+
+// endpointConfig - returns the endpoints of the config, endpoints set via
+// flags take precedence. Returns nil if no endpoints are configured.
+func endpointConfig() (*stacks.EndpointConfig, error) {
+	flags, err := endpointFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Endpoints == nil && flags == nil {
+		return nil, nil
+	}
+	return config.Endpoints.Merge(flags), nil
+}
+
+// endpointFlags - returns the endpoints set via flags, nil if none are set
+func endpointFlags() (*stacks.EndpointConfig, error) {
+	flags := &stacks.EndpointConfig{
+		S3PathStyle: run.s3PathStyle,
+		CABundle:    run.caBundle,
+	}
+
+	// endpoints are set as service=url, or url for all services
+	for _, v := range run.endpoints {
+		service, endpoint := "", v
+		if i := strings.Index(v, "="); i > 0 && !strings.Contains(v[:i], "://") {
+			service, endpoint = v[:i], v[i+1:]
+		}
+
+		if err := flags.Set(service, endpoint); err != nil {
+			return nil, err
+		}
+	}
+
+	if *flags == (stacks.EndpointConfig{}) {
+		return nil, nil
+	}
+	return flags, nil
+}
@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -39,7 +40,7 @@ var (
 			utils.HandleError(err)
 
 			// init shell
-			initShell(config.Project, &stks, shell)
+			initShell(config.Project, stks, shell)
 
 			// run shell
 			shell.Run()
@@ -79,6 +80,34 @@ func initShell(p string, stks *stacks.Map, s *ishell.Shell) {
 			},
 		},
 
+		// drift command
+		&ishell.Cmd{
+			Name:     "drift",
+			Help:     "Detects drift on deployed stacks",
+			LongHelp: "drift [stacks]",
+			Func: func(c *ishell.Context) {
+				if err := actionStacks(stks, c.Args); err != nil {
+					log.Error(err.Error())
+					return
+				}
+
+				drifts, err := stacks.DriftHandler(context.Background(), stks)
+				if _, perr := printDrift(drifts); perr != nil {
+					log.Error(perr.Error())
+				}
+
+				if err != nil {
+					log.Error(err.Error())
+				}
+
+				// reset actioned stacks
+				stks.Range(func(_ string, s *stacks.Stack) bool {
+					s.Actioned = false
+					return true
+				})
+			},
+		},
+
 		// ls command
 		&ishell.Cmd{
 			Name: "ls",
@@ -226,7 +255,7 @@ func initShell(p string, stks *stacks.Map, s *ishell.Shell) {
 				})
 
 				// Deploy Stacks
-				stacks.DeployHandler(stks)
+				printResults(stacks.DeployHandler(context.Background(), stks, handlerOptions()))
 				fmt.Printf("--\nPress %s to return\n--\n", log.ColorString("ENTER", log.GREEN))
 				return
 			},
@@ -261,7 +290,7 @@ func initShell(p string, stks *stacks.Map, s *ishell.Shell) {
 				}
 
 				// Terminate Stacks
-				stacks.TerminateHandler(stks)
+				printResults(stacks.TerminateHandler(context.Background(), stks, handlerOptions()))
 				fmt.Printf("--\nPress %s to return\n--\n", log.ColorString("ENTER", log.GREEN))
 				return
 
@@ -385,13 +414,13 @@ func initShell(p string, stks *stacks.Map, s *ishell.Shell) {
 					return
 				}
 
-				if err := stks.MustGet(s).Change("create", run.changeName); err != nil {
+				if err := stks.MustGet(s).Change(context.Background(), "create", run.changeName); err != nil {
 					log.Error(err.Error())
 					return
 				}
 
 				// descrupt change-set
-				if err := stks.MustGet(s).Change("desc", run.changeName); err != nil {
+				if err := stks.MustGet(s).Change(context.Background(), "desc", run.changeName); err != nil {
 					log.Error(err.Error())
 					return
 				}
@@ -406,14 +435,14 @@ func initShell(p string, stks *stacks.Map, s *ishell.Shell) {
 					resp := c.ReadLine()
 					switch strings.ToLower(resp) {
 					case "y":
-						if err := stks.MustGet(s).Change("execute", run.changeName); err != nil {
+						if err := stks.MustGet(s).Change(context.Background(), "execute", run.changeName); err != nil {
 							log.Error(err.Error())
 							return
 						}
 						log.Info("update completed successfully...")
 						return
 					case "n":
-						if err := stks.MustGet(s).Change("rm", run.changeName); err != nil {
+						if err := stks.MustGet(s).Change(context.Background(), "rm", run.changeName); err != nil {
 							log.Error(err.Error())
 							return
 						}
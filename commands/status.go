@@ -2,6 +2,7 @@ package commands
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
@@ -23,22 +24,10 @@ var (
 		Short:  "Prints status of deployed/un-deployed stacks",
 		PreRun: initialise,
 		Run: func(cmd *cobra.Command, args []string) {
-			var wg sync.WaitGroup
 			stks, err := Configure(run.cfgSource, run.cfgRaw)
 			utils.HandleError(err)
 
-			stks.Range(func(_ string, s *stacks.Stack) bool {
-				wg.Add(1)
-				go func() {
-					if err := s.Status(); err != nil {
-						log.Error("failed to fetch status for [%s]: %v", s.Stackname, err)
-					}
-					wg.Done()
-				}()
-				return true
-			})
-
-			wg.Wait()
+			printStatus(stks)
 		},
 	}
 
@@ -56,17 +45,12 @@ var (
 				return
 			}
 
-			var wg sync.WaitGroup
-
 			repo, err := repo.New(args[0], run.gituser, run.gitrsa)
 			utils.HandleError(err)
 
-			// Passing repo to the global var
+			// file sources are read from the repo
 			gitrepo = *repo
 
-			// add repo
-			stacks.Git(&gitrepo)
-
 			if out, ok := repo.Files[run.cfgSource]; ok {
 				repo.Config = out
 			}
@@ -79,19 +63,7 @@ var (
 			stks, err := Configure(run.cfgSource, repo.Config)
 			utils.HandleError(err)
 
-			stks.Range(func(_ string, s *stacks.Stack) bool {
-				wg.Add(1)
-				go func() {
-					if err := s.Status(); err != nil {
-						log.Error("failed to fetch status for [%s]: %v", s.Stackname, err)
-					}
-					wg.Done()
-				}()
-				return true
-			})
-
-			wg.Wait()
-
+			printStatus(stks)
 		},
 	}
 
@@ -135,10 +107,45 @@ var (
 			log.Info("validating template: %s", name)
 
 			utils.HandleError(stks.MustGet(s).GenTimeParser())
+
+			if structured() {
+				v, err := stks.MustGet(s).Validation()
+				utils.HandleError(err)
+				utils.HandleError(printStructured(v))
+				return
+			}
+
 			utils.HandleError(stks.MustGet(s).Check())
 		},
 	}
 
+	// validate-config command
+	validateConfigCmd = &cobra.Command{
+		Use:   "validate-config",
+		Short: "Validates project config keys, dependencies and delimiters",
+		Example: strings.Join([]string{
+			"qaz validate-config",
+			"qaz validate-config -c path/to/config.yml --env prod",
+		}, "\n"),
+		PreRun: initialise,
+		Run: func(cmd *cobra.Command, args []string) {
+			_, err := Configure(run.cfgSource, run.cfgRaw)
+			utils.HandleError(err)
+
+			if err := config.Validate(); err != nil {
+				if errs, ok := err.(stacks.ConfigErrors); ok {
+					for _, e := range errs {
+						log.Error(e.Error())
+					}
+					utils.HandleError(fmt.Errorf("config validation failed: %d error(s) found", len(errs)))
+				}
+				utils.HandleError(err)
+			}
+
+			log.Info("config is valid: [%s]", run.cfgSource)
+		},
+	}
+
 	// protect command
 	protectCmd = &cobra.Command{
 		Use:    "protect",
@@ -204,3 +211,36 @@ var (
 		},
 	}
 )
+
+// printStatus - prints the status of all stacks in the selected output format
+func printStatus(stks *stacks.Map) {
+	if structured() {
+		var names []string
+		stks.Range(func(k string, _ *stacks.Stack) bool {
+			names = append(names, k)
+			return true
+		})
+		sort.Strings(names)
+
+		status, err := collect(names, func(name string) (interface{}, error) {
+			return stks.MustGet(name).Info()
+		})
+		utils.HandleError(printStructured(status))
+		utils.HandleError(err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	stks.Range(func(_ string, s *stacks.Stack) bool {
+		wg.Add(1)
+		go func() {
+			if err := s.Status(); err != nil {
+				log.Error("failed to fetch status for [%s]: %v", s.Stackname, err)
+			}
+			wg.Done()
+		}()
+		return true
+	})
+
+	wg.Wait()
+}
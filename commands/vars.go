@@ -17,6 +17,9 @@ var (
 const (
 	configENV = "QAZ_CONFIG"
 
+	// environment name environment variable
+	envENV = "QAZ_ENV"
+
 	// OutputRegex for printing yaml/json output
 	OutputRegex = `(?m)^[ ]*([^\r\n:]+?)\s*:`
 )
@@ -45,4 +48,31 @@ var run = struct {
 	gitrsa      string
 	protectOff  bool
 	interactive bool
+	env         string
+	graphFormat string
+	graphStatus bool
+	parallel    int
+	failFast    bool
+	planFile    string
+	driftJSON   bool
+	skip        []string
+	retain      []string
+	importFile  string
+	keep        int
+	dryRun      bool
+	yes         bool
+	bucket      string
+	output      string
+	since       string
+	follow      bool
+	mock        bool
+	endpoints   []string
+	s3PathStyle bool
+	caBundle    string
+	lenient     bool
+
+	restrictAccount bool
+	force           bool
+
+	cancelOnInterrupt bool
 }{}
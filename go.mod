@@ -14,6 +14,7 @@ require (
 	github.com/daidokoro/ishell v0.0.0-20170626201312-73d87bbaf310
 	github.com/fatih/color v1.9.0
 	github.com/flynn-archive/go-shlex v0.0.0-20150515145356-3f9db97f8568 // indirect
+	github.com/hashicorp/hcl v1.0.0
 	github.com/spf13/cobra v0.0.7
 	github.com/stretchr/testify v1.5.1
 	golang.org/x/crypto v0.0.0-20200323165209-0ec3e9974c59
@@ -2,6 +2,7 @@ package log
 
 import (
 	"fmt"
+	"io"
 	"os"
 )
 
@@ -9,16 +10,17 @@ import (
 type DefaultLogger struct {
 	colors    *bool
 	debugMode *bool
+	output    io.Writer
 }
 
 // Info - Prints info level log statments
 func (l *DefaultLogger) Info(msg string, args ...interface{}) {
-	fmt.Fprintf(os.Stdout, "%s: %s\n", ColorString("info", GREEN), fmt.Sprintf(msg, args...))
+	fmt.Fprintf(l.out(), "%s: %s\n", ColorString("info", GREEN), fmt.Sprintf(msg, args...))
 }
 
 // Warn - Prints warn level log statments
 func (l *DefaultLogger) Warn(msg string, args ...interface{}) {
-	fmt.Fprintf(os.Stdout, "%s: %s\n", ColorString("warn", YELLOW), fmt.Sprintf(msg, args...))
+	fmt.Fprintf(l.out(), "%s: %s\n", ColorString("warn", YELLOW), fmt.Sprintf(msg, args...))
 }
 
 // Error - Prints error level log statements
@@ -29,7 +31,7 @@ func (l *DefaultLogger) Error(msg string, args ...interface{}) {
 // Debug - Prints debug level log statements
 func (l *DefaultLogger) Debug(msg string, args ...interface{}) {
 	if *l.debugMode {
-		fmt.Fprintf(os.Stdout, "%s: %s\n", ColorString("debug", MAGENTA), fmt.Sprintf(msg, args...))
+		fmt.Fprintf(l.out(), "%s: %s\n", ColorString("debug", MAGENTA), fmt.Sprintf(msg, args...))
 	}
 }
 
@@ -38,6 +40,19 @@ func (l *DefaultLogger) Colors() bool {
 	return *l.colors
 }
 
+// SetOutput - sets the writer of info, warn & debug logs, defaults to stdout
+func (l *DefaultLogger) SetOutput(w io.Writer) {
+	l.output = w
+}
+
+// out - returns the writer of info, warn & debug logs
+func (l *DefaultLogger) out() io.Writer {
+	if l.output == nil {
+		return os.Stdout
+	}
+	return l.output
+}
+
 // NewDefaultLogger - creates a Logger Object
 func NewDefaultLogger(debug, colors bool) Logger {
 	return &DefaultLogger{
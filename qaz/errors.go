@@ -0,0 +1,48 @@
+package qaz
+
+import "fmt"
+
+// ConfigError - returned when a config can't be fetched, rendered or parsed
+type ConfigError struct {
+	Source string
+	Err    error
+}
+
+// Error - implements the error interface
+func (e *ConfigError) Error() string {
+	if e.Source == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("config [%s]: %v", e.Source, e.Err)
+}
+
+// Unwrap - returns the underlying error
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// StackNotFoundError - returned when a stack is not defined in the config
+type StackNotFoundError struct {
+	Stack string
+}
+
+// Error - implements the error interface
+func (e *StackNotFoundError) Error() string {
+	return fmt.Sprintf("stack [%s] not found in config", e.Stack)
+}
+
+// RenderError - returned when the template of a stack can't be fetched or rendered
+type RenderError struct {
+	Stack string
+	Err   error
+}
+
+// Error - implements the error interface
+func (e *RenderError) Error() string {
+	return fmt.Sprintf("failed to render [%s]: %v", e.Stack, e.Err)
+}
+
+// Unwrap - returns the underlying error
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,315 @@
+// Package qaz - loads, renders, deploys, updates and terminates qaz projects
+// from Go programs. Errors are returned to the caller, never exited on, and
+// each Project keeps its own config, sessions and template functions, so
+// several projects can be used concurrently in one process.
+package qaz
+
+import (
+	"fmt"
+	"net/http"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/daidokoro/hcl"
+	"github.com/daidokoro/qaz/clients"
+	"github.com/daidokoro/qaz/log"
+	"github.com/daidokoro/qaz/repo"
+	"github.com/daidokoro/qaz/stacks"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Options - settings used to load a project
+type Options struct {
+	// ConfigSource - file path, url, s3:// or lambda source of the config,
+	// also used to locate environment overlays, i.e config.prod.yml
+	ConfigSource string
+
+	// Config - raw config in YAML, JSON or HCL, takes precedence over ConfigSource
+	Config string
+
+	// Env - environment overrides to apply to the config
+	Env string
+
+	// Profile - aws profile, the default credential chain is used if empty
+	Profile string
+
+	// Region - aws region, config & stack regions take precedence
+	Region string
+
+	// Endpoints - custom AWS endpoints, take precedence over config endpoints
+	Endpoints *stacks.EndpointConfig
+
+	// DisableRollback - disables rollback of stacks that fail to create
+	DisableRollback bool
+
+	// TokenProvider - returns MFA tokens for roles that require them
+	TokenProvider func() (string, error)
+
+	// Lenient - renders keys missing from template values as <no value>,
+	// by default templates that reference missing keys fail to render
+	Lenient bool
+
+	// Repo - git repo the config and template file sources are read from,
+	// sources not found in the repo are read from the local file system
+	Repo *repo.Repo
+
+	// Clients - provider of the AWS clients of the project & its stacks,
+	// the AWS SDK clients are used if nil, i.e fake clients in mock runs
+	Clients clients.Provider
+}
+
+// Project - a loaded qaz config. Projects are safe for concurrent use,
+// every operation works on its own set of stacks.
+type Project struct {
+	opts   Options
+	config *stacks.Config
+
+	genFuncs    template.FuncMap
+	deployFuncs template.FuncMap
+}
+
+// Load - reads, renders and parses the config given by opts and applies the
+// environment overrides. Returns a ConfigError if the config is invalid.
+func Load(opts Options) (*Project, error) {
+	p := &Project{opts: opts}
+	p.genFuncs = stacks.GenTimeFunctions(p.templateSession, opts.Clients)
+	p.deployFuncs = stacks.DeployTimeFunctions(p.templateSession, opts.Clients)
+
+	sess, err := p.session("", "")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &stacks.Config{Session: sess, Env: opts.Env, File: opts.ConfigSource, Repo: opts.Repo, Lenient: opts.Lenient, Clients: opts.Clients}
+	if opts.Config == "" {
+		if err := stacks.FetchSource(opts.ConfigSource, c); err != nil {
+			return nil, &ConfigError{Source: opts.ConfigSource, Err: err}
+		}
+	} else {
+		c.String = opts.Config
+	}
+
+	// execute config Functions, errors are TemplateErrors naming the config source
+	if err := c.CallFunctions(p.genFuncs); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+
+	if err := Unmarshal(c.String, c); err != nil {
+		return nil, &ConfigError{Source: opts.ConfigSource, Err: err}
+	}
+
+	log.Debug("Config File Read: %s", c.Project)
+
+	// apply environment overrides
+	if opts.Env != "" {
+		if err := p.applyEnvironment(c); err != nil {
+			if _, ok := err.(*ConfigError); ok {
+				return nil, err
+			}
+			return nil, &ConfigError{Source: opts.ConfigSource, Err: err}
+		}
+	}
+
+	p.config = c
+
+	// config endpoints apply to the config session
+	if c.Endpoints != nil {
+		if c.Session, err = p.session("", ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// Unmarshal - parses a config string in HCL, JSON or YAML format
+func Unmarshal(s string, c *stacks.Config) (err error) {
+	log.Debug("checking Config for HCL format...")
+	if err = hcl.Unmarshal([]byte(s), c); err != nil {
+		log.Debug("failed to parse hcl... moving to JSON/YAML... error: %v", err)
+		err = yaml.Unmarshal([]byte(s), c)
+	}
+	return
+}
+
+// applyEnvironment - merges the overrides for the selected environment into
+// the config. Overrides are read from the environments block of the config
+// and from an overlay file alongside the config source, i.e config.prod.yml.
+// The overlay file takes precedence.
+func (p *Project) applyEnvironment(c *stacks.Config) error {
+	var found bool
+	env := p.opts.Env
+	log.Debug("applying environment: [%s]", env)
+
+	if o, ok := c.Environments[env]; ok {
+		c.Merge(o)
+		found = true
+	}
+
+	if src := stacks.EnvSource(p.opts.ConfigSource, env); src != "" {
+		overlay := stacks.Config{Session: c.Session, Env: env, File: src, Repo: c.Repo, Lenient: c.Lenient, Clients: c.Clients}
+		// only missing overlays are skipped, other errors would leave
+		// the environment partially applied
+		if err := stacks.FetchSource(src, &overlay); err != nil {
+			if !stacks.SourceNotFound(err) {
+				return &ConfigError{Source: src, Err: fmt.Errorf("failed to read environment overlay: %v", err)}
+			}
+			log.Debug("no environment overlay found at [%s]: %v", src, err)
+		} else {
+			if err := overlay.CallFunctions(p.genFuncs); err != nil {
+				return err
+			}
+
+			if err := Unmarshal(overlay.String, &overlay); err != nil {
+				return fmt.Errorf("failed to parse environment config [%s]: %s", src, err)
+			}
+
+			log.Debug("environment overlay read: [%s]", src)
+			c.Merge(&overlay)
+			found = true
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("environment [%s] not found in config or overlay file", env)
+	}
+
+	return nil
+}
+
+// endpoints - returns the config endpoints with the option endpoints applied
+func (p *Project) endpoints() *stacks.EndpointConfig {
+	var c *stacks.EndpointConfig
+	if p.config != nil {
+		c = p.config.Endpoints
+	}
+
+	if c == nil && p.opts.Endpoints == nil {
+		return nil
+	}
+	return c.Merge(p.opts.Endpoints)
+}
+
+// session - returns an aws session for the project, profile & region
+// override the project options if set
+func (p *Project) session(profile, region string) (*session.Session, error) {
+	opts := session.Options{
+		Profile:                 p.opts.Profile,
+		SharedConfigState:       session.SharedConfigEnable,
+		AssumeRoleTokenProvider: p.opts.TokenProvider,
+	}
+
+	// CA bundles, i.e AWS_CA_BUNDLE, are loaded into the session http client,
+	// sessions get a client of their own rather than sharing http.DefaultClient
+	opts.Config.HTTPClient = &http.Client{}
+
+	if p.opts.Region != "" {
+		opts.Config.Region = aws.String(p.opts.Region)
+	}
+
+	if profile != "" {
+		opts.Profile = profile
+	}
+
+	if region != "" {
+		opts.Config.Region = aws.String(region)
+	}
+
+	// apply custom endpoints, S3 addressing & CA bundle
+	if err := p.endpoints().Apply(&opts); err != nil {
+		return nil, err
+	}
+
+	log.Debug("Creating AWS Session with options: %s", opts)
+	return session.NewSessionWithOptions(opts)
+}
+
+// templateSession - returns sessions of template functions
+func (p *Project) templateSession(profile string) (*session.Session, error) {
+	return p.session(profile, "")
+}
+
+// Name - returns the project name
+func (p *Project) Name() string {
+	return p.config.Project
+}
+
+// Config - returns the parsed config, it must not be modified
+func (p *Project) Config() *stacks.Config {
+	return p.config
+}
+
+// Validate - checks the config for unknown keys, invalid delimiters and
+// undefined stack references. Returns stacks.ConfigErrors if invalid.
+func (p *Project) Validate() error {
+	return p.config.Validate()
+}
+
+// Stacks - returns a new stack map of the project stacks, stacks are not
+// actioned and their templates are not fetched
+func (p *Project) Stacks() (*stacks.Map, error) {
+	c := p.config
+	m := &stacks.Map{}
+
+	// deploy-time functions resolve outputs of this map
+	deployFuncs := template.FuncMap{}
+	for k, v := range p.deployFuncs {
+		deployFuncs[k] = v
+	}
+	m.AddMapFuncs(deployFuncs)
+
+	for name, v := range c.Stacks {
+		s := &stacks.Stack{
+			Name:             name,
+			Profile:          v.Profile,
+			Region:           v.Region,
+			DependsOn:        v.DependsOn,
+			Policy:           v.Policy,
+			Source:           v.Source,
+			Stackname:        v.Name,
+			Bucket:           v.Bucket,
+			Role:             v.Role,
+			DeployDelims:     &c.DeployDelimiter,
+			GenDelims:        &c.GenerateDelimiter,
+			TemplateValues:   c.Vars(),
+			GenTimeFunc:      &p.genFuncs,
+			DeployTimeFunc:   &deployFuncs,
+			Project:          &c.Project,
+			Timeout:          v.Timeout,
+			NotificationARNs: v.NotificationARNs,
+			StackSet:         v.StackSet,
+			Hooks:            v.Hooks,
+			Rollback:         p.opts.DisableRollback,
+			Repo:             p.opts.Repo,
+			Lenient:          p.opts.Lenient,
+			Clients:          p.opts.Clients,
+
+			Capabilities:          v.Capabilities,
+			OnFailure:             v.OnFailure,
+			RollbackTriggers:      v.RollbackTriggers,
+			TerminationProtection: v.TerminationProtection,
+			RoleARN:               v.RoleARN,
+			Artifacts:             c.Artifacts,
+		}
+
+		s.SetStackName()
+
+		// stack region trumps the config region if set
+		region := c.Region
+		if s.Region != "" {
+			region = s.Region
+		}
+
+		var err error
+		if s.Session, err = p.session(s.Profile, region); err != nil {
+			return nil, err
+		}
+
+		// set parameters and tags, if any
+		c.Parameters(s).Tags(s)
+		m.Add(name, s)
+	}
+
+	return m, nil
+}
@@ -0,0 +1,129 @@
+package qaz
+
+import (
+	"context"
+
+	"github.com/daidokoro/qaz/stacks"
+)
+
+// RunOptions - options of a render, deploy, update or terminate run
+type RunOptions struct {
+	stacks.HandlerOptions
+
+	// Stacks - names of the stacks to action, all stacks are actioned if empty
+	Stacks []string
+
+	// Sources - template sources by stack name, override the config sources
+	Sources map[string]string
+}
+
+// actioned - returns the project stacks with the stacks of the run actioned
+func (p *Project) actioned(opts RunOptions) (*stacks.Map, error) {
+	m, err := p.Stacks()
+	if err != nil {
+		return nil, err
+	}
+
+	for name, src := range opts.Sources {
+		s, ok := m.Get(name)
+		if !ok {
+			return nil, &StackNotFoundError{Stack: name}
+		}
+		s.Source = src
+	}
+
+	if len(opts.Stacks) == 0 {
+		m.Range(func(_ string, s *stacks.Stack) bool {
+			s.Actioned = true
+			return true
+		})
+		return m, nil
+	}
+
+	for _, name := range opts.Stacks {
+		s, ok := m.Get(name)
+		if !ok {
+			return nil, &StackNotFoundError{Stack: name}
+		}
+		s.Actioned = true
+	}
+	return m, nil
+}
+
+// rendered - returns the actioned stacks of the run with gen-time templates
+// rendered, the config is validated first
+func (p *Project) rendered(opts RunOptions) (*stacks.Map, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	m, err := p.actioned(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var rerr error
+	m.Range(func(name string, s *stacks.Stack) bool {
+		if !s.Actioned {
+			return true
+		}
+
+		if err := s.GenTimeParser(); err != nil {
+			rerr = &RenderError{Stack: name, Err: err}
+			return false
+		}
+		return true
+	})
+
+	return m, rerr
+}
+
+// Render - returns the gen-time templates of the run stacks by stack name
+func (p *Project) Render(opts RunOptions) (map[string]string, error) {
+	m, err := p.rendered(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make(map[string]string)
+	m.Range(func(name string, s *stacks.Stack) bool {
+		if s.Actioned {
+			templates[name] = s.Template
+		}
+		return true
+	})
+	return templates, nil
+}
+
+// Deploy - deploys the run stacks in dependency order, existing stacks are
+// updated. Returns a result per stack and a *stacks.HandlerError if any
+// stack failed, the Failure of failed results holds the root cause.
+func (p *Project) Deploy(ctx context.Context, opts RunOptions) (stacks.Results, error) {
+	m, err := p.rendered(opts)
+	if err != nil {
+		return nil, err
+	}
+	return stacks.DeployHandler(ctx, m, opts.HandlerOptions)
+}
+
+// Update - updates the run stacks in dependency order, see Deploy
+func (p *Project) Update(ctx context.Context, opts RunOptions) (stacks.Results, error) {
+	m, err := p.rendered(opts)
+	if err != nil {
+		return nil, err
+	}
+	return stacks.UpdateHandler(ctx, m, opts.HandlerOptions)
+}
+
+// Terminate - terminates the run stacks in reverse dependency order, see Deploy
+func (p *Project) Terminate(ctx context.Context, opts RunOptions) (stacks.Results, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	m, err := p.actioned(opts)
+	if err != nil {
+		return nil, err
+	}
+	return stacks.TerminateHandler(ctx, m, opts.HandlerOptions)
+}
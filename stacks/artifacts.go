@@ -0,0 +1,172 @@
+package stacks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/daidokoro/qaz/bucket"
+	"github.com/daidokoro/qaz/log"
+)
+
+// ArtifactConfig - key prefix & server-side encryption of templates and
+// packaged artifacts uploaded to stack buckets
+type ArtifactConfig struct {
+	Prefix   string `yaml:"prefix,omitempty" json:"prefix,omitempty" hcl:"prefix,omitempty"`
+	SSE      string `yaml:"sse,omitempty" json:"sse,omitempty" hcl:"sse,omitempty"`
+	KMSKeyID string `yaml:"kms_key_id,omitempty" json:"kms_key_id,omitempty" hcl:"kms_key_id,omitempty"`
+
+	// bucket bootstrap settings
+	NoncurrentDays    int64 `yaml:"noncurrent_days,omitempty" json:"noncurrent_days,omitempty" hcl:"noncurrent_days,omitempty"`
+	RestrictToAccount bool  `yaml:"restrict_to_account,omitempty" json:"restrict_to_account,omitempty" hcl:"restrict_to_account,omitempty"`
+}
+
+// server-side encryption types
+const (
+	sseS3  = "AES256"
+	sseKMS = "aws:kms"
+)
+
+// Validate - checks the server-side encryption settings
+func (a *ArtifactConfig) Validate() error {
+	switch a.SSE {
+	case "", sseS3, sseKMS:
+	default:
+		return fmt.Errorf("invalid artifacts sse [%s], must be one of: %s, %s", a.SSE, sseS3, sseKMS)
+	}
+
+	if a.KMSKeyID != "" && a.SSE != sseKMS {
+		return fmt.Errorf("artifacts kms_key_id requires sse [%s]", sseKMS)
+	}
+
+	if a.NoncurrentDays < 0 {
+		return fmt.Errorf("artifacts noncurrent_days must not be negative, got [%d]", a.NoncurrentDays)
+	}
+	return nil
+}
+
+// BucketOptions - returns the options used to bootstrap stack buckets in the given region
+func (a *ArtifactConfig) BucketOptions(region string) bucket.Options {
+	opts := bucket.DefaultOptions(region)
+	if a == nil {
+		return opts
+	}
+
+	if enc := a.encryption(); enc != nil {
+		opts.Encryption = enc
+	}
+
+	if a.NoncurrentDays > 0 {
+		opts.NoncurrentDays = a.NoncurrentDays
+	}
+
+	opts.RestrictToAccount = a.RestrictToAccount
+	opts.Prefix = a.Prefix
+	return opts
+}
+
+// encryption - returns the encryption applied to uploads, nil if not configured
+func (a *ArtifactConfig) encryption() *bucket.Encryption {
+	if a == nil || a.SSE == "" {
+		return nil
+	}
+	return &bucket.Encryption{SSE: a.SSE, KMSKeyID: a.KMSKeyID}
+}
+
+// key - returns the bucket key of the given path under the configured prefix
+func (a *ArtifactConfig) key(elem ...string) string {
+	if a != nil && a.Prefix != "" {
+		elem = append([]string{strings.Trim(a.Prefix, "/")}, elem...)
+	}
+	return path.Join(elem...)
+}
+
+// Bootstrap - creates the stack bucket in the stack region if it does not exist
+// and applies the encryption, versioning, public access & lifecycle settings.
+// The settings of an existing bucket are only replaced if force is set.
+func (s *Stack) Bootstrap(force bool) error {
+	if s.Bucket == "" {
+		return fmt.Errorf("stack [%s] has no bucket configured", s.Name)
+	}
+
+	opts := s.Artifacts.BucketOptions(s.region())
+	opts.Force = force
+	return bucket.Bootstrap(s.Bucket, opts, s.Session, s.Clients)
+}
+
+// contentKey - returns the content-hash key of a template
+func contentKey(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:]) + ".template"
+}
+
+// templateKey - returns the bucket key of the rendered stack template
+func (s *Stack) templateKey() string {
+	return s.Artifacts.key(s.Stackname, contentKey(s.Template))
+}
+
+// PruneKeys - returns the keys to delete so that only the newest keep objects
+// remain, the protected key is never deleted and is not counted
+func PruneKeys(objects []bucket.Object, keep int, protected string) []string {
+	objects = append([]bucket.Object(nil), objects...)
+	sort.SliceStable(objects, func(i, j int) bool {
+		return objects[i].LastModified.After(objects[j].LastModified)
+	})
+
+	var keys []string
+	for _, o := range objects {
+		if o.Key == protected {
+			continue
+		}
+
+		if keep > 0 {
+			keep--
+			continue
+		}
+		keys = append(keys, o.Key)
+	}
+	return keys
+}
+
+// PruneArtifacts - deletes all but the newest keep template uploads of the stack,
+// the template of the deployed stack is always kept. Returns the deleted keys,
+// nothing is deleted if dryRun is set.
+func (s *Stack) PruneArtifacts(keep int, dryRun bool) ([]string, error) {
+	if s.Bucket == "" {
+		return nil, fmt.Errorf("stack [%s] has no bucket configured", s.Name)
+	}
+
+	objects, err := bucket.List(s.Bucket, s.Artifacts.key(s.Stackname)+"/", s.Session, s.Clients)
+	if err != nil {
+		return nil, err
+	}
+
+	// key of the deployed template
+	var protected string
+	svc := s.cfn()
+	params := &cloudformation.GetTemplateInput{
+		StackName:     aws.String(s.Stackname),
+		TemplateStage: aws.String(cloudformation.TemplateStageOriginal),
+	}
+
+	log.Debug("calling [GetTemplate] with parameters: %s", params)
+	resp, err := svc.GetTemplate(params)
+	switch {
+	case err == nil:
+		protected = s.Artifacts.key(s.Stackname, contentKey(aws.StringValue(resp.TemplateBody)))
+	case strings.Contains(err.Error(), "does not exist"):
+	default:
+		return nil, err
+	}
+
+	keys := PruneKeys(objects, keep, protected)
+	if dryRun || len(keys) == 0 {
+		return keys, nil
+	}
+	return keys, bucket.Delete(s.Bucket, keys, s.Session, s.Clients)
+}
@@ -1,13 +1,12 @@
 package stacks
 
 import (
+	"context"
 	"fmt"
 	"regexp"
-	"strings"
 	"time"
 
 	"github.com/daidokoro/qaz/log"
-	"github.com/daidokoro/qaz/utils"
 
 	yaml "gopkg.in/yaml.v2"
 
@@ -23,85 +22,24 @@ const (
 	execute          = "execute"
 	desc             = "desc"
 	serverless       = "serverless"
+	imprt            = "import"
 	iamCapable       = "AWS::IAM"
 	transformCapable = "AWS::Serverless"
 )
 
 // Change - Manage Cloudformation Change-Sets
-func (s *Stack) Change(req, changename string) error {
-	svc := cloudformation.New(s.Session, &aws.Config{Credentials: s.creds()})
+func (s *Stack) Change(ctx context.Context, req, changename string) error {
+	svc := s.cfn()
 
 	switch req {
 
 	case create, transform:
-		// Resolve Deploy-Time functions
-		err := s.DeployTimeParser()
-		if err != nil {
-			return err
-		}
-
-		params := &cloudformation.CreateChangeSetInput{
-			StackName:     aws.String(s.Stackname),
-			ChangeSetName: aws.String(changename),
-		}
-
+		changeType := cloudformation.ChangeSetTypeUpdate
 		if req == transform {
-			params.ChangeSetType = aws.String("CREATE")
-		}
-
-		// add tags if set
-		if len(s.Tags) > 0 {
-			params.Tags = s.Tags
+			changeType = cloudformation.ChangeSetTypeCreate
 		}
 
-		log.Debug("updated template:\n%s", s.Template)
-
-		// If bucket - upload to s3
-		var url string
-
-		if s.Bucket != "" {
-			url, err = resolveBucket(s)
-			if err != nil {
-				return err
-			}
-			params.TemplateURL = &url
-		} else {
-			params.TemplateBody = &s.Template
-		}
-
-		// NOTE: Add parameters and tags flag here if set
-		if len(s.Parameters) > 0 {
-			params.Parameters = s.Parameters
-		}
-
-		if len(s.Tags) > 0 {
-			params.Tags = s.Tags
-		}
-
-		// If IAM is bening touched, add Capabilities
-		if strings.Contains(s.Template, iamCapable) || strings.Contains(s.Template, transformCapable) {
-			params.Capabilities = []*string{
-				aws.String(cloudformation.CapabilityCapabilityIam),
-				aws.String(cloudformation.CapabilityCapabilityNamedIam),
-			}
-		}
-
-		log.Debug("calling [CreateChangeSet] with parameters: %s", params)
-		if _, err = svc.CreateChangeSet(params); err != nil {
-			return err
-		}
-
-		describeParams := &cloudformation.DescribeChangeSetInput{
-			StackName:     aws.String(s.Stackname),
-			ChangeSetName: aws.String(changename),
-		}
-
-		log.Info("creating change-set: [%s] - %s", changename, s.Stackname)
-		if err = Wait(s.ChangeSetStatus, changename); err != nil {
-			return err
-		}
-
-		resp, err := svc.DescribeChangeSet(describeParams)
+		resp, err := s.createChangeSet(ctx, changename, changeType)
 		if err != nil {
 			return err
 		}
@@ -114,6 +52,9 @@ func (s *Stack) Change(req, changename string) error {
 		log.Info("created change-set: [%s] - %s - %s", changename, log.ColorMap(*resp.Status), s.Stackname)
 		return nil
 
+	case imprt:
+		return s.Import(ctx, changename)
+
 	case rm:
 		params := &cloudformation.DeleteChangeSetInput{
 			ChangeSetName: aws.String(changename),
@@ -141,13 +82,13 @@ func (s *Stack) Change(req, changename string) error {
 		}
 
 	case execute, serverless:
-		done := make(chan bool)
 		params := &cloudformation.ExecuteChangeSetInput{
 			StackName:     aws.String(s.Stackname),
 			ChangeSetName: aws.String(changename),
 		}
 
-		if _, err := svc.ExecuteChangeSet(params); err != nil {
+		start := time.Now()
+		if _, err := svc.ExecuteChangeSetWithContext(ctx, params); err != nil {
 			return err
 		}
 
@@ -156,13 +97,14 @@ func (s *Stack) Change(req, changename string) error {
 		}
 
 		if req != serverless {
-			go s.tail("UPDATE", done)
+			stop := s.tail(ctx)
+			defer stop()
 
-			log.Debug("calling [WaitUntilStackUpdateComplete] with parameters:", describeStacksInput)
-			if err := svc.WaitUntilStackUpdateComplete(describeStacksInput); err != nil {
-				return err
+			log.Debug("calling [WaitUntilStackUpdateComplete] with parameters: %s", describeStacksInput)
+			if err := svc.WaitUntilStackUpdateCompleteWithContext(ctx, describeStacksInput); err != nil {
+				stop()
+				return s.failed(ctx, start, err)
 			}
-			done <- true
 		}
 
 		log.Info("change-set executed successfully")
@@ -184,7 +126,9 @@ func (s *Stack) Change(req, changename string) error {
 		}
 
 		reg, err := regexp.Compile(OutputRegex)
-		utils.HandleError(err)
+		if err != nil {
+			return err
+		}
 
 		out := reg.ReplaceAllStringFunc(string(o), func(s string) string {
 			return log.ColorString(s, log.CYAN)
@@ -195,3 +139,97 @@ func (s *Stack) Change(req, changename string) error {
 
 	return nil
 }
+
+// createChangeSet - renders deploy-time values and creates a change-set of the given
+// type (CREATE or UPDATE), waits for it to complete and returns its description
+func (s *Stack) createChangeSet(ctx context.Context, changename, changeType string) (*cloudformation.DescribeChangeSetOutput, error) {
+	svc := s.cfn()
+
+	// Resolve Deploy-Time functions
+	err := s.DeployTimeParser()
+	if err != nil {
+		return nil, err
+	}
+
+	// upload local artifacts & rewrite template references
+	if err := s.Package(); err != nil {
+		return nil, err
+	}
+
+	params := &cloudformation.CreateChangeSetInput{
+		StackName:             aws.String(s.Stackname),
+		ChangeSetName:         aws.String(changename),
+		ChangeSetType:         aws.String(changeType),
+		Capabilities:          s.capabilities(),
+		RollbackConfiguration: s.rollbackConfiguration(),
+		RoleARN:               s.roleARN(),
+	}
+
+	log.Debug("updated template:\n%s", s.Template)
+
+	if changeType == cloudformation.ChangeSetTypeImport {
+		if params.ResourcesToImport, err = ResourcesToImport(s.Template, s.Imports); err != nil {
+			return nil, err
+		}
+	}
+
+	// If bucket - upload to s3
+	var url string
+
+	if s.Bucket != "" {
+		url, err = resolveBucket(s)
+		if err != nil {
+			return nil, err
+		}
+		params.TemplateURL = &url
+	} else {
+		params.TemplateBody = &s.Template
+	}
+
+	// NOTE: Add parameters and tags flag here if set
+	if len(s.Parameters) > 0 {
+		params.Parameters = s.Parameters
+	}
+
+	if len(s.Tags) > 0 {
+		params.Tags = s.Tags
+	}
+
+	log.Debug("calling [CreateChangeSet] with parameters: %s", params)
+	if _, err = svc.CreateChangeSetWithContext(ctx, params); err != nil {
+		return nil, err
+	}
+
+	log.Info("creating change-set: [%s] - %s", changename, s.Stackname)
+	if err = WaitWithContext(ctx, s.ChangeSetStatus, changename); err != nil {
+		return nil, err
+	}
+
+	// changes are paginated, collect all pages
+	var resp *cloudformation.DescribeChangeSetOutput
+	describeParams := &cloudformation.DescribeChangeSetInput{
+		StackName:     aws.String(s.Stackname),
+		ChangeSetName: aws.String(changename),
+	}
+
+	for {
+		log.Debug("calling [DescribeChangeSet] with parameters: %s", describeParams)
+		page, err := svc.DescribeChangeSetWithContext(ctx, describeParams)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp == nil {
+			resp = page
+		} else {
+			resp.Changes = append(resp.Changes, page.Changes...)
+		}
+
+		if page.NextToken == nil {
+			break
+		}
+		describeParams.NextToken = page.NextToken
+	}
+
+	return resp, nil
+}
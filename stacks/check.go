@@ -13,14 +13,7 @@ import (
 
 // Check - Validate Cloudformation templates
 func (s *Stack) Check() error {
-	svc := cloudformation.New(s.Session, &aws.Config{Credentials: s.creds()})
-
-	params := &cloudformation.ValidateTemplateInput{
-		TemplateBody: aws.String(s.Template),
-	}
-
-	log.Debug("Calling [ValidateTemplate] with parameters:\n%s"+"\n--\n", params)
-	resp, err := svc.ValidateTemplate(params)
+	resp, err := s.validateTemplate()
 	if err != nil {
 		return err
 	}
@@ -47,3 +40,15 @@ func (s *Stack) Check() error {
 
 	return nil
 }
+
+// validateTemplate - calls ValidateTemplate on the stack template
+func (s *Stack) validateTemplate() (*cloudformation.ValidateTemplateOutput, error) {
+	svc := s.cfn()
+
+	params := &cloudformation.ValidateTemplateInput{
+		TemplateBody: aws.String(s.Template),
+	}
+
+	log.Debug("Calling [ValidateTemplate] with parameters:\n%s"+"\n--\n", params)
+	return svc.ValidateTemplate(params)
+}
@@ -1,226 +1,231 @@
 package stacks
 
 import (
+	"context"
 	"fmt"
-	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/daidokoro/qaz/clients"
 	"github.com/daidokoro/qaz/log"
-	"github.com/daidokoro/qaz/utils"
 )
 
-// stat type for handling all stack states
-type status struct {
-	sync.Mutex
-	cache    map[string]string
-	pending  string
-	failed   string
-	complete string
-}
-
-func (s *status) update(name, ste string) {
-	s.Lock()
-	defer s.Unlock()
-	log.Debug("Updating Stack Status Map: %s - %s", name, ste)
-	s.cache[name] = ste
-	return
-}
-
-func (s *status) get(name string) string {
-	s.Lock()
-	defer s.Unlock()
-	if v, ok := s.cache[name]; ok {
-		return v
-	}
-	return ""
-}
-
-var state = status{
-	cache:    make(map[string]string),
-	complete: "complete",
-	pending:  "pending",
-	failed:   "failed",
-}
-
 // Exports - prints all cloudformation exports
-func Exports(session *session.Session) error {
-
-	svc := cloudformation.New(session)
-
-	exportParams := &cloudformation.ListExportsInput{}
-
-	log.Debug("calling [ListExports] with parameters: %s", exportParams)
-	exports, err := svc.ListExports(exportParams)
-
+func Exports(session *session.Session, p clients.Provider) error {
+	exports, err := ListExports(session, p)
 	if err != nil {
 		return err
 	}
 
-	for _, i := range exports.Exports {
+	for _, i := range exports {
 
-		fmt.Printf("Export Name: %s\nExport Value: %s\n--\n", log.ColorString(*i.Name, log.MAGENTA), *i.Value)
+		fmt.Printf("Export Name: %s\nExport Value: %s\n--\n", log.ColorString(i.Name, log.MAGENTA), i.Value)
 	}
 
 	return nil
 }
 
-// DeployHandler - Handles deploying stacks in the corrcet order
-// TODO - this is still a fairly convoluted function... need to splify
-func DeployHandler(m *Map) {
-	var wg sync.WaitGroup
-	// kick off tail mechanism
-	tail = make(chan *TailServiceInput)
-	go TailService(tail)
+// DeployHandler - Handles deploying stacks in the correct order, stacks
+// that already exist are updated. A HandlerError is returned if any stack failed.
+func DeployHandler(ctx context.Context, m *Map, opts HandlerOptions) (Results, error) {
+	sc, err := NewScheduler(m, opts)
+	if err != nil {
+		return nil, err
+	}
 
-	m.Range(func(k string, s *Stack) bool {
-		if !s.Actioned {
-			return true
+	run := newExecution()
+
+	// wait for dependencies deployed outside of this run
+	sc.External = func(ctx context.Context, s *Stack) error {
+		return waitDeployed(ctx, run, s)
+	}
+
+	results := runHandler(ctx, sc, "deploy", withHooks(ctx, HookPreDeploy, HookPostDeploy, func(s *Stack) (string, error) {
+		if s.IsStackSet() {
+			return s.deployStackSet(ctx)
 		}
 
 		// Set deploy status & Check if stack exists
 		if s.StackExists() {
-			if err := s.cleanup(); err != nil {
-				log.Error("failed to remove stack: [%s] - %v", s.Name, err)
-				// updateState(status, stk.Name, state.failed)
-				state.update(s.Name, state.failed)
+			if err := s.cleanup(ctx); err != nil {
+				log.Error("failed to clean up stack: [%s] - %v", s.Name, err)
+				run.update(s.Name, stateFailed)
+				return "", err
 			}
+		}
+
+		if len(s.DependsOn) > 0 {
+			log.Info("[%s] depends on: %s", s.Name, s.DependsOn)
+		}
 
-			if s.StackExists() {
-				log.Info("stack [%s] already exists...\n", s.Name)
-				return true
+		// update existing stacks
+		if s.StackExists() {
+			log.Info("stack [%s] already exists, updating...", s.Name)
+			res := ActionUpdated
+			switch err := update(ctx, s, opts); err {
+			case nil:
+			case ErrNoUpdates:
+				log.Info("no updates to be performed: [%s]", s.Name)
+				res = ActionUnchanged
+			default:
+				log.Error(err.Error())
+				run.update(s.Name, stateFailed)
+				return "", err
 			}
 
+			run.update(s.Name, stateComplete)
+			return res, nil
+		}
+
+		run.update(s.Name, statePending)
+		log.Info("deploying a template for [%s]", s.Name)
+		if err := s.Deploy(ctx); err != nil {
+			log.Error(err.Error())
+			run.update(s.Name, stateFailed)
+			return "", err
 		}
-		state.update(s.Name, state.pending)
 
-		if len(s.DependsOn) == 0 {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
+		run.update(s.Name, stateComplete)
+		return ActionCreated, nil
+	}))
 
-				// Deploy 0 Depency Stacks first - each on their on go routine
-				log.Info("deploying a template for [%s]", s.Name)
+	for _, r := range results {
+		if e, ok := r.Err.(*DependencyError); ok {
+			log.Warn("deploy cancelled for stack [%s] due to dependency failure: [%s]", e.Stack, e.Dependency)
+		}
+	}
+
+	return results, results.Err()
+}
 
-				if err := s.Deploy(); err != nil {
-					log.Error(err.Error())
-				}
+// TerminateHandler - Handles terminating stacks in the correct order,
+// a HandlerError is returned if any stack failed.
+func TerminateHandler(ctx context.Context, m *Map, opts HandlerOptions) (Results, error) {
+	sc, err := NewScheduler(m, opts)
+	if err != nil {
+		return nil, err
+	}
 
-				state.update(s.Name, state.complete)
+	// stacks are terminated after all stacks that depend on them
+	sc.Reverse = true
+	sc.External = waitTerminated
 
-				// TODO: add deploy logic here
-				return
-			}()
-			return true
+	results := runHandler(ctx, sc, "terminate", withHooks(ctx, HookPreTerminate, HookPostTerminate, func(s *Stack) (string, error) {
+		terminate := s.terminate
+		if s.IsStackSet() {
+			terminate = s.terminateStackSet
 		}
 
-		wg.Add(1)
-		go func() {
-			log.Info("[%s] depends on: %s", s.Name, s.DependsOn)
-			defer wg.Done()
-
-			log.Debug("Beginning Wait State for Depencies of [%s]"+"\n", s.Name)
-			for {
-				depts := []string{}
-				for _, dept := range s.DependsOn {
-					// Dependency wait
-					dp, ok := m.Get(dept)
-					if !ok {
-						log.Error("Bad dependency: [%s]", dept)
-						return
-					}
-
-					chk, _ := dp.State()
-
-					switch chk {
-					case state.failed:
-						state.update(dp.Name, state.failed)
-					case state.complete:
-						state.update(dp.Name, state.complete)
-					default:
-						state.update(dp.Name, state.pending)
-					}
-
-					depts = append(depts, state.get(dept))
-
-				}
-
-				if utils.All(depts, state.complete) {
-					// Deploy stack once dependencies clear
-					log.Info("deploying a template for [%s]", s.Name)
-
-					if err := s.Deploy(); err != nil {
-						log.Error(err.Error())
-					}
-					return
-				}
-
-				for _, v := range depts {
-					if v == state.failed {
-						log.Warn("deploy Cancelled for stack [%s] due to dependency failure!", s.Name)
-						return
-					}
-				}
-
-				time.Sleep(time.Second * 1)
-			}
-		}()
-		return true
+		if err := terminate(ctx); err != nil {
+			log.Error("error deleting stack: [%s] - %v", s.Name, err)
+			return "", err
+		}
+		return ActionTerminated, nil
+	}))
 
-	})
+	for _, r := range results {
+		if e, ok := r.Err.(*DependencyError); ok {
+			log.Warn("termination cancelled for stack [%s] due to failure of dependent: [%s]", e.Stack, e.Dependency)
+		}
+	}
 
-	// Wait for go routines to complete
-	wg.Wait()
+	return results, results.Err()
 }
 
-// TerminateHandler - Handles terminating stacks in the correct order
-func TerminateHandler(m *Map) {
-	// kick off tail mechanism
-	tail = make(chan *TailServiceInput)
-	var wg sync.WaitGroup
-	go TailService(tail)
-
-	m.Range(func(k string, s *Stack) bool {
-		if !s.Actioned {
-			log.Debug("%s: not actioned, skipping", s.Name)
-			return true
-		}
-
-		// if len(stk.DependsOn) == 0 {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-
-			// create ticker
-			tick := time.NewTicker(time.Millisecond * 1500)
-			defer tick.Stop()
-
-			// Reverse depency look-up so termination waits for all stacks
-			// which depend on it, to finish terminating first.
-			for {
-				m.Range(func(k string, stk *Stack) bool {
-					if utils.StringIn(s.Name, stk.DependsOn) {
-						log.Info("[%s]: Depends on [%s].. Waiting for dependency to terminate", stk.Name, s.Name)
-						for range tick.C {
-							if !stk.StackExists() {
-								break
-							}
-						}
-					}
-					return true
-				})
-
-				if err := s.terminate(); err != nil {
-					log.Error("error deleting stack: [%s] - %v", s.Name, err)
-				}
-				return
+// UpdateHandler - Handles updating stacks in the correct order,
+// a HandlerError is returned if any stack failed.
+func UpdateHandler(ctx context.Context, m *Map, opts HandlerOptions) (Results, error) {
+	sc, err := NewScheduler(m, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	results := runHandler(ctx, sc, "update", withHooks(ctx, HookPreUpdate, HookPostUpdate, func(s *Stack) (string, error) {
+		log.Info("updating stack [%s]", s.Name)
+		if s.IsStackSet() {
+			return s.deployStackSet(ctx)
+		}
+
+		if err := update(ctx, s, opts); err != nil {
+			if err == ErrNoUpdates {
+				log.Info("no updates to be performed: [%s]", s.Name)
+				return ActionUnchanged, nil
 			}
 
-		}()
-		return true
-	})
+			log.Error("error updating stack: [%s] - %v", s.Name, err)
+			return "", err
+		}
+		return ActionUpdated, nil
+	}))
+
+	for _, r := range results {
+		if e, ok := r.Err.(*DependencyError); ok {
+			log.Warn("update cancelled for stack [%s] due to dependency failure: [%s]", e.Stack, e.Dependency)
+		}
+	}
+
+	return results, results.Err()
+}
+
+// update - updates a stack, the update is cancelled if ctx is
+// interrupted while in progress and CancelOnInterrupt is set
+func update(ctx context.Context, s *Stack, opts HandlerOptions) error {
+	err := s.Update(ctx)
+	if err != nil && ctx.Err() != nil && opts.CancelOnInterrupt {
+		if cerr := s.CancelUpdate(); cerr != nil {
+			log.Error("failed to cancel update for stack [%s]: %v", s.Name, cerr)
+		}
+	}
+	return err
+}
+
+// waitDeployed - blocks until a stack that is not actioned in this run
+// is deployed, returns an error if the stack is in a failed state. Stacks
+// already found deployed in the run are not checked again.
+func waitDeployed(ctx context.Context, run *execution, s *Stack) error {
+	if run.state(s.Name) == stateComplete {
+		return nil
+	}
+
+	tick := time.NewTicker(externalPollInterval)
+	defer tick.Stop()
+
+	for {
+		chk, err := s.State()
+		if err != nil {
+			return err
+		}
+
+		switch chk {
+		case stateComplete:
+			run.update(s.Name, stateComplete)
+			return nil
+		case stateFailed:
+			run.update(s.Name, stateFailed)
+			return fmt.Errorf("dependency [%s] is in a failed state", s.Name)
+		}
+
+		log.Info("waiting for dependency [%s] to be deployed", s.Name)
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
 
-	// Wait for go routines to complete
-	wg.Wait()
+// waitTerminated - blocks until a stack that is not actioned in this run no longer exists
+func waitTerminated(ctx context.Context, s *Stack) error {
+	tick := time.NewTicker(externalPollInterval)
+	defer tick.Stop()
+
+	for s.StackExists() {
+		log.Info("waiting for dependent stack [%s] to terminate", s.Name)
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
 }
@@ -1,13 +1,14 @@
 package stacks
 
 import (
-	"bytes"
 	"text/template"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/daidokoro/qaz/clients"
 	"github.com/daidokoro/qaz/log"
+	"github.com/daidokoro/qaz/repo"
 )
 
 // Config type for handling yaml config files
@@ -19,21 +20,60 @@ type Config struct {
 	GenerateDelimiter string                 `yaml:"gen_time,omitempty" json:"gen_time,omitempty" hcl:"gen_time,omitempty"`
 	DeployDelimiter   string                 `yaml:"deploy_time,omitempty" json:"deploy_time,omitempty" hcl:"deploy_time,omitempty"`
 	Global            map[string]interface{} `yaml:"global,omitempty" json:"global,omitempty" hcl:"global,omitempty"`
-	Stacks            map[string]struct {
-		DependsOn        []string               `yaml:"depends_on,omitempty" json:"depends_on,omitempty" hcl:"depends_on,omitempty"`
-		Parameters       []map[string]string    `yaml:"parameters,omitempty" json:"parameters,omitempty" hcl:"parameters,omitempty"`
-		Policy           string                 `yaml:"policy,omitempty" json:"policy,omitempty" hcl:"policy,omitempty"`
-		Profile          string                 `yaml:"profile,omitempty" json:"profile,omitempty" hcl:"profile,omitempty"`
-		Region           string                 `yaml:"region,omitempty" json:"region,omitempty" hcl:"region,omitempty"`
-		Source           string                 `yaml:"source,omitempty" json:"source,omitempty" hcl:"source,omitempty"`
-		Name             string                 `yaml:"name,omitempty" json:"name,omitempty" hcl:"name,omitempty"`
-		Bucket           string                 `yaml:"bucket,omitempty" json:"bucket,omitempty" hcl:"bucket,omitempty"`
-		Role             string                 `yaml:"role,omitempty" json:"role,omitempty" hcl:"role,omitempty"`
-		Tags             []map[string]string    `yaml:"tags,omitempty" json:"tags,omitempty" hcl:"tags,omitempty"`
-		Timeout          int64                  `yaml:"timeout,omitempty" json:"timeout,omitempty" hcl:"timeout,omitempty"`
-		NotificationARNs []string               `yaml:"notification-arns" json:"notification-arns" hcl:"notification-arns"`
-		CF               map[string]interface{} `yaml:"cf,omitempty" json:"cf,omitempty" hcl:"cf,omitempty"`
-	} `yaml:"stacks" json:"stacks" hcl:"stacks"`
+	Stacks            map[string]StackConfig `yaml:"stacks" json:"stacks" hcl:"stacks"`
+
+	// Artifacts - key prefix & encryption of templates and artifacts uploaded to stack buckets
+	Artifacts *ArtifactConfig `yaml:"artifacts,omitempty" json:"artifacts,omitempty" hcl:"artifacts,omitempty"`
+
+	// Endpoints - custom AWS endpoints, S3 addressing & CA bundle of all sessions
+	Endpoints *EndpointConfig `yaml:"endpoints,omitempty" json:"endpoints,omitempty" hcl:"endpoints,omitempty"`
+
+	// Environments - per environment overrides, merged on top
+	// of the project config when an environment is selected
+	Environments map[string]*Config `yaml:"environments,omitempty" json:"environments,omitempty" hcl:"environments,omitempty"`
+
+	// Env - name of the selected environment, if any
+	Env string `yaml:"-" json:"-" hcl:"-"`
+
+	// File - config source, used when reporting errors
+	File string `yaml:"-" json:"-" hcl:"-"`
+
+	// Repo - git repo sources are read from, if any
+	Repo *repo.Repo `yaml:"-" json:"-" hcl:"-"`
+
+	// Lenient - when true, missing template keys render as <no value> instead of failing
+	Lenient bool `yaml:"-" json:"-" hcl:"-"`
+
+	// Clients - provider of the AWS clients of lambda & s3 sources, SDK clients if nil
+	Clients clients.Provider `yaml:"-" json:"-" hcl:"-"`
+
+	// environment overlay configs merged into this config
+	overlays []*Config
+}
+
+// StackConfig type for handling stack values in config files
+type StackConfig struct {
+	DependsOn        []string               `yaml:"depends_on,omitempty" json:"depends_on,omitempty" hcl:"depends_on,omitempty"`
+	Parameters       []map[string]string    `yaml:"parameters,omitempty" json:"parameters,omitempty" hcl:"parameters,omitempty"`
+	Policy           string                 `yaml:"policy,omitempty" json:"policy,omitempty" hcl:"policy,omitempty"`
+	Profile          string                 `yaml:"profile,omitempty" json:"profile,omitempty" hcl:"profile,omitempty"`
+	Region           string                 `yaml:"region,omitempty" json:"region,omitempty" hcl:"region,omitempty"`
+	Source           string                 `yaml:"source,omitempty" json:"source,omitempty" hcl:"source,omitempty"`
+	Name             string                 `yaml:"name,omitempty" json:"name,omitempty" hcl:"name,omitempty"`
+	Bucket           string                 `yaml:"bucket,omitempty" json:"bucket,omitempty" hcl:"bucket,omitempty"`
+	Role             string                 `yaml:"role,omitempty" json:"role,omitempty" hcl:"role,omitempty"`
+	Tags             []map[string]string    `yaml:"tags,omitempty" json:"tags,omitempty" hcl:"tags,omitempty"`
+	Timeout          int64                  `yaml:"timeout,omitempty" json:"timeout,omitempty" hcl:"timeout,omitempty"`
+	NotificationARNs []string               `yaml:"notification-arns" json:"notification-arns" hcl:"notification-arns"`
+	CF               map[string]interface{} `yaml:"cf,omitempty" json:"cf,omitempty" hcl:"cf,omitempty"`
+	StackSet         *StackSetConfig        `yaml:"stackset,omitempty" json:"stackset,omitempty" hcl:"stackset,omitempty"`
+	Hooks            *Hooks                 `yaml:"hooks,omitempty" json:"hooks,omitempty" hcl:"hooks,omitempty"`
+
+	Capabilities          []string          `yaml:"capabilities,omitempty" json:"capabilities,omitempty" hcl:"capabilities,omitempty"`
+	OnFailure             string            `yaml:"on_failure,omitempty" json:"on_failure,omitempty" hcl:"on_failure,omitempty"`
+	RollbackTriggers      *RollbackTriggers `yaml:"rollback_triggers,omitempty" json:"rollback_triggers,omitempty" hcl:"rollback_triggers,omitempty"`
+	TerminationProtection *bool             `yaml:"termination_protection,omitempty" json:"termination_protection,omitempty" hcl:"termination_protection,omitempty"`
+	RoleARN               string            `yaml:"role_arn,omitempty" json:"role_arn,omitempty" hcl:"role_arn,omitempty"`
 }
 
 // Vars Returns map string of config values
@@ -42,6 +82,7 @@ func (c *Config) Vars() map[string]interface{} {
 	m["global"] = c.Global
 	m["region"] = c.Region
 	m["project"] = c.Project
+	m["env"] = c.Env
 
 	for s, v := range c.Stacks {
 		m[s] = v.CF
@@ -94,17 +135,17 @@ func (c *Config) CallFunctions(fmap template.FuncMap) error {
 
 	log.Debug("calling functions in config file")
 
-	// create template
-	t, err := template.New("config-template").Delims(`{{`, `}}`).Funcs(fmap).Parse(c.String)
+	name := c.File
+	if name == "" {
+		name = "config"
+	}
+
+	out, err := render(name, c.String, `{{`, `}}`, fmap, map[string]interface{}{"env": c.Env}, !c.Lenient)
 	if err != nil {
 		return err
 	}
 
-	// so that we can write to string
-	var doc bytes.Buffer
-
-	t.Execute(&doc, nil)
-	c.String = doc.String()
+	c.String = out
 	log.Debug("config: %s", c.String)
 	return nil
 }
@@ -1,9 +1,11 @@
 package stacks
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
@@ -14,11 +16,11 @@ import (
 // TODO: this function's pretty bad, waaaay too long, need to break it apart
 
 // Deploy - Launch Cloudformation Stack based on config values
-func (s *Stack) Deploy() error {
+func (s *Stack) Deploy(ctx context.Context) error {
 
 	// if serverless deploy
 	if strings.Contains(s.Template, "AWS::Serverless") {
-		return s.DeploySAM()
+		return s.DeploySAM(ctx)
 	}
 
 	err := s.DeployTimeParser()
@@ -26,13 +28,27 @@ func (s *Stack) Deploy() error {
 		return err
 	}
 
+	// upload local artifacts & rewrite template references
+	if err := s.Package(); err != nil {
+		return err
+	}
+
 	log.Debug("Updated Template:\n%s", s.Template)
-	done := make(chan bool)
-	svc := cloudformation.New(s.Session, &aws.Config{Credentials: s.creds()})
+	svc := s.cfn()
 
 	createParams := &cloudformation.CreateStackInput{
-		StackName:       aws.String(s.Stackname),
-		DisableRollback: aws.Bool(s.Rollback),
+		StackName:                   aws.String(s.Stackname),
+		Capabilities:                s.capabilities(),
+		RollbackConfiguration:       s.rollbackConfiguration(),
+		RoleARN:                     s.roleARN(),
+		EnableTerminationProtection: s.TerminationProtection,
+	}
+
+	// on_failure & disable-rollback are mutually exclusive, on_failure takes precedence
+	if s.OnFailure != "" {
+		createParams.OnFailure = aws.String(s.OnFailure)
+	} else {
+		createParams.DisableRollback = aws.Bool(s.Rollback)
 	}
 
 	if s.Policy != "" {
@@ -62,14 +78,6 @@ func (s *Stack) Deploy() error {
 		createParams.NotificationARNs = aws.StringSlice(s.NotificationARNs)
 	}
 
-	// If IAM is being touched, add Capabilities
-	if strings.Contains(s.Template, "AWS::IAM") {
-		createParams.Capabilities = []*string{
-			aws.String(cloudformation.CapabilityCapabilityIam),
-			aws.String(cloudformation.CapabilityCapabilityNamedIam),
-		}
-	}
-
 	// If bucket - upload to s3
 	if s.Bucket != "" {
 		var url string
@@ -82,30 +90,26 @@ func (s *Stack) Deploy() error {
 		createParams.TemplateBody = &s.Template
 	}
 
+	start := time.Now()
 	log.Debug("Calling [CreateStack] with parameters: %s", createParams)
-	if _, err = svc.CreateStack(createParams); err != nil {
+	if _, err = svc.CreateStackWithContext(ctx, createParams); err != nil {
 		return errors.New(fmt.Sprintln("Deploying failed: ", err.Error()))
 
 	}
 
-	// go s.tail("CREATE", done)
-	var tailinput = TailServiceInput{
-		printed: make(map[string]interface{}),
-		stk:     *s,
-		command: "CREATE",
-	}
-
-	go tailWait(done, &tailinput)
+	// tail events until the stack is created or ctx is cancelled
+	stop := s.tail(ctx)
+	defer stop()
 
-	err = svc.WaitUntilStackCreateComplete(&cloudformation.DescribeStacksInput{
+	err = svc.WaitUntilStackCreateCompleteWithContext(ctx, &cloudformation.DescribeStacksInput{
 		StackName: aws.String(s.Stackname),
 	})
 
 	if err != nil {
-		return err
+		stop()
+		return s.failed(ctx, start, err)
 	}
 
-	done <- true
 	log.Info(
 		"deployment completed: %s",
 		color.New(color.FgWhite).Add(color.Bold).SprintFunc()(fmt.Sprintf("[%s]", s.Stackname)),
@@ -0,0 +1,231 @@
+package stacks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/daidokoro/qaz/log"
+)
+
+// interval between drift detection status checks
+var driftPollInterval = time.Second * 3
+
+// drift status for stacks that are not deployed or not supported
+const (
+	driftNotDeployed  = "NOT_DEPLOYED"
+	driftNotSupported = "NOT_SUPPORTED"
+)
+
+// Drift - drift detection result for a stack
+type Drift struct {
+	Stack            string          `json:"stack" yaml:"stack"`
+	Stackname        string          `json:"stackname" yaml:"stackname"`
+	Status           string          `json:"status" yaml:"status"`
+	Reason           string          `json:"reason,omitempty" yaml:"reason,omitempty"`
+	DriftedResources int64           `json:"drifted_resources" yaml:"drifted_resources"`
+	Resources        []ResourceDrift `json:"resources,omitempty" yaml:"resources,omitempty"`
+}
+
+// ResourceDrift - drift status of a single stack resource
+type ResourceDrift struct {
+	LogicalID   string               `json:"logical_id" yaml:"logical_id"`
+	PhysicalID  string               `json:"physical_id" yaml:"physical_id"`
+	Type        string               `json:"type" yaml:"type"`
+	Status      string               `json:"status" yaml:"status"`
+	Differences []PropertyDifference `json:"differences,omitempty" yaml:"differences,omitempty"`
+}
+
+// PropertyDifference - expected & actual value of a drifted resource property
+type PropertyDifference struct {
+	Path     string `json:"path" yaml:"path"`
+	Type     string `json:"type" yaml:"type"`
+	Expected string `json:"expected" yaml:"expected"`
+	Actual   string `json:"actual" yaml:"actual"`
+}
+
+// Drifted - returns true if the stack or any of its resources drifted
+func (d *Drift) Drifted() bool {
+	return d.Status == cloudformation.StackDriftStatusDrifted || d.DriftedResources > 0
+}
+
+// Print - writes drift status and property differences of drifted resources to w
+func (d *Drift) Print(w io.Writer) {
+	status := d.Status
+	if d.Drifted() {
+		status = fmt.Sprintf("%s - %d resource(s) drifted", status, d.DriftedResources)
+	}
+	fmt.Fprintf(w, "%s: %s\n", d.Stack, status)
+
+	if d.Reason != "" {
+		fmt.Fprintf(w, "  reason: %s\n", d.Reason)
+	}
+
+	for _, r := range d.Resources {
+		if r.Status == cloudformation.StackResourceDriftStatusInSync {
+			continue
+		}
+
+		fmt.Fprintf(w, "  %s - %s - %s [%s]\n", r.Status, r.Type, r.LogicalID, r.PhysicalID)
+		for _, p := range r.Differences {
+			fmt.Fprintf(w, "    %s %s: expected [%s], actual [%s]\n", p.Type, p.Path, p.Expected, p.Actual)
+		}
+	}
+}
+
+// Drift - runs drift detection on a deployed stack, waits for
+// detection to complete and returns the resource drift details
+func (s *Stack) Drift(ctx context.Context) (*Drift, error) {
+	d := &Drift{Stack: s.Name, Stackname: s.Stackname}
+	if s.IsStackSet() {
+		d.Status = driftNotSupported
+		d.Reason = "drift detection is not supported for stacksets"
+		return d, nil
+	}
+
+	if !s.StackExists() {
+		d.Status = driftNotDeployed
+		return d, nil
+	}
+
+	svc := s.cfn()
+	params := &cloudformation.DetectStackDriftInput{
+		StackName: aws.String(s.Stackname),
+	}
+
+	log.Debug("calling [DetectStackDrift] with parameters: %s", params)
+	resp, err := svc.DetectStackDriftWithContext(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("detecting drift: [%s]", s.Stackname)
+	statusParams := &cloudformation.DescribeStackDriftDetectionStatusInput{
+		StackDriftDetectionId: resp.StackDriftDetectionId,
+	}
+
+	tick := time.NewTicker(driftPollInterval)
+	defer tick.Stop()
+
+	for {
+		log.Debug("calling [DescribeStackDriftDetectionStatus] with parameters: %s", statusParams)
+		stat, err := svc.DescribeStackDriftDetectionStatusWithContext(ctx, statusParams)
+		if err != nil {
+			return nil, err
+		}
+
+		if aws.StringValue(stat.DetectionStatus) != cloudformation.StackDriftDetectionStatusDetectionInProgress {
+			d.Status = aws.StringValue(stat.StackDriftStatus)
+			d.DriftedResources = aws.Int64Value(stat.DriftedStackResourceCount)
+
+			// failed detections may still contain partial results
+			if aws.StringValue(stat.DetectionStatus) == cloudformation.StackDriftDetectionStatusDetectionFailed {
+				d.Reason = aws.StringValue(stat.DetectionStatusReason)
+			}
+			break
+		}
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// resource drifts are paginated, collect all pages
+	driftParams := &cloudformation.DescribeStackResourceDriftsInput{
+		StackName: aws.String(s.Stackname),
+	}
+
+	for {
+		log.Debug("calling [DescribeStackResourceDrifts] with parameters: %s", driftParams)
+		page, err := svc.DescribeStackResourceDriftsWithContext(ctx, driftParams)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range page.StackResourceDrifts {
+			d.Resources = append(d.Resources, resourceDrift(r))
+		}
+
+		if page.NextToken == nil {
+			break
+		}
+		driftParams.NextToken = page.NextToken
+	}
+
+	sort.Slice(d.Resources, func(i, j int) bool {
+		return d.Resources[i].LogicalID < d.Resources[j].LogicalID
+	})
+
+	return d, nil
+}
+
+// resourceDrift - converts a cloudformation resource drift
+func resourceDrift(r *cloudformation.StackResourceDrift) ResourceDrift {
+	rd := ResourceDrift{
+		LogicalID:  aws.StringValue(r.LogicalResourceId),
+		PhysicalID: aws.StringValue(r.PhysicalResourceId),
+		Type:       aws.StringValue(r.ResourceType),
+		Status:     aws.StringValue(r.StackResourceDriftStatus),
+	}
+
+	for _, p := range r.PropertyDifferences {
+		rd.Differences = append(rd.Differences, PropertyDifference{
+			Path:     aws.StringValue(p.PropertyPath),
+			Type:     aws.StringValue(p.DifferenceType),
+			Expected: strings.TrimSpace(aws.StringValue(p.ExpectedValue)),
+			Actual:   strings.TrimSpace(aws.StringValue(p.ActualValue)),
+		})
+	}
+	return rd
+}
+
+// DriftHandler - runs drift detection concurrently on all actioned stacks,
+// results are sorted by stack name. An error is returned if detection
+// failed for any stack, results for other stacks are still returned.
+func DriftHandler(ctx context.Context, m *Map) ([]*Drift, error) {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		drifts []*Drift
+		failed []string
+	)
+
+	m.Range(func(k string, s *Stack) bool {
+		if !s.Actioned {
+			return true
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d, err := s.Drift(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Error("drift detection failed for [%s]: %v", s.Name, err)
+				failed = append(failed, s.Name)
+				return
+			}
+			drifts = append(drifts, d)
+		}()
+		return true
+	})
+
+	wg.Wait()
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].Stack < drifts[j].Stack })
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return drifts, fmt.Errorf("drift detection failed for stacks: %s", failed)
+	}
+	return drifts, nil
+}
@@ -0,0 +1,166 @@
+package stacks
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// EndpointConfig - custom service endpoints, S3 addressing & CA bundle of
+// AWS sessions, i.e for LocalStack, VPC or FIPS endpoints
+type EndpointConfig struct {
+	CloudFormation string `yaml:"cloudformation,omitempty" json:"cloudformation,omitempty" hcl:"cloudformation,omitempty"`
+	S3             string `yaml:"s3,omitempty" json:"s3,omitempty" hcl:"s3,omitempty"`
+	STS            string `yaml:"sts,omitempty" json:"sts,omitempty" hcl:"sts,omitempty"`
+	Lambda         string `yaml:"lambda,omitempty" json:"lambda,omitempty" hcl:"lambda,omitempty"`
+	KMS            string `yaml:"kms,omitempty" json:"kms,omitempty" hcl:"kms,omitempty"`
+	SSM            string `yaml:"ssm,omitempty" json:"ssm,omitempty" hcl:"ssm,omitempty"`
+
+	// S3PathStyle - use path-style S3 urls, i.e https://host/bucket/key
+	S3PathStyle bool `yaml:"s3_path_style,omitempty" json:"s3_path_style,omitempty" hcl:"s3_path_style,omitempty"`
+
+	// CABundle - path of a PEM bundle of trusted certificate authorities
+	CABundle string `yaml:"ca_bundle,omitempty" json:"ca_bundle,omitempty" hcl:"ca_bundle,omitempty"`
+}
+
+// services - returns the endpoint of each service, keyed by service id
+func (e *EndpointConfig) services() map[string]*string {
+	return map[string]*string{
+		"cloudformation": &e.CloudFormation,
+		"s3":             &e.S3,
+		"sts":            &e.STS,
+		"lambda":         &e.Lambda,
+		"kms":            &e.KMS,
+		"ssm":            &e.SSM,
+	}
+}
+
+// Services - returns the ids of services that support custom endpoints
+func (e *EndpointConfig) Services() []string {
+	var ids []string
+	for id := range e.services() {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Set - sets the endpoint of a service, the endpoint of all services is
+// set if service is empty
+func (e *EndpointConfig) Set(service, endpoint string) error {
+	svcs := e.services()
+	if service == "" {
+		for _, v := range svcs {
+			*v = endpoint
+		}
+		return nil
+	}
+
+	v, ok := svcs[strings.ToLower(service)]
+	if !ok {
+		return fmt.Errorf("unknown endpoint service [%s], must be one of: %s", service, strings.Join(e.Services(), ", "))
+	}
+	*v = endpoint
+	return nil
+}
+
+// Merge - returns a copy of the config with the set values of o applied
+func (e *EndpointConfig) Merge(o *EndpointConfig) *EndpointConfig {
+	m := &EndpointConfig{}
+	if e != nil {
+		*m = *e
+	}
+
+	if o == nil {
+		return m
+	}
+
+	svcs := m.services()
+	for id, v := range o.services() {
+		if *v != "" {
+			*svcs[id] = *v
+		}
+	}
+
+	if o.S3PathStyle {
+		m.S3PathStyle = true
+	}
+
+	if o.CABundle != "" {
+		m.CABundle = o.CABundle
+	}
+	return m
+}
+
+// Validate - checks that endpoints are absolute urls
+func (e *EndpointConfig) Validate() error {
+	for _, id := range e.Services() {
+		v := *e.services()[id]
+		if v == "" {
+			continue
+		}
+
+		u, err := url.Parse(v)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid %s endpoint [%s], must be an absolute url, i.e https://host:port", id, v)
+		}
+	}
+	return nil
+}
+
+// Resolver - returns an endpoint resolver that resolves the configured
+// services to their custom endpoints, other services use the AWS defaults
+func (e *EndpointConfig) Resolver() endpoints.Resolver {
+	custom := make(map[string]string)
+	for id, v := range e.services() {
+		if *v != "" {
+			custom[id] = *v
+		}
+	}
+
+	return endpoints.ResolverFunc(func(service, region string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+		if v, ok := custom[service]; ok {
+			return endpoints.ResolvedEndpoint{URL: v, SigningRegion: region}, nil
+		}
+		return endpoints.DefaultResolver().EndpointFor(service, region, opts...)
+	})
+}
+
+// Apply - applies the endpoints, S3 addressing & CA bundle to session options
+func (e *EndpointConfig) Apply(opts *session.Options) error {
+	if e == nil {
+		return nil
+	}
+
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	opts.Config.EndpointResolver = e.Resolver()
+	if e.S3PathStyle {
+		opts.Config.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	if e.CABundle != "" {
+		b, err := ioutil.ReadFile(e.CABundle)
+		if err != nil {
+			return fmt.Errorf("failed to read ca bundle: %v", err)
+		}
+		opts.CustomCABundle = bytes.NewReader(b)
+
+		// the bundle is loaded into the session http client, use a client
+		// of its own rather than http.DefaultClient
+		if opts.Config.HTTPClient == nil {
+			opts.Config.HTTPClient = &http.Client{}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package stacks
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/daidokoro/qaz/log"
+)
+
+// Merge - deep merges the given environment overrides into the config.
+// Scalar values are replaced when set, maps are merged recursively and
+// parameters & tags are merged by key.
+func (c *Config) Merge(o *Config) *Config {
+	if o == nil {
+		return c
+	}
+
+	log.Debug("merging environment overrides into config: %s", c.Project)
+
+	// keep track of overlay sources for validation
+	if o.String != "" {
+		c.overlays = append(c.overlays, o)
+	}
+
+	if o.Region != "" {
+		c.Region = o.Region
+	}
+
+	if o.Project != "" {
+		c.Project = o.Project
+	}
+
+	if o.GenerateDelimiter != "" {
+		c.GenerateDelimiter = o.GenerateDelimiter
+	}
+
+	if o.DeployDelimiter != "" {
+		c.DeployDelimiter = o.DeployDelimiter
+	}
+
+	if len(o.Global) > 0 {
+		c.Global = mergeValues(c.Global, o.Global).(map[string]interface{})
+	}
+
+	if o.Artifacts != nil {
+		c.Artifacts = o.Artifacts
+	}
+
+	if o.Endpoints != nil {
+		c.Endpoints = c.Endpoints.Merge(o.Endpoints)
+	}
+
+	if c.Stacks == nil {
+		c.Stacks = make(map[string]StackConfig)
+	}
+
+	for name, stk := range o.Stacks {
+		base, ok := c.Stacks[name]
+		if !ok {
+			c.Stacks[name] = stk
+			continue
+		}
+		c.Stacks[name] = base.merge(stk)
+	}
+
+	return c
+}
+
+// merge - returns a copy of the stack config with the given overrides applied
+func (s StackConfig) merge(o StackConfig) StackConfig {
+	if len(o.DependsOn) > 0 {
+		s.DependsOn = o.DependsOn
+	}
+
+	if o.Policy != "" {
+		s.Policy = o.Policy
+	}
+
+	if o.Profile != "" {
+		s.Profile = o.Profile
+	}
+
+	if o.Region != "" {
+		s.Region = o.Region
+	}
+
+	if o.Source != "" {
+		s.Source = o.Source
+	}
+
+	if o.Name != "" {
+		s.Name = o.Name
+	}
+
+	if o.Bucket != "" {
+		s.Bucket = o.Bucket
+	}
+
+	if o.Role != "" {
+		s.Role = o.Role
+	}
+
+	if o.Timeout > 0 {
+		s.Timeout = o.Timeout
+	}
+
+	if len(o.NotificationARNs) > 0 {
+		s.NotificationARNs = o.NotificationARNs
+	}
+
+	s.Parameters = mergePairs(s.Parameters, o.Parameters)
+	s.Tags = mergePairs(s.Tags, o.Tags)
+
+	if len(o.CF) > 0 {
+		s.CF = mergeValues(s.CF, o.CF).(map[string]interface{})
+	}
+
+	// stackset targets & hooks are replaced, not merged
+	if o.StackSet != nil {
+		s.StackSet = o.StackSet
+	}
+
+	if o.Hooks != nil {
+		s.Hooks = o.Hooks
+	}
+
+	if len(o.Capabilities) > 0 {
+		s.Capabilities = o.Capabilities
+	}
+
+	if o.OnFailure != "" {
+		s.OnFailure = o.OnFailure
+	}
+
+	if o.RollbackTriggers != nil {
+		s.RollbackTriggers = o.RollbackTriggers
+	}
+
+	if o.TerminationProtection != nil {
+		s.TerminationProtection = o.TerminationProtection
+	}
+
+	if o.RoleARN != "" {
+		s.RoleARN = o.RoleARN
+	}
+
+	return s
+}
+
+// mergePairs - merges lists of key/value pairs as used by parameters & tags,
+// values in src replace values in dst with the same key.
+func mergePairs(dst, src []map[string]string) []map[string]string {
+	if len(src) == 0 {
+		return dst
+	}
+
+	index := make(map[string]int)
+	out := make([]map[string]string, 0, len(dst)+len(src))
+	for _, pair := range append(dst, src...) {
+		for k, v := range pair {
+			if i, ok := index[k]; ok {
+				out[i] = map[string]string{k: v}
+				continue
+			}
+			index[k] = len(out)
+			out = append(out, map[string]string{k: v})
+		}
+	}
+	return out
+}
+
+// mergeValues - recursively merges src into dst when both are maps,
+// otherwise src is returned
+func mergeValues(dst, src interface{}) interface{} {
+	d, dok := stringMap(dst)
+	s, sok := stringMap(src)
+	if !sok {
+		return src
+	}
+
+	if !dok {
+		return s
+	}
+
+	for k, v := range s {
+		if dv, ok := d[k]; ok {
+			d[k] = mergeValues(dv, v)
+			continue
+		}
+		d[k] = v
+	}
+	return d
+}
+
+// stringMap - returns the given value as a map[string]interface{}, yaml
+// decodes nested maps as map[interface{}]interface{}
+func stringMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		if m == nil {
+			return nil, false
+		}
+		return m, true
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(m))
+		for k, val := range m {
+			out[fmt.Sprint(k)] = val
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+// SourceNotFound - returns true if err, returned by FetchSource, means the
+// source does not exist, as opposed to failing to read it
+func SourceNotFound(err error) bool {
+	if os.IsNotExist(err) {
+		return true
+	}
+
+	if e, ok := err.(awserr.Error); ok {
+		switch e.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			return true
+		}
+	}
+
+	// http sources
+	return strings.Contains(err.Error(), "Status:[404]")
+}
+
+// EnvSource - returns the overlay source for a given config source and
+// environment, i.e config.yml -> config.prod.yml. Returns an empty string
+// for sources that do not support overlays.
+func EnvSource(src, env string) string {
+	uri, err := url.Parse(src)
+	if err != nil || uri.Scheme == "lambda" {
+		return ""
+	}
+
+	ext := path.Ext(src)
+	if ext == "" || strings.Contains(ext, "/") {
+		return fmt.Sprintf("%s.%s", src, env)
+	}
+
+	return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(src, ext), env, ext)
+}
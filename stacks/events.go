@@ -0,0 +1,239 @@
+package stacks
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/daidokoro/qaz/log"
+)
+
+// interval between stack event polls
+var eventPollInterval = time.Millisecond * 1300
+
+// reason of the stack event that starts a stack operation
+const userInitiated = "User Initiated"
+
+// Event - a stack event
+type Event struct {
+	Stackname  string    `json:"stackname" yaml:"stackname"`
+	StackID    string    `json:"stack_id" yaml:"stack_id"`
+	Timestamp  time.Time `json:"timestamp" yaml:"timestamp"`
+	LogicalID  string    `json:"logical_id" yaml:"logical_id"`
+	PhysicalID string    `json:"physical_id,omitempty" yaml:"physical_id,omitempty"`
+	Type       string    `json:"type" yaml:"type"`
+	Status     string    `json:"status" yaml:"status"`
+	Reason     string    `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// Failed - returns true if the event status is a failure
+func (e Event) Failed() bool {
+	return strings.Contains(e.Status, "FAILED")
+}
+
+// EventStreamer - streams the events of a stack & its nested stacks in
+// chronological order. The id of the newest seen event is tracked so
+// that each event is emitted once, regardless of how many events
+// occurred between polls.
+type EventStreamer struct {
+	// Since - events before Since are not emitted
+	Since time.Time
+
+	// Operation - only emit events of the latest stack operation, i.e. events
+	// after the user initiated event of the stack
+	Operation bool
+
+	// Emit - called for each new event, events are logged if not set
+	Emit func(Event)
+
+	svc    cloudformationiface.CloudFormationAPI
+	stack  string // stack name, replaced by the stack id once known
+	last   string // id of the newest seen event
+	nested map[string]*EventStreamer
+	order  []string // nested stack ids in order of discovery
+}
+
+// EventStreamer - returns an event streamer for the stack
+func (s *Stack) EventStreamer(since time.Time) *EventStreamer {
+	return &EventStreamer{
+		Since:  since,
+		svc:    s.cfn(),
+		stack:  s.Stackname,
+		nested: make(map[string]*EventStreamer),
+	}
+}
+
+// Stream - polls & emits new events until ctx is done. Failed polls, i.e
+// throttling, are retried on the next tick, an error is only returned if
+// the stack does not exist before any of its events were seen.
+func (e *EventStreamer) Stream(ctx context.Context) error {
+	tick := time.NewTicker(eventPollInterval)
+	defer tick.Stop()
+
+	for {
+		if err := e.Poll(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			if !e.started() && strings.Contains(err.Error(), "does not exist") {
+				return err
+			}
+			log.Debug("failed to poll events of [%s], retrying: %v", e.stack, err)
+		}
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Poll - emits all events of the stack & its nested stacks since the last poll
+func (e *EventStreamer) Poll(ctx context.Context) error {
+	events, err := e.collect(ctx)
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return aws.TimeValue(events[i].Timestamp).Before(aws.TimeValue(events[j].Timestamp))
+	})
+
+	emit := e.Emit
+	if emit == nil {
+		emit = logEvent
+	}
+
+	for _, ev := range events {
+		emit(Event{
+			Stackname:  aws.StringValue(ev.StackName),
+			StackID:    aws.StringValue(ev.StackId),
+			Timestamp:  aws.TimeValue(ev.Timestamp),
+			LogicalID:  aws.StringValue(ev.LogicalResourceId),
+			PhysicalID: aws.StringValue(ev.PhysicalResourceId),
+			Type:       aws.StringValue(ev.ResourceType),
+			Status:     aws.StringValue(ev.ResourceStatus),
+			Reason:     aws.StringValue(ev.ResourceStatusReason),
+		})
+	}
+	return nil
+}
+
+// collect - returns the new events of the stack & its nested stacks,
+// nested stacks are followed once they appear in the events
+func (e *EventStreamer) collect(ctx context.Context) ([]*cloudformation.StackEvent, error) {
+	events, err := e.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ev := range events {
+		id := aws.StringValue(ev.PhysicalResourceId)
+		if aws.StringValue(ev.ResourceType) != "AWS::CloudFormation::Stack" || id == "" || id == aws.StringValue(ev.StackId) {
+			continue
+		}
+
+		if _, ok := e.nested[id]; !ok {
+			e.nested[id] = &EventStreamer{
+				Since:  aws.TimeValue(ev.Timestamp),
+				svc:    e.svc,
+				stack:  id,
+				nested: make(map[string]*EventStreamer),
+			}
+			e.order = append(e.order, id)
+		}
+	}
+
+	for _, id := range e.order {
+		n, err := e.nested[id].collect(ctx)
+		if err != nil {
+			log.Debug("failed to fetch events of nested stack [%s]: %v", id, err)
+			continue
+		}
+		events = append(events, n...)
+	}
+	return events, nil
+}
+
+// fetch - returns the events after the last seen event, newest first. Event
+// pages are read until the last seen event, Since or, for operations, the
+// start of the operation is reached.
+func (e *EventStreamer) fetch(ctx context.Context) ([]*cloudformation.StackEvent, error) {
+	params := &cloudformation.DescribeStackEventsInput{
+		StackName: aws.String(e.stack),
+	}
+
+	var events []*cloudformation.StackEvent
+
+pages:
+	for {
+		log.Debug("calling [DescribeStackEvents] with parameters: %s", params)
+		resp, err := e.svc.DescribeStackEventsWithContext(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ev := range resp.StackEvents {
+			if aws.StringValue(ev.EventId) == e.last || aws.TimeValue(ev.Timestamp).Before(e.Since) {
+				break pages
+			}
+
+			events = append(events, ev)
+			if e.Operation && e.last == "" && operationStart(ev) {
+				break pages
+			}
+		}
+
+		if resp.NextToken == nil {
+			break
+		}
+		params.NextToken = resp.NextToken
+	}
+
+	if len(events) > 0 {
+		e.last = aws.StringValue(events[0].EventId)
+
+		// the stack id remains valid once the stack is deleted
+		e.stack = aws.StringValue(events[0].StackId)
+	}
+	return events, nil
+}
+
+// started - returns true once events of the stack were seen, the stack
+// is then referenced by its id
+func (e *EventStreamer) started() bool {
+	return e.last != ""
+}
+
+// operationStart - returns true if ev is the user initiated event of the stack
+func operationStart(ev *cloudformation.StackEvent) bool {
+	return aws.StringValue(ev.ResourceType) == "AWS::CloudFormation::Stack" &&
+		aws.StringValue(ev.PhysicalResourceId) == aws.StringValue(ev.StackId) &&
+		aws.StringValue(ev.ResourceStatusReason) == userInitiated
+}
+
+// logEvent - logs an event, failure reasons are logged as errors
+func logEvent(e Event) {
+	statusReason := ""
+	var lg = log.Info
+	if e.Failed() {
+		statusReason = e.Reason
+		lg = log.Error
+	}
+
+	line := strings.Join([]string{
+		e.Stackname,
+		log.ColorMap(e.Status),
+		e.Type,
+		e.LogicalID,
+		statusReason,
+	}, " - ")
+
+	lg(strings.Trim(line, "- "))
+}
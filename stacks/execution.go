@@ -0,0 +1,42 @@
+package stacks
+
+import (
+	"sync"
+
+	"github.com/daidokoro/qaz/log"
+)
+
+// stack states of a handler run
+const (
+	statePending  = "pending"
+	stateComplete = "complete"
+	stateFailed   = "failed"
+)
+
+// execution - state of a single handler run. Every handler call owns its
+// execution, so handlers can run concurrently without sharing state, i.e
+// two projects or a deploy and a status watch.
+type execution struct {
+	sync.Mutex
+	states map[string]string
+}
+
+// newExecution - returns the execution of a new handler run
+func newExecution() *execution {
+	return &execution{states: make(map[string]string)}
+}
+
+// update - sets the state of a stack in this run
+func (e *execution) update(name, state string) {
+	e.Lock()
+	defer e.Unlock()
+	log.Debug("Updating Stack Status Map: %s - %s", name, state)
+	e.states[name] = state
+}
+
+// state - returns the state of a stack in this run, empty if not set
+func (e *execution) state(name string) string {
+	e.Lock()
+	defer e.Unlock()
+	return e.states[name]
+}
@@ -0,0 +1,168 @@
+package stacks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/daidokoro/qaz/log"
+)
+
+// Failure - root cause of a failed stack operation
+type Failure struct {
+	Stack     string  `json:"stack" yaml:"stack"`
+	Stackname string  `json:"stackname" yaml:"stackname"`
+	StackID   string  `json:"stack_id,omitempty" yaml:"stack_id,omitempty"`
+	Region    string  `json:"region" yaml:"region"`
+	RootCause *Event  `json:"root_cause,omitempty" yaml:"root_cause,omitempty"`
+	Cancelled []Event `json:"cancelled,omitempty" yaml:"cancelled,omitempty"`
+	Failed    []Event `json:"failed,omitempty" yaml:"failed,omitempty"`
+	Console   string  `json:"console,omitempty" yaml:"console,omitempty"`
+}
+
+// cascadeReasons - reasons of failures caused by another failure
+var cascadeReasons = []string{
+	"cancelled",
+	"The following resource(s) failed",
+	"Embedded stack",
+}
+
+// cascaded - returns true if the event failed because another resource failed
+func cascaded(e Event) bool {
+	for _, r := range cascadeReasons {
+		if strings.Contains(e.Reason, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// RootCause - summarises the failed events of an operation, events must be in
+// chronological order. The root cause is the first failure not caused by
+// another failure, nested stack failures are therefore reported before the
+// failure of their parent stack resource. Returns nil if no events failed.
+func RootCause(events []Event) *Failure {
+	f := &Failure{}
+	for _, e := range events {
+		if !e.Failed() {
+			continue
+		}
+
+		f.Failed = append(f.Failed, e)
+		if strings.Contains(e.Reason, "cancelled") {
+			f.Cancelled = append(f.Cancelled, e)
+		}
+
+		if f.RootCause == nil && !cascaded(e) {
+			root := e
+			f.RootCause = &root
+		}
+	}
+
+	if len(f.Failed) == 0 {
+		return nil
+	}
+
+	if f.RootCause == nil {
+		root := f.Failed[0]
+		f.RootCause = &root
+	}
+	return f
+}
+
+// Error - returns a one line description of the root cause
+func (f *Failure) Error() string {
+	r := f.RootCause
+	return fmt.Sprintf("%s - %s - %s [%s]: %s", r.Stackname, r.Status, r.Type, r.LogicalID, r.Reason)
+}
+
+// Print - writes the root cause, cancelled resources & stack links to w
+func (f *Failure) Print(w io.Writer) {
+	r := f.RootCause
+	fmt.Fprintf(w, "root cause: [%s] - %s\n", f.Stack, f.Stackname)
+	fmt.Fprintf(w, "  resource:  %s - %s [%s]\n", r.Type, r.LogicalID, r.PhysicalID)
+	if r.Stackname != f.Stackname {
+		fmt.Fprintf(w, "  in nested: %s\n", r.Stackname)
+	}
+	fmt.Fprintf(w, "  status:    %s\n", r.Status)
+	fmt.Fprintf(w, "  reason:    %s\n", r.Reason)
+
+	if len(f.Cancelled) > 0 {
+		var ids []string
+		for _, c := range f.Cancelled {
+			ids = append(ids, c.LogicalID)
+		}
+		fmt.Fprintf(w, "  cancelled: %s\n", strings.Join(ids, ", "))
+	}
+
+	if f.StackID != "" {
+		fmt.Fprintf(w, "  stack id:  %s\n", f.StackID)
+	}
+
+	if f.Console != "" {
+		fmt.Fprintf(w, "  console:   %s\n", f.Console)
+	}
+}
+
+// Failure - returns the root cause of the latest stack operation, events
+// before since are ignored. Returns nil if no events of the operation failed.
+func (s *Stack) Failure(ctx context.Context, since time.Time) (*Failure, error) {
+	var events []Event
+	e := s.EventStreamer(since)
+	e.Operation = true
+	e.Emit = func(ev Event) {
+		events = append(events, ev)
+	}
+
+	if err := e.Poll(ctx); err != nil {
+		return nil, err
+	}
+
+	f := RootCause(events)
+	if f == nil {
+		return nil, nil
+	}
+
+	f.Stack = s.Name
+	f.Stackname = s.Stackname
+	f.Region = s.region()
+	for _, ev := range events {
+		if ev.Stackname == s.Stackname && ev.StackID != "" {
+			f.StackID = ev.StackID
+			f.Console = fmt.Sprintf("https://console.aws.amazon.com/cloudformation/home?region=%s#/stacks/events?stackId=%s", f.Region, url.QueryEscape(f.StackID))
+			break
+		}
+	}
+	return f, nil
+}
+
+// failed - logs the root cause of an operation that started at start and
+// failed with err. The failure is kept for the handler result and the
+// root cause is returned as the error, err is returned if none is found.
+func (s *Stack) failed(ctx context.Context, start time.Time, err error) error {
+	// interrupted operations did not fail
+	if ctx.Err() != nil {
+		return err
+	}
+
+	f, ferr := s.Failure(context.Background(), start.Add(-tailSkew))
+	if ferr != nil {
+		log.Debug("failed to fetch failure events for [%s]: %v", s.Name, ferr)
+		return err
+	}
+
+	if f == nil {
+		return err
+	}
+
+	s.failure = f
+
+	var buf bytes.Buffer
+	f.Print(&buf)
+	log.Error("%s", strings.TrimSpace(buf.String()))
+	return f
+}
@@ -0,0 +1,247 @@
+package stacks
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/daidokoro/qaz/bucket"
+	"github.com/daidokoro/qaz/clients"
+	"github.com/daidokoro/qaz/log"
+	"github.com/daidokoro/qaz/utils"
+)
+
+// SessionFunc - returns the session used by template functions that call
+// AWS, the default profile is used if profile is empty
+type SessionFunc func(profile string) (*session.Session, error)
+
+// templateFuncs - AWS backed template functions, shared by gen-time &
+// deploy-time function maps. Functions return errors to the template.
+type templateFuncs struct {
+	session SessionFunc
+	clients clients.Provider
+}
+
+func (f templateFuncs) kmsEncrypt(kid string, text string) (string, error) {
+	log.Debug("running template function: [kms_encrypt]")
+	sess, err := f.session("")
+	if err != nil {
+		return "", err
+	}
+
+	params := &kms.EncryptInput{
+		KeyId:     aws.String(kid),
+		Plaintext: []byte(text),
+	}
+
+	resp, err := clients.Default(f.clients).KMS(sess).Encrypt(params)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(resp.CiphertextBlob), nil
+}
+
+func (f templateFuncs) kmsDecrypt(cipher string) (string, error) {
+	log.Debug("running template function: [kms_decrypt]")
+	sess, err := f.session("")
+	if err != nil {
+		return "", err
+	}
+
+	ciph, err := base64.StdEncoding.DecodeString(cipher)
+	if err != nil {
+		return "", err
+	}
+
+	params := &kms.DecryptInput{
+		CiphertextBlob: []byte(ciph),
+	}
+
+	resp, err := clients.Default(f.clients).KMS(sess).Decrypt(params)
+	if err != nil {
+		return "", err
+	}
+
+	return string(resp.Plaintext), nil
+}
+
+func (f templateFuncs) httpGet(url string) (interface{}, error) {
+	log.Debug("Calling Template Function [GET] with arguments: %s", url)
+	return utils.Get(url)
+}
+
+func (f templateFuncs) s3Read(url string, profile ...string) (string, error) {
+	log.Debug("Calling Template Function [S3Read] with arguments: %s", url)
+
+	var p string
+	if len(profile) < 1 {
+		log.Warn("No Profile specified for S3read, using the default profile")
+	} else {
+		p = profile[0]
+	}
+
+	sess, err := f.session(p)
+	if err != nil {
+		return "", err
+	}
+
+	return bucket.S3Read(url, sess, f.clients)
+}
+
+func (f templateFuncs) lambdaInvoke(name string, payload string) (interface{}, error) {
+	log.Debug("running template function: [invoke]")
+	l := awslambda{name: name}
+	var m interface{}
+
+	if payload != "" {
+		l.payload = []byte(payload)
+	}
+
+	sess, err := f.session("")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.Invoke(sess, f.clients); err != nil {
+		return nil, err
+	}
+
+	// parse json if possible
+	if err := json.Unmarshal([]byte(l.response), &m); err != nil {
+		log.Debug(err.Error())
+		return l.response, nil
+	}
+
+	return m, nil
+}
+
+func loop(n int) []struct{} {
+	return make([]struct{}, n)
+}
+
+func literal(str string) string {
+	return fmt.Sprintf("%#v", str)
+}
+
+// GenTimeFunctions - returns the gen-time template functions, AWS calls use
+// sessions returned by sess and clients of p, SDK clients if p is nil
+func GenTimeFunctions(sess SessionFunc, p clients.Provider) template.FuncMap {
+	f := templateFuncs{sess, p}
+	return template.FuncMap{
+		// simple additon function useful for counters in loops
+		"add": func(a int, b int) int {
+			log.Debug("Calling Template Function [add] with arguments: %d + %d", a, b)
+			return a + b
+		},
+
+		// strip function for removing characters from text
+		"strip": func(s string, rmv string) string {
+			log.Debug("Calling Template Function [strip] with arguments: (%s, %s) ", s, rmv)
+			return strings.Replace(s, rmv, "", -1)
+		},
+
+		// cat function for reading text from a given file under the files folder
+		"cat": func(path string) (string, error) {
+			log.Debug("Calling Template Function [cat] with arguments: %s", path)
+			b, err := ioutil.ReadFile(path)
+			return string(b), err
+		},
+
+		// literal - return raw/literal string with special chars and all
+		"literal": literal,
+
+		// suffix - returns true if string starts with given suffix
+		"suffix": strings.HasSuffix,
+
+		// prefix - returns true if string starts with given prefix
+		"prefix": strings.HasPrefix,
+
+		// contains - returns true if string contains
+		"contains": strings.Contains,
+
+		// loop - useful to range over an int (rather than a slice, map, or channel). see examples/loop
+		"loop": loop,
+
+		// Get get does an HTTP Get request of the given url and returns the output string
+		"GET": f.httpGet,
+
+		// S3Read reads content of file from s3 and returns string contents
+		"s3_read": f.s3Read,
+
+		// invoke - invokes a lambda function and returns a raw string/interface{}
+		"invoke": f.lambdaInvoke,
+
+		// kms-encrypt - Encrypts PlainText using KMS key
+		"kms_encrypt": f.kmsEncrypt,
+
+		// kms-decrypt - Descrypts CipherText
+		"kms_decrypt": f.kmsDecrypt,
+
+		// mod - returns remainder after division (modulus)
+		"mod": func(a int, b int) int {
+			log.Debug("Calling Template Function [mod] with arguments: %d %% %d", a, b)
+			return a % b
+		},
+
+		// seq - returns a sequence of numbers
+		"seq": func(from, to int) []int {
+			log.Debug("Calling Template Function [seq] with arguments: %d - %d", from, to)
+			seq := make([]int, to-from+1)
+			for i := range seq {
+				seq[i] = from + i
+			}
+			return seq
+		},
+
+		// capitalize first letter
+		"title": func(s string) string {
+			log.Debug("Calling Template Function [title] with arguments: %s", s)
+			return strings.Title(s)
+		},
+	}
+}
+
+// DeployTimeFunctions - returns the deploy-time template functions, AWS calls
+// use sessions returned by sess and clients of p. Stack output functions are
+// added per stack map, see Map.AddMapFuncs
+func DeployTimeFunctions(sess SessionFunc, p clients.Provider) template.FuncMap {
+	f := templateFuncs{sess, p}
+	return template.FuncMap{
+		// suffix - returns true if string starts with given suffix
+		"suffix": strings.HasSuffix,
+
+		// prefix - returns true if string starts with given prefix
+		"prefix": strings.HasPrefix,
+
+		// contains - returns true if string contains
+		"contains": strings.Contains,
+
+		// loop - useful to range over an int (rather than a slice, map, or channel). see examples/loop
+		"loop": loop,
+
+		// literal - return raw/literal string with special chars and all
+		"literal": literal,
+
+		// Get get does an HTTP Get request of the given url and returns the output string
+		"GET": f.httpGet,
+
+		// S3Read reads content of file from s3 and returns string contents
+		"s3_read": f.s3Read,
+
+		// invoke - invokes a lambda function and returns a raw string/interface{}
+		"invoke": f.lambdaInvoke,
+
+		// kms-encrypt - Encrypts PlainText using KMS key
+		"kms_encrypt": f.kmsEncrypt,
+
+		// kms-decrypt - Descrypts CipherText
+		"kms_decrypt": f.kmsDecrypt,
+	}
+}
@@ -0,0 +1,233 @@
+package stacks
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Graph - directed acyclic graph of stack dependencies built from Stack.DependsOn
+type Graph struct {
+	nodes      []string
+	deps       map[string][]string
+	dependents map[string][]string
+}
+
+// NewGraph - builds the dependency graph for the stacks in the given map.
+// An error is returned if a dependency is not defined or if the
+// dependencies contain a cycle.
+func NewGraph(m *Map) (*Graph, error) {
+	deps := make(map[string][]string)
+	m.Range(func(k string, s *Stack) bool {
+		deps[k] = s.DependsOn
+		return true
+	})
+	return newGraph(deps)
+}
+
+// newGraph - builds graph from map of node -> dependencies
+func newGraph(deps map[string][]string) (*Graph, error) {
+	g, err := buildGraph(deps)
+	if err != nil {
+		return nil, err
+	}
+
+	if cycle := g.cycle(); cycle != nil {
+		return nil, fmt.Errorf("dependency cycle detected: %s", strings.Join(cycle, " -> "))
+	}
+
+	return g, nil
+}
+
+// buildGraph - builds graph without checking for cycles
+func buildGraph(deps map[string][]string) (*Graph, error) {
+	g := &Graph{
+		deps:       make(map[string][]string),
+		dependents: make(map[string][]string),
+	}
+
+	for n := range deps {
+		g.nodes = append(g.nodes, n)
+	}
+	sort.Strings(g.nodes)
+
+	for _, n := range g.nodes {
+		for _, d := range deps[n] {
+			if _, ok := deps[d]; !ok {
+				return nil, fmt.Errorf("bad dependency: stack [%s] depends on [%s], which is not defined", n, d)
+			}
+			g.deps[n] = append(g.deps[n], d)
+			g.dependents[d] = append(g.dependents[d], n)
+		}
+		sort.Strings(g.deps[n])
+	}
+
+	for _, n := range g.nodes {
+		sort.Strings(g.dependents[n])
+	}
+
+	return g, nil
+}
+
+// cycle - returns the path of the first dependency cycle found, or nil
+func (g *Graph) cycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	marks := make(map[string]int)
+	var path []string
+	var visit func(n string) []string
+
+	visit = func(n string) []string {
+		marks[n] = visiting
+		path = append(path, n)
+		for _, d := range g.deps[n] {
+			switch marks[d] {
+			case visiting:
+				// slice path from the start of the cycle
+				for i, p := range path {
+					if p == d {
+						return append(append([]string{}, path[i:]...), d)
+					}
+				}
+			case unvisited:
+				if c := visit(d); c != nil {
+					return c
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		marks[n] = visited
+		return nil
+	}
+
+	for _, n := range g.nodes {
+		if marks[n] == unvisited {
+			if c := visit(n); c != nil {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// Nodes - returns sorted list of stack names in the graph
+func (g *Graph) Nodes() []string {
+	return g.nodes
+}
+
+// Dependencies - returns the stacks the given stack depends on
+func (g *Graph) Dependencies(n string) []string {
+	return g.deps[n]
+}
+
+// Dependents - returns the stacks that depend on the given stack
+func (g *Graph) Dependents(n string) []string {
+	return g.dependents[n]
+}
+
+// Waves - returns stacks grouped in topological order, stacks in
+// the same wave have no dependencies on each other.
+func (g *Graph) Waves() [][]string {
+	var waves [][]string
+	indegree := make(map[string]int)
+	for _, n := range g.nodes {
+		indegree[n] = len(g.deps[n])
+	}
+
+	var current []string
+	for _, n := range g.nodes {
+		if indegree[n] == 0 {
+			current = append(current, n)
+		}
+	}
+
+	for len(current) > 0 {
+		waves = append(waves, current)
+		var next []string
+		for _, n := range current {
+			for _, d := range g.dependents[n] {
+				indegree[d]--
+				if indegree[d] == 0 {
+					next = append(next, d)
+				}
+			}
+		}
+		sort.Strings(next)
+		current = next
+	}
+	return waves
+}
+
+// --- Graph Rendering --- //
+
+var graphIDRegex = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// label - returns the node label, including status if available
+func label(n string, status map[string]string, sep string) string {
+	if s, ok := status[n]; ok && s != "" {
+		return fmt.Sprintf("%s%s%s", n, sep, s)
+	}
+	return n
+}
+
+// DOT - renders the graph in Graphviz DOT format, edges point
+// from dependency to dependent, i.e. in deployment order.
+func (g *Graph) DOT(project string, status map[string]string) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "digraph %q {\n", project)
+	fmt.Fprintf(&b, "  rankdir=LR;\n")
+	fmt.Fprintf(&b, "  node [shape=box];\n")
+	for _, n := range g.nodes {
+		fmt.Fprintf(&b, "  %q [label=%q];\n", n, label(n, status, "\n"))
+	}
+
+	for _, n := range g.nodes {
+		for _, d := range g.dependents[n] {
+			fmt.Fprintf(&b, "  %q -> %q;\n", n, d)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid - renders the graph as a Mermaid flowchart
+func (g *Graph) Mermaid(status map[string]string) string {
+	var b bytes.Buffer
+	id := func(n string) string {
+		return graphIDRegex.ReplaceAllString(n, "_")
+	}
+
+	b.WriteString("graph LR\n")
+	for _, n := range g.nodes {
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", id(n), label(n, status, "<br/>"))
+	}
+
+	for _, n := range g.nodes {
+		for _, d := range g.dependents[n] {
+			fmt.Fprintf(&b, "  %s --> %s\n", id(n), id(d))
+		}
+	}
+	return b.String()
+}
+
+// ASCII - renders the graph as a list of deployment waves
+func (g *Graph) ASCII(status map[string]string) string {
+	var b bytes.Buffer
+	for i, wave := range g.Waves() {
+		fmt.Fprintf(&b, "wave %d:\n", i+1)
+		for _, n := range wave {
+			fmt.Fprintf(&b, "  %s", label(n, status, " - "))
+			if deps := g.deps[n]; len(deps) > 0 {
+				fmt.Fprintf(&b, " <- [%s]", strings.Join(deps, ", "))
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
@@ -1,6 +1,7 @@
 package stacks
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -8,53 +9,103 @@ import (
 	"github.com/daidokoro/qaz/log"
 )
 
-// cleanup functions in create_failed or delete_failed states
-func (s *Stack) cleanup() error {
+// cleanup - deletes stacks that failed to create so they can be recreated,
+// returns an error for stacks that must be recovered before deploying
+func (s *Stack) cleanup(ctx context.Context) error {
 	log.Debug("running stack cleanup on [%s]", s.Name)
-	resp, err := s.State()
+	status, err := s.StackStatus()
 	if err != nil {
 		return err
 	}
 
-	if resp == state.failed {
-		if err := s.terminate(); err != nil {
-			return err
-		}
+	switch {
+	case recreateStatuses[status]:
+		log.Warn("stack [%s] is in %s, deleting it before deploying", s.Name, status)
+		return s.terminate(ctx)
+	case Recoverable(status):
+		return fmt.Errorf("stack [%s] is in %s, use [qaz recover %s] before deploying", s.Name, status, s.Name)
 	}
 	return nil
 }
 
-// bucket
-func resolveBucket(s *Stack) (string, error) {
-	exists, err := bucket.Exists(s.Bucket, s.Session)
+// ensureBucket - creates the stack bucket if it does not exist
+func (s *Stack) ensureBucket() error {
+	exists, err := bucket.Exists(s.Bucket, s.Session, s.Clients)
 	if err != nil {
 		log.Warn("Received Error when checking if [%s] exists: %v", s.Bucket, err)
 	}
-	fmt.Println("This is test")
+
 	if !exists {
 		log.Info(("Creating Bucket [%s]"), s.Bucket)
-		if err = bucket.Create(s.Bucket, s.Session); err != nil {
-			return "", err
-		}
+		return s.Bootstrap(false)
 	}
-	t := time.Now()
-	tStamp := fmt.Sprintf("%d-%d-%d_%d%d", t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute())
-	url, err := bucket.S3write(s.Bucket, fmt.Sprintf("%s_%s.template", s.Stackname, tStamp), s.Template, s.Session)
+	return nil
+}
+
+// resolveBucket - uploads the stack template to the stack bucket under a content-hash
+// key, creating the bucket if it does not exist, and returns the template url
+func resolveBucket(s *Stack) (string, error) {
+	if err := s.ensureBucket(); err != nil {
+		return "", err
+	}
+
+	key := s.templateKey()
+	uploaded, err := bucket.Upload(s.Bucket, key, []byte(s.Template), s.Artifacts.encryption(), s.Session, s.Clients)
 	if err != nil {
 		return "", err
 	}
-	return url, nil
+
+	if uploaded {
+		log.Debug("template uploaded: [s3://%s/%s]", s.Bucket, key)
+	}
+	return bucket.ObjectURL(s.Bucket, key, s.Session), nil
+}
+
+// waitLeaveWithContext - waits until the status is no longer from or the
+// context is cancelled, used when from is also a terminal status
+func waitLeaveWithContext(ctx context.Context, getStatus func(s ...string) (string, error), from string) error {
+	tick := time.NewTicker(time.Millisecond * 1500)
+	defer tick.Stop()
+
+	for {
+		stat, err := getStatus()
+		if err != nil {
+			return err
+		}
+
+		if stat != from {
+			return nil
+		}
+
+		log.Debug("waiting for status to change from [%s]", from)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
 }
 
 // Wait - wait Until status is complete
 func Wait(getStatus func(s ...string) (string, error), args ...string) error {
+	return WaitWithContext(context.Background(), getStatus, args...)
+}
+
+// WaitWithContext - wait Until status is complete or the context is cancelled
+func WaitWithContext(ctx context.Context, getStatus func(s ...string) (string, error), args ...string) error {
 	tick := time.NewTicker(time.Millisecond * 1500)
 	defer tick.Stop()
 
 	var stat string
 	var err error
 
-	for range tick.C {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+
 		if len(args) > 0 {
 			stat, err = getStatus(args[0])
 		} else {
@@ -74,12 +125,13 @@ func Wait(getStatus func(s ...string) (string, error), args ...string) error {
 			"DELETE_FAILED",
 			"CREATE_FAILED",
 			"ROLLBACK_COMPLETE",
-			"UPDATE_ROLLBACK_COMPLETE":
+			"UPDATE_ROLLBACK_COMPLETE",
+			"IMPORT_COMPLETE",
+			"IMPORT_ROLLBACK_FAILED",
+			"IMPORT_ROLLBACK_COMPLETE":
 			return nil
 		default:
 			continue
 		}
 	}
-
-	return nil
 }
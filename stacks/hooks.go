@@ -0,0 +1,375 @@
+package stacks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/daidokoro/qaz/log"
+)
+
+// hook events
+const (
+	HookPreDeploy     = "pre_deploy"
+	HookPostDeploy    = "post_deploy"
+	HookPreUpdate     = "pre_update"
+	HookPostUpdate    = "post_update"
+	HookPreTerminate  = "pre_terminate"
+	HookPostTerminate = "post_terminate"
+)
+
+// hook failure policies
+const (
+	HookAbort    = "abort"
+	HookWarn     = "warn"
+	HookRollback = "rollback"
+)
+
+// Hooks - commands & lambda functions run before and after stack operations
+type Hooks struct {
+	PreDeploy     []Hook `yaml:"pre_deploy,omitempty" json:"pre_deploy,omitempty" hcl:"pre_deploy,omitempty"`
+	PostDeploy    []Hook `yaml:"post_deploy,omitempty" json:"post_deploy,omitempty" hcl:"post_deploy,omitempty"`
+	PreUpdate     []Hook `yaml:"pre_update,omitempty" json:"pre_update,omitempty" hcl:"pre_update,omitempty"`
+	PostUpdate    []Hook `yaml:"post_update,omitempty" json:"post_update,omitempty" hcl:"post_update,omitempty"`
+	PreTerminate  []Hook `yaml:"pre_terminate,omitempty" json:"pre_terminate,omitempty" hcl:"pre_terminate,omitempty"`
+	PostTerminate []Hook `yaml:"post_terminate,omitempty" json:"post_terminate,omitempty" hcl:"post_terminate,omitempty"`
+}
+
+// Hook - a local command or lambda function, hooks run in order and
+// on_failure defaults to abort
+type Hook struct {
+	Cmd       string `yaml:"cmd,omitempty" json:"cmd,omitempty" hcl:"cmd,omitempty"`
+	Lambda    string `yaml:"lambda,omitempty" json:"lambda,omitempty" hcl:"lambda,omitempty"`
+	OnFailure string `yaml:"on_failure,omitempty" json:"on_failure,omitempty" hcl:"on_failure,omitempty"`
+}
+
+// HookPayload - passed to lambda hooks as JSON and to command hooks as
+// QAZ_* environment variables
+type HookPayload struct {
+	Event     string            `json:"event"`
+	Project   string            `json:"project"`
+	Stack     string            `json:"stack"`
+	Stackname string            `json:"stackname"`
+	Region    string            `json:"region"`
+	Outputs   map[string]string `json:"outputs"`
+}
+
+// Env - returns the payload as environment variables, outputs are
+// exposed as QAZ_OUTPUT_<KEY>
+func (p *HookPayload) Env() []string {
+	env := []string{
+		"QAZ_EVENT=" + p.Event,
+		"QAZ_PROJECT=" + p.Project,
+		"QAZ_STACK=" + p.Stack,
+		"QAZ_STACKNAME=" + p.Stackname,
+		"QAZ_REGION=" + p.Region,
+	}
+
+	keys := make([]string, 0, len(p.Outputs))
+	for k := range p.Outputs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		env = append(env, fmt.Sprintf("QAZ_OUTPUT_%s=%s", strings.ToUpper(k), p.Outputs[k]))
+	}
+	return env
+}
+
+// get - returns the hooks for the given event
+func (h *Hooks) get(event string) []Hook {
+	if h == nil {
+		return nil
+	}
+
+	switch event {
+	case HookPreDeploy:
+		return h.PreDeploy
+	case HookPostDeploy:
+		return h.PostDeploy
+	case HookPreUpdate:
+		return h.PreUpdate
+	case HookPostUpdate:
+		return h.PostUpdate
+	case HookPreTerminate:
+		return h.PreTerminate
+	case HookPostTerminate:
+		return h.PostTerminate
+	}
+	return nil
+}
+
+// rollback - returns true if any hook of the event rolls back on failure
+func (h *Hooks) rollback(event string) bool {
+	for _, hk := range h.get(event) {
+		if hk.OnFailure == HookRollback {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate - checks that each hook defines either cmd or lambda and a
+// valid failure policy, rollback is only valid for post deploy & update hooks
+func (h *Hooks) Validate() error {
+	for _, event := range []string{HookPreDeploy, HookPostDeploy, HookPreUpdate, HookPostUpdate, HookPreTerminate, HookPostTerminate} {
+		for i, hk := range h.get(event) {
+			if (hk.Cmd == "") == (hk.Lambda == "") {
+				return fmt.Errorf("%s hook %d: specify either cmd or lambda", event, i+1)
+			}
+
+			switch hk.OnFailure {
+			case "", HookAbort, HookWarn:
+			case HookRollback:
+				if event != HookPostDeploy && event != HookPostUpdate {
+					return fmt.Errorf("%s hook %d: on_failure [%s] is only valid for %s & %s hooks", event, i+1, hk.OnFailure, HookPostDeploy, HookPostUpdate)
+				}
+			default:
+				return fmt.Errorf("%s hook %d: invalid on_failure [%s], must be one of: %s, %s, %s", event, i+1, hk.OnFailure, HookAbort, HookWarn, HookRollback)
+			}
+		}
+	}
+	return nil
+}
+
+// hookPayload - returns the hook payload for the stack, outputs are
+// included if the stack is deployed
+func (s *Stack) hookPayload(event string) (*HookPayload, error) {
+	p := &HookPayload{
+		Event:     event,
+		Stack:     s.Name,
+		Stackname: s.Stackname,
+		Region:    s.region(),
+		Outputs:   make(map[string]string),
+	}
+
+	if s.Project != nil {
+		p.Project = *s.Project
+	}
+
+	if s.IsStackSet() || event == HookPostTerminate {
+		return p, nil
+	}
+
+	stk, err := s.describe()
+	if err != nil {
+		return nil, err
+	}
+
+	if stk != nil {
+		for _, o := range stk.Outputs {
+			p.Outputs[aws.StringValue(o.OutputKey)] = aws.StringValue(o.OutputValue)
+		}
+	}
+	return p, nil
+}
+
+// run - runs the hook with the given payload
+func (hk Hook) run(ctx context.Context, s *Stack, p *HookPayload) error {
+	if hk.Lambda != "" {
+		payload, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+
+		f := awslambda{name: hk.Lambda, payload: payload}
+		return f.Invoke(s.Session, s.Clients)
+	}
+
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+
+	cmd := exec.CommandContext(ctx, shell, flag, hk.Cmd)
+	cmd.Env = append(os.Environ(), p.Env()...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// runHooks - runs the hooks of the given event in order. Hooks with the warn
+// policy log failures and continue, otherwise the first failure is returned
+// with its policy.
+func (s *Stack) runHooks(ctx context.Context, event string) (string, error) {
+	hooks := s.Hooks.get(event)
+	if len(hooks) == 0 {
+		return "", nil
+	}
+
+	p, err := s.hookPayload(event)
+	if err != nil {
+		return HookAbort, fmt.Errorf("failed to build %s hook payload for [%s]: %v", event, s.Name, err)
+	}
+
+	for _, hk := range hooks {
+		name := hk.Cmd
+		if hk.Lambda != "" {
+			name = "lambda:" + hk.Lambda
+		}
+
+		log.Info("running %s hook for [%s]: %s", event, s.Name, name)
+		err := hk.run(ctx, s, p)
+		if err == nil {
+			continue
+		}
+
+		policy := hk.OnFailure
+		if policy == "" {
+			policy = HookAbort
+		}
+
+		if policy == HookWarn {
+			log.Warn("%s hook failed for [%s]: %s - %v", event, s.Name, name, err)
+			continue
+		}
+
+		return policy, fmt.Errorf("%s hook failed for [%s]: %s - %v", event, s.Name, name, err)
+	}
+	return "", nil
+}
+
+// snapshot - template & parameters of a deployed stack, used to
+// restore the stack if a post hook fails with the rollback policy
+type snapshot struct {
+	template   string
+	parameters []*cloudformation.Parameter
+}
+
+// snapshot - returns the current template & parameters of the stack
+func (s *Stack) snapshot(ctx context.Context) (*snapshot, error) {
+	svc := s.cfn()
+	params := &cloudformation.GetTemplateInput{
+		StackName:     aws.String(s.Stackname),
+		TemplateStage: aws.String(cloudformation.TemplateStageOriginal),
+	}
+
+	log.Debug("calling [GetTemplate] with parameters: %s", params)
+	resp, err := svc.GetTemplateWithContext(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	stk, err := s.describe()
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &snapshot{template: aws.StringValue(resp.TemplateBody)}
+	if stk != nil {
+		for _, p := range stk.Parameters {
+			// NoEcho values are masked and are left unchanged on restore
+			if aws.StringValue(p.ParameterValue) == "****" {
+				log.Warn("parameter [%s] of [%s] is NoEcho, the current value is kept on rollback", aws.StringValue(p.ParameterKey), s.Name)
+				snap.parameters = append(snap.parameters, &cloudformation.Parameter{
+					ParameterKey:     p.ParameterKey,
+					UsePreviousValue: aws.Bool(true),
+				})
+				continue
+			}
+
+			snap.parameters = append(snap.parameters, &cloudformation.Parameter{
+				ParameterKey:   p.ParameterKey,
+				ParameterValue: p.ParameterValue,
+			})
+		}
+	}
+	return snap, nil
+}
+
+// restore - updates the stack back to the snapshot template & parameters
+func (s *Stack) restore(ctx context.Context, snap *snapshot) error {
+	svc := s.cfn()
+	params := &cloudformation.UpdateStackInput{
+		StackName:    aws.String(s.Stackname),
+		TemplateBody: aws.String(snap.template),
+		Parameters:   snap.parameters,
+		RoleARN:      s.roleARN(),
+		Capabilities: []*string{
+			aws.String(cloudformation.CapabilityCapabilityIam),
+			aws.String(cloudformation.CapabilityCapabilityNamedIam),
+			aws.String(cloudformation.CapabilityCapabilityAutoExpand),
+		},
+	}
+
+	log.Debug("calling [UpdateStack] with parameters: %s", params)
+	if _, err := svc.UpdateStackWithContext(ctx, params); err != nil {
+		return err
+	}
+
+	stop := s.tail(ctx)
+	defer stop()
+
+	return svc.WaitUntilStackUpdateCompleteWithContext(ctx, &cloudformation.DescribeStacksInput{
+		StackName: aws.String(s.Stackname),
+	})
+}
+
+// hookRollback - rolls back a stack after a failed post hook, stacks created
+// in this run are terminated, updated stacks are restored to the snapshot
+func (s *Stack) hookRollback(ctx context.Context, res string, snap *snapshot) error {
+	switch {
+	case s.IsStackSet():
+		log.Warn("rollback is not supported for stacksets, [%s] left as deployed", s.Name)
+		return nil
+	case res == ActionCreated:
+		log.Warn("rolling back [%s]: terminating stack", s.Name)
+		return s.terminate(ctx)
+	case res == ActionUpdated && snap != nil:
+		log.Warn("rolling back [%s]: restoring previous template", s.Name)
+		return s.restore(ctx, snap)
+	}
+
+	log.Warn("nothing to roll back for [%s]", s.Name)
+	return nil
+}
+
+// withHooks - wraps a handler action with the pre & post hooks of an operation,
+// a snapshot for rollback is taken before the action if required by the post hooks
+func withHooks(ctx context.Context, pre, post string, fn func(*Stack) (string, error)) func(*Stack) (string, error) {
+	return func(s *Stack) (string, error) {
+		return s.hooked(ctx, pre, post, fn)
+	}
+}
+
+// hooked - runs fn for the stack between its pre & post hooks
+func (s *Stack) hooked(ctx context.Context, pre, post string, fn func(*Stack) (string, error)) (string, error) {
+	if _, err := s.runHooks(ctx, pre); err != nil {
+		return "", err
+	}
+
+	var snap *snapshot
+	if s.Hooks.rollback(post) && !s.IsStackSet() && s.StackExists() {
+		var err error
+		if snap, err = s.snapshot(ctx); err != nil {
+			return "", fmt.Errorf("failed to snapshot [%s] for hook rollback: %v", s.Name, err)
+		}
+	}
+
+	res, err := fn(s)
+	if err != nil {
+		return res, err
+	}
+
+	policy, err := s.runHooks(ctx, post)
+	if err == nil {
+		return res, nil
+	}
+
+	log.Error(err.Error())
+	if policy == HookRollback {
+		if rerr := s.hookRollback(ctx, res, snap); rerr != nil {
+			return "", fmt.Errorf("%v; rollback failed: %v", err, rerr)
+		}
+		return "", fmt.Errorf("%v; stack rolled back", err)
+	}
+	return "", err
+}
@@ -0,0 +1,155 @@
+package stacks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/daidokoro/qaz/log"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ImportMapping - resources to import, maps template logical IDs
+// to the identifier properties of existing resources, e.g.
+//
+//	Bucket:
+//	  BucketName: my-existing-bucket
+type ImportMapping map[string]map[string]string
+
+// LoadImportMapping - parses a yaml or json resources-to-import mapping
+func LoadImportMapping(b []byte) (ImportMapping, error) {
+	var m ImportMapping
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse import mapping: %v", err)
+	}
+
+	if len(m) == 0 {
+		return nil, fmt.Errorf("import mapping contains no resources")
+	}
+	return m, nil
+}
+
+// templateResource - resource fields of a template needed for imports
+type templateResource struct {
+	Type           string `yaml:"Type"`
+	DeletionPolicy string `yaml:"DeletionPolicy"`
+}
+
+// ResourcesToImport - validates the mapping against the rendered template and
+// returns the resources to import. Each mapped resource must be defined in the
+// template with a DeletionPolicy and at least one identifier property.
+func ResourcesToImport(tpl string, m ImportMapping) ([]*cloudformation.ResourceToImport, error) {
+	var t struct {
+		Resources map[string]templateResource `yaml:"Resources"`
+	}
+
+	if err := yaml.Unmarshal([]byte(tpl), &t); err != nil {
+		return nil, fmt.Errorf("failed to parse template resources: %v", err)
+	}
+
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var (
+		resources []*cloudformation.ResourceToImport
+		errs      []string
+	)
+
+	for _, id := range ids {
+		r, ok := t.Resources[id]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Sprintf("resource [%s] is not defined in template", id))
+			continue
+		case r.DeletionPolicy == "":
+			errs = append(errs, fmt.Sprintf("resource [%s] must have a DeletionPolicy to be imported", id))
+		case len(m[id]) == 0:
+			errs = append(errs, fmt.Sprintf("resource [%s] has no identifier properties", id))
+		}
+
+		resources = append(resources, &cloudformation.ResourceToImport{
+			LogicalResourceId:  aws.String(id),
+			ResourceType:       aws.String(r.Type),
+			ResourceIdentifier: aws.StringMap(m[id]),
+		})
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid import mapping:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return resources, nil
+}
+
+// Import - creates an IMPORT change-set for the resources in s.Imports, prints
+// the planned changes and executes it
+func (s *Stack) Import(ctx context.Context, changename string) error {
+	if _, err := s.ImportPlan(ctx, changename); err != nil {
+		return err
+	}
+	return s.ExecuteImport(ctx, changename)
+}
+
+// ImportPlan - creates an IMPORT change-set for the resources in s.Imports and
+// prints the planned changes, the change-set is not executed
+func (s *Stack) ImportPlan(ctx context.Context, changename string) ([]*cloudformation.Change, error) {
+	if len(s.Imports) == 0 {
+		return nil, fmt.Errorf("no resources to import for stack [%s]", s.Name)
+	}
+
+	resp, err := s.createChangeSet(ctx, changename, cloudformation.ChangeSetTypeImport)
+	if err != nil {
+		return nil, err
+	}
+
+	if aws.StringValue(resp.Status) == cloudformation.ChangeSetStatusFailed {
+		return nil, fmt.Errorf("import change-set [%s] failed: %s", changename, aws.StringValue(resp.StatusReason))
+	}
+
+	for _, c := range resp.Changes {
+		if rc := c.ResourceChange; rc != nil {
+			log.Info("%s - %s - %s [%s]", log.ColorMap(aws.StringValue(rc.Action)), aws.StringValue(rc.ResourceType), aws.StringValue(rc.LogicalResourceId), aws.StringValue(rc.PhysicalResourceId))
+		}
+	}
+	return resp.Changes, nil
+}
+
+// ExecuteImport - executes an IMPORT change-set created by ImportPlan and
+// waits for the import to complete
+func (s *Stack) ExecuteImport(ctx context.Context, changename string) error {
+	svc := s.cfn()
+	params := &cloudformation.ExecuteChangeSetInput{
+		StackName:     aws.String(s.Stackname),
+		ChangeSetName: aws.String(changename),
+	}
+
+	start := time.Now()
+	log.Debug("calling [ExecuteChangeSet] with parameters: %s", params)
+	if _, err := svc.ExecuteChangeSetWithContext(ctx, params); err != nil {
+		return err
+	}
+
+	stop := s.tail(ctx)
+	defer stop()
+
+	// the stack is in a terminal status before the import starts, so only
+	// the IMPORT_* statuses of the waiter mark the end of the import
+	describeStacksInput := &cloudformation.DescribeStacksInput{
+		StackName: aws.String(s.Stackname),
+	}
+	log.Debug("calling [WaitUntilStackImportComplete] with parameters: %s", describeStacksInput)
+	if err := svc.WaitUntilStackImportCompleteWithContext(ctx, describeStacksInput); err != nil {
+		stop()
+		return s.failed(ctx, start, err)
+	}
+
+	log.Info("import completed: [%s]", s.Stackname)
+	return nil
+}
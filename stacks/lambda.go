@@ -6,6 +6,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/daidokoro/qaz/clients"
 	"github.com/daidokoro/qaz/log"
 )
 
@@ -15,8 +16,8 @@ type awslambda struct {
 	response string
 }
 
-func (a *awslambda) Invoke(sess *session.Session) error {
-	svc := lambda.New(sess)
+func (a *awslambda) Invoke(sess *session.Session, p clients.Provider) error {
+	svc := clients.Default(p).Lambda(sess)
 
 	params := &lambda.InvokeInput{
 		FunctionName: aws.String(a.name),
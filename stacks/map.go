@@ -8,7 +8,6 @@ import (
 	"text/template"
 
 	"github.com/daidokoro/qaz/log"
-	"github.com/daidokoro/qaz/utils"
 )
 
 // Map type
@@ -64,27 +63,32 @@ func (m *Map) Count() int {
 
 // --- Template Functions for StackMap --- //
 
-// StackOutput - stack output reader for template function
-func (m *Map) StackOutput(target string) string {
+// StackOutput - stack output reader for template function, target is
+// given as stack::output
+func (m *Map) StackOutput(target string) (string, error) {
 	log.Debug("Deploy-Time function resolving: %s", target)
 	req := strings.Split(target, "::")
+	if len(req) != 2 {
+		return "", fmt.Errorf("stack_output error: invalid target [%s], must be stack::output", target)
+	}
 
 	s, ok := m.Get(req[0])
 	if !ok {
-		utils.HandleError(fmt.Errorf("stack_output errror: stack [%s] not found", req[0]))
+		return "", fmt.Errorf("stack_output error: stack [%s] not found", req[0])
 	}
 
-	utils.HandleError(s.Outputs())
+	if err := s.Outputs(); err != nil {
+		return "", err
+	}
 
 	for _, i := range s.Output.Stacks {
 		for _, o := range i.Outputs {
 			if *o.OutputKey == req[1] {
-				return *o.OutputValue
+				return *o.OutputValue, nil
 			}
 		}
 	}
-	utils.HandleError(fmt.Errorf("Stack Output Not found - Stack:%s | Output:%s", req[0], req[1]))
-	return ""
+	return "", fmt.Errorf("Stack Output Not found - Stack:%s | Output:%s", req[0], req[1])
 }
 
 // AddMapFuncs - add stack map functions to function map
@@ -92,43 +96,6 @@ func (m *Map) StackOutput(target string) string {
 // that require access to stack data at runtime.
 func (m *Map) AddMapFuncs(t template.FuncMap) {
 	// Fetching stackoutputs
-	t["stack_output"] = func(target string) string {
-		log.Debug("Deploy-Time function resolving: %s", target)
-		req := strings.Split(target, "::")
-
-		s, ok := m.Get(req[0])
-		if !ok {
-			utils.HandleError(fmt.Errorf("stack_output errror: stack [%s] not found", req[0]))
-		}
-
-		utils.HandleError(s.Outputs())
-
-		for _, i := range s.Output.Stacks {
-			for _, o := range i.Outputs {
-				if *o.OutputKey == req[1] {
-					return *o.OutputValue
-				}
-			}
-		}
-		utils.HandleError(fmt.Errorf("Stack Output Not found - Stack:%s | Output:%s", req[0], req[1]))
-		return ""
-	}
-
-	t["stack_output_ext"] = func(target string) string {
-		log.Debug("Deploy-Time function resolving: %s", target)
-		req := strings.Split(target, "::")
-		s := m.MustGet(req[0])
-		utils.HandleError(s.Outputs())
-
-		for _, i := range s.Output.Stacks {
-			for _, o := range i.Outputs {
-				if *o.OutputKey == req[1] {
-					return *o.OutputValue
-				}
-			}
-		}
-
-		utils.HandleError(fmt.Errorf("Stack Output Not found - Stack:%s | Output:%s", req[0], req[1]))
-		return ""
-	}
+	t["stack_output"] = m.StackOutput
+	t["stack_output_ext"] = m.StackOutput
 }
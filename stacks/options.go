@@ -0,0 +1,171 @@
+package stacks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/daidokoro/qaz/log"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// maximum rollback trigger monitoring time, in minutes
+const maxMonitoringTime = 180
+
+// RollbackTriggers - CloudWatch alarms monitored during stack create & update,
+// the operation is rolled back if any alarm goes to ALARM state
+type RollbackTriggers struct {
+	Alarms []string `yaml:"alarms" json:"alarms" hcl:"alarms"`
+
+	// MonitoringTime - minutes to monitor alarms after resources are deployed
+	MonitoringTime int64 `yaml:"monitoring_time,omitempty" json:"monitoring_time,omitempty" hcl:"monitoring_time,omitempty"`
+}
+
+// validateOptions - checks capabilities, on_failure, rollback_triggers & role_arn
+func (c StackConfig) validateOptions() error {
+	for _, cp := range c.Capabilities {
+		switch cp {
+		case cloudformation.CapabilityCapabilityIam,
+			cloudformation.CapabilityCapabilityNamedIam,
+			cloudformation.CapabilityCapabilityAutoExpand:
+		default:
+			return fmt.Errorf("invalid capability [%s], must be one of: %s, %s, %s", cp,
+				cloudformation.CapabilityCapabilityIam, cloudformation.CapabilityCapabilityNamedIam, cloudformation.CapabilityCapabilityAutoExpand)
+		}
+	}
+
+	switch c.OnFailure {
+	case "", cloudformation.OnFailureDoNothing, cloudformation.OnFailureRollback, cloudformation.OnFailureDelete:
+	default:
+		return fmt.Errorf("invalid on_failure [%s], must be one of: %s, %s, %s", c.OnFailure,
+			cloudformation.OnFailureDoNothing, cloudformation.OnFailureRollback, cloudformation.OnFailureDelete)
+	}
+
+	if t := c.RollbackTriggers; t != nil {
+		if len(t.Alarms) > 5 {
+			return fmt.Errorf("rollback_triggers supports up to 5 alarms, got %d", len(t.Alarms))
+		}
+
+		for _, a := range t.Alarms {
+			if !strings.HasPrefix(a, "arn:") {
+				return fmt.Errorf("rollback_triggers alarm [%s] must be an alarm ARN", a)
+			}
+		}
+
+		if t.MonitoringTime < 0 || t.MonitoringTime > maxMonitoringTime {
+			return fmt.Errorf("rollback_triggers monitoring_time must be between 0 and %d minutes", maxMonitoringTime)
+		}
+	}
+
+	if c.RoleARN != "" && !strings.HasPrefix(c.RoleARN, "arn:") {
+		return fmt.Errorf("role_arn [%s] must be an IAM role ARN", c.RoleARN)
+	}
+	return nil
+}
+
+// capabilities - returns the configured capabilities, if none are configured
+// capabilities are inferred from the resource types & transforms of the template
+func (s *Stack) capabilities() []*string {
+	if len(s.Capabilities) > 0 {
+		return aws.StringSlice(s.Capabilities)
+	}
+
+	caps := InferCapabilities(s.Template)
+	if len(caps) > 0 {
+		log.Debug("inferred capabilities for [%s]: %s", s.Name, caps)
+	}
+	return aws.StringSlice(caps)
+}
+
+// InferCapabilities - returns the capabilities required by the template's resources,
+// IAM resources require IAM capabilities, transforms & nested stacks also require
+// AUTO_EXPAND. Templates that can't be parsed fall back to matching resource types
+// in the template body.
+func InferCapabilities(tpl string) []string {
+	var t struct {
+		Transform interface{} `yaml:"Transform"`
+		Resources map[string]struct {
+			Type string `yaml:"Type"`
+		} `yaml:"Resources"`
+	}
+
+	var iam, expand bool
+	if err := yaml.Unmarshal([]byte(tpl), &t); err != nil {
+		log.Debug("failed to parse template for capabilities, matching resource types: %v", err)
+		iam = strings.Contains(tpl, iamCapable) || strings.Contains(tpl, transformCapable)
+		expand = strings.Contains(tpl, transformCapable)
+	} else {
+		expand = t.Transform != nil || strings.Contains(tpl, "Fn::Transform")
+		for _, r := range t.Resources {
+			switch {
+			case strings.HasPrefix(r.Type, iamCapable+"::"):
+				iam = true
+			case strings.HasPrefix(r.Type, transformCapable+"::"), r.Type == "AWS::CloudFormation::Stack":
+				iam, expand = true, true
+			}
+		}
+	}
+
+	var caps []string
+	if iam || expand {
+		caps = append(caps, cloudformation.CapabilityCapabilityIam, cloudformation.CapabilityCapabilityNamedIam)
+	}
+
+	if expand {
+		caps = append(caps, cloudformation.CapabilityCapabilityAutoExpand)
+	}
+
+	sort.Strings(caps)
+	return caps
+}
+
+// rollbackConfiguration - returns the rollback configuration for create,
+// update & change-set calls, nil if no rollback triggers are configured
+func (s *Stack) rollbackConfiguration() *cloudformation.RollbackConfiguration {
+	if s.RollbackTriggers == nil {
+		return nil
+	}
+
+	cfg := &cloudformation.RollbackConfiguration{}
+	if s.RollbackTriggers.MonitoringTime > 0 {
+		cfg.MonitoringTimeInMinutes = aws.Int64(s.RollbackTriggers.MonitoringTime)
+	}
+
+	for _, a := range s.RollbackTriggers.Alarms {
+		cfg.RollbackTriggers = append(cfg.RollbackTriggers, &cloudformation.RollbackTrigger{
+			Arn:  aws.String(a),
+			Type: aws.String("AWS::CloudWatch::Alarm"),
+		})
+	}
+	return cfg
+}
+
+// roleARN - returns the CloudFormation service role, nil if not set
+func (s *Stack) roleARN() *string {
+	if s.RoleARN == "" {
+		return nil
+	}
+	return aws.String(s.RoleARN)
+}
+
+// applyTerminationProtection - sets termination protection on the deployed
+// stack if configured, protection is left unchanged if not set
+func (s *Stack) applyTerminationProtection(ctx context.Context) error {
+	if s.TerminationProtection == nil {
+		return nil
+	}
+
+	svc := s.cfn()
+	params := &cloudformation.UpdateTerminationProtectionInput{
+		EnableTerminationProtection: s.TerminationProtection,
+		StackName:                   aws.String(s.Stackname),
+	}
+
+	log.Debug("calling [UpdateTerminationProtection] with parameters: %s", params)
+	_, err := svc.UpdateTerminationProtectionWithContext(ctx, params)
+	return err
+}
@@ -11,7 +11,7 @@ import (
 // Outputs - Get Stack outputs
 func (s *Stack) Outputs() error {
 
-	svc := cloudformation.New(s.Session, &aws.Config{Credentials: s.creds()})
+	svc := s.cfn()
 	outputParams := &cloudformation.DescribeStacksInput{
 		StackName: aws.String(s.Stackname),
 	}
@@ -0,0 +1,402 @@
+package stacks
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/daidokoro/qaz/bucket"
+	"github.com/daidokoro/qaz/log"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// key prefix of packaged artifacts in the stack bucket
+const assetPrefix = "assets"
+
+// fixed modification time of zipped files, so that zips of
+// the same content produce the same content hash
+var zipModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// artifact kinds, determines how a local path is packaged and referenced
+const (
+	artifactCode     = "code"     // AWS::Lambda::Function Code, zipped, {S3Bucket, S3Key}
+	artifactCodeURI  = "code_uri" // AWS::Serverless::Function CodeUri, zipped, s3 uri
+	artifactTemplate = "template" // AWS::CloudFormation::Stack TemplateURL, packaged, https url
+	artifactInclude  = "include"  // AWS::Include Location, uploaded as is, s3 uri
+)
+
+// artifact - local path referenced by a template property
+type artifact struct {
+	property string
+	path     string
+	kind     string
+}
+
+// Uploader - uploads a packaged artifact to the given key
+type Uploader func(key string, body []byte) error
+
+// Packager - packages local artifacts referenced in templates, artifacts
+// are uploaded under Prefix. Template urls are resolved by Session, if set.
+type Packager struct {
+	Bucket  string
+	Region  string
+	Prefix  string
+	Upload  Uploader
+	Session *session.Session
+}
+
+// Package - uploads local artifacts referenced in the rendered template to the
+// stack bucket and rewrites the template to reference the uploaded objects
+func (s *Stack) Package() error {
+	// the bucket is created before the first upload, so that stacks
+	// without artifacts don't require one
+	var ready bool
+	p := &Packager{
+		Bucket:  s.Bucket,
+		Region:  s.region(),
+		Prefix:  s.Artifacts.key(),
+		Session: s.Session,
+		Upload: func(key string, body []byte) error {
+			if !ready {
+				if err := s.ensureBucket(); err != nil {
+					return err
+				}
+				ready = true
+			}
+
+			uploaded, err := bucket.Upload(s.Bucket, key, body, s.Artifacts.encryption(), s.Session, s.Clients)
+			if uploaded {
+				log.Info("artifact uploaded: [s3://%s/%s]", s.Bucket, key)
+			}
+			return err
+		},
+	}
+
+	// local paths are relative to the template source
+	dir := "."
+	if u, err := url.Parse(s.Source); err == nil && u.Scheme == "" && s.Source != "" {
+		dir = filepath.Dir(s.Source)
+	}
+
+	tpl, err := p.Template(s.Template, dir)
+	if err != nil {
+		return fmt.Errorf("failed to package [%s]: %v", s.Name, err)
+	}
+
+	s.Template = tpl
+	return nil
+}
+
+// Template - packages the local artifacts of tpl, paths are relative to dir,
+// and returns the rewritten template. Templates without local artifacts, or
+// that can't be parsed, are returned unchanged.
+func (p *Packager) Template(tpl, dir string) (string, error) {
+	artifacts, err := localArtifacts(tpl, dir)
+	if err != nil {
+		log.Debug("skipping packaging: %v", err)
+		return tpl, nil
+	}
+
+	if len(artifacts) == 0 {
+		return tpl, nil
+	}
+
+	if p.Bucket == "" {
+		var paths []string
+		for _, a := range artifacts {
+			paths = append(paths, a.path)
+		}
+		return "", fmt.Errorf("template references local artifacts %s, a bucket is required for packaging", paths)
+	}
+
+	for _, a := range artifacts {
+		ref, err := p.artifact(a, dir)
+		if err != nil {
+			return "", err
+		}
+		tpl = rewriteProperty(tpl, a.property, a.path, ref)
+	}
+	return tpl, nil
+}
+
+// artifact - packages & uploads a single artifact, returns the
+// JSON encoded reference that replaces the local path
+func (p *Packager) artifact(a artifact, dir string) (string, error) {
+	file := localPath(a.path, dir)
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", fmt.Errorf("%s [%s] is not a valid local path: %v", a.property, a.path, err)
+	}
+
+	var body []byte
+	ext := strings.ToLower(filepath.Ext(file))
+
+	switch {
+	case a.kind == artifactTemplate:
+		if info.IsDir() {
+			return "", fmt.Errorf("%s [%s] must be a template file", a.property, a.path)
+		}
+
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+
+		// nested templates are packaged relative to their own directory
+		nested, err := p.Template(string(b), filepath.Dir(file))
+		if err != nil {
+			return "", err
+		}
+		body = []byte(nested)
+
+	case a.kind == artifactInclude || (!info.IsDir() && (ext == ".zip" || ext == ".jar")):
+		if info.IsDir() {
+			return "", fmt.Errorf("%s [%s] must be a file", a.property, a.path)
+		}
+
+		if body, err = ioutil.ReadFile(file); err != nil {
+			return "", err
+		}
+
+	default:
+		if body, err = Zip(file); err != nil {
+			return "", err
+		}
+		ext = ".zip"
+	}
+
+	sum := sha256.Sum256(body)
+	key := path.Join(p.Prefix, assetPrefix, hex.EncodeToString(sum[:])+ext)
+	if err := p.Upload(key, body); err != nil {
+		return "", err
+	}
+
+	var ref interface{}
+	switch a.kind {
+	case artifactCode:
+		ref = map[string]string{"S3Bucket": p.Bucket, "S3Key": key}
+	case artifactTemplate:
+		ref = bucket.URL(p.Bucket, key, p.Region)
+		if p.Session != nil {
+			ref = bucket.ObjectURL(p.Bucket, key, p.Session)
+		}
+	default:
+		ref = fmt.Sprintf("s3://%s/%s", p.Bucket, key)
+	}
+
+	b, err := json.Marshal(ref)
+	return string(b), err
+}
+
+// localArtifacts - returns the local paths, relative to dir, referenced by
+// packageable properties. Values of intrinsic functions, i.e !Ref, !Sub or
+// Fn::* maps, are never local paths.
+func localArtifacts(tpl, dir string) ([]artifact, error) {
+	var t struct {
+		Resources map[string]struct {
+			Type       string                      `yaml:"Type"`
+			Properties map[interface{}]interface{} `yaml:"Properties"`
+		} `yaml:"Resources"`
+	}
+
+	if err := yaml.Unmarshal([]byte(tpl), &t); err != nil {
+		return nil, fmt.Errorf("failed to parse template for packaging: %v", err)
+	}
+
+	seen := make(map[artifact]bool)
+	var artifacts []artifact
+	add := func(a artifact) {
+		if !seen[a] && isLocalPath(a.path, dir) && !isTagged(tpl, a.property, a.path) {
+			seen[a] = true
+			artifacts = append(artifacts, a)
+		}
+	}
+
+	for _, r := range t.Resources {
+		prop := func(k string) string {
+			v, _ := r.Properties[k].(string)
+			return v
+		}
+
+		switch r.Type {
+		case "AWS::Lambda::Function":
+			add(artifact{"Code", prop("Code"), artifactCode})
+		case "AWS::Serverless::Function":
+			add(artifact{"CodeUri", prop("CodeUri"), artifactCodeURI})
+		case "AWS::CloudFormation::Stack":
+			add(artifact{"TemplateURL", prop("TemplateURL"), artifactTemplate})
+		}
+	}
+
+	// AWS::Include transforms may appear anywhere in the template
+	var doc interface{}
+	if err := yaml.Unmarshal([]byte(tpl), &doc); err != nil {
+		return nil, err
+	}
+
+	walk(doc, func(m map[interface{}]interface{}) {
+		if m["Name"] != "AWS::Include" {
+			return
+		}
+
+		if params, ok := m["Parameters"].(map[interface{}]interface{}); ok {
+			if loc, ok := params["Location"].(string); ok {
+				add(artifact{"Location", loc, artifactInclude})
+			}
+		}
+	})
+
+	sort.Slice(artifacts, func(i, j int) bool {
+		if artifacts[i].property == artifacts[j].property {
+			return artifacts[i].path < artifacts[j].path
+		}
+		return artifacts[i].property < artifacts[j].property
+	})
+	return artifacts, nil
+}
+
+// walk - calls fn for each map in the parsed document
+func walk(v interface{}, fn func(map[interface{}]interface{})) {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		fn(val)
+		for _, i := range val {
+			walk(i, fn)
+		}
+	case []interface{}:
+		for _, i := range val {
+			walk(i, fn)
+		}
+	}
+}
+
+// prefixes of values that are always treated as local paths
+var localPrefixes = []string{"./", "../", "file://"}
+
+// isLocalPath - returns true if v references a local file or directory.
+// Values with a ./, ../ or file:// prefix are always local, other values
+// only if they exist relative to dir.
+func isLocalPath(v, dir string) bool {
+	if v == "" || strings.Contains(v, "${") {
+		return false
+	}
+
+	for _, p := range localPrefixes {
+		if strings.HasPrefix(v, p) {
+			return true
+		}
+	}
+
+	if strings.Contains(v, "://") {
+		return false
+	}
+
+	_, err := os.Stat(localPath(v, dir))
+	return err == nil
+}
+
+// localPath - returns the file system path of a local artifact value
+func localPath(v, dir string) string {
+	v = strings.TrimPrefix(v, "file://")
+	if filepath.IsAbs(v) {
+		return v
+	}
+	return filepath.Join(dir, v)
+}
+
+// isTagged - returns true if the value of property is a YAML short form
+// function, i.e !Ref or !Sub, the yaml parser drops the tags of scalars
+func isTagged(tpl, property, v string) bool {
+	re := regexp.MustCompile(fmt.Sprintf(`(?m)(?:^|[\s{,])["']?%s["']?\s*:\s*!\S+\s+["']?%s["']?([\s,}\]]|$)`,
+		regexp.QuoteMeta(property), regexp.QuoteMeta(v)))
+	return re.MatchString(tpl)
+}
+
+// rewriteProperty - replaces the value of the given property in the template
+// text, the template is rewritten in place so that YAML short form functions
+// and formatting are preserved
+func rewriteProperty(tpl, property, path, ref string) string {
+	re := regexp.MustCompile(fmt.Sprintf(`(?m)((?:^|[\s{,])["']?%s["']?\s*:\s*)["']?%s["']?([\s,}\]]|$)`,
+		regexp.QuoteMeta(property), regexp.QuoteMeta(path)))
+
+	return re.ReplaceAllStringFunc(tpl, func(m string) string {
+		sub := re.FindStringSubmatch(m)
+		return sub[1] + ref + sub[2]
+	})
+}
+
+// Zip - deterministically zips the file or directory at path, files are
+// added in lexical order with a fixed modification time
+func Zip(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	root := path
+	if !info.IsDir() {
+		root = filepath.Dir(path)
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	err = filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		mode := os.FileMode(0644)
+		if fi.Mode()&0111 != 0 {
+			mode = 0755
+		}
+
+		h := &zip.FileHeader{
+			Name:   filepath.ToSlash(rel),
+			Method: zip.Deflate,
+		}
+		h.Modified = zipModTime
+		h.SetMode(mode)
+
+		f, err := w.CreateHeader(h)
+		if err != nil {
+			return err
+		}
+
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		_, err = f.Write(b)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -1,9 +1,6 @@
 package stacks
 
 import (
-	"bytes"
-	"text/template"
-
 	"github.com/daidokoro/qaz/log"
 )
 
@@ -13,23 +10,18 @@ func (s *Stack) DeployTimeParser() error {
 	// define Delims
 	left, right := s.delims("deploy")
 
-	// Create template
-	// t, err := template.New("deploy-template").Delims(left, right).Funcs(*s.DeployTimeFunc).Funcs(sprig.FuncMap()).Parse(s.Template)
-	t, err := template.New("deploy-template").Delims(left, right).Funcs(*s.DeployTimeFunc).Parse(s.Template)
-	if err != nil {
-		return err
-	}
-
-	// so that we can write to string
-	var doc bytes.Buffer
-
 	// Add metadata specific to the stack we're working with to the parser
 	s.TemplateValues["stack"] = s.TemplateValues[s.Name]
 	s.TemplateValues["parameters"] = s.Parameters
 	s.TemplateValues["name"] = s.Name
 
-	t.Execute(&doc, s.TemplateValues)
-	s.Template = doc.String()
+	// line numbers of deploy-time errors refer to the generated template
+	out, err := render(s.templateName()+" (deploy-time)", s.Template, left, right, *s.DeployTimeFunc, s.TemplateValues, !s.Lenient)
+	if err != nil {
+		return err
+	}
+
+	s.Template = out
 	log.Debug("Deploy Time Template Generate:\n%s", s.Template)
 
 	return nil
@@ -45,26 +37,24 @@ func (s *Stack) GenTimeParser() error {
 	// define Delims
 	left, right := s.delims("gen")
 
-	// create template
-	t, err := template.New("gen-template").
-		Delims(left, right).
-		Funcs(*s.GenTimeFunc).
-		Parse(s.Template)
-	// t, err := template.New("gen-template").Delims(left, right).Funcs(*s.GenTimeFunc).Funcs(sprig.FuncMap()).Parse(s.Template)
-
-	if err != nil {
-		return err
-	}
-
-	// so that we can write to string
-	var doc bytes.Buffer
-
 	// Add metadata specific to the stack we're working with to the parser
 	s.TemplateValues["stack"] = s.TemplateValues[s.Name]
 	s.TemplateValues["parameters"] = s.Parameters
 	s.TemplateValues["name"] = s.Name
 
-	t.Execute(&doc, s.TemplateValues)
-	s.Template = doc.String()
+	out, err := render(s.templateName(), s.Template, left, right, *s.GenTimeFunc, s.TemplateValues, !s.Lenient)
+	if err != nil {
+		return err
+	}
+
+	s.Template = out
 	return nil
 }
+
+// templateName - returns the name of the stack template used in errors
+func (s *Stack) templateName() string {
+	if s.Source != "" {
+		return s.Source
+	}
+	return s.Name
+}
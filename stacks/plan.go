@@ -0,0 +1,466 @@
+package stacks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/daidokoro/qaz/log"
+)
+
+// stack review status, set on stacks created by a CREATE change-set
+// that has not yet been executed
+const reviewInProgress = "REVIEW_IN_PROGRESS"
+
+// plan results reported by handlers
+const (
+	// ActionPlanned - a change-set was created for the stack
+	ActionPlanned = "planned"
+
+	// ActionDeferred - the stack could not be planned as it
+	// depends on stacks that do not exist yet
+	ActionDeferred = "deferred"
+)
+
+// Plan - project wide change-set plan, stacks are listed in dependency order
+type Plan struct {
+	Project   string       `json:"project"`
+	ChangeSet string       `json:"change_set"`
+	Created   time.Time    `json:"created"`
+	Stacks    []*PlanStack `json:"stacks"`
+}
+
+// PlanStack - planned change-set for a single stack
+type PlanStack struct {
+	Name      string `json:"name"`
+	Stackname string `json:"stackname"`
+
+	// Type - change-set type, CREATE or UPDATE
+	Type string `json:"type"`
+
+	// ChangeSetID - arn of the change-set, empty if there are no changes
+	ChangeSetID string `json:"change_set_id,omitempty"`
+
+	// StackStatus & LastUpdated - state of the stack at plan time, used
+	// to detect changes made to the stack after planning
+	StackStatus string    `json:"stack_status,omitempty"`
+	LastUpdated time.Time `json:"last_updated,omitempty"`
+
+	// Deferred - set when the stack depends on stacks created by this plan
+	Deferred bool   `json:"deferred,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+
+	Adds         int          `json:"adds"`
+	Modifies     int          `json:"modifies"`
+	Removes      int          `json:"removes"`
+	Replacements int          `json:"replacements"`
+	Changes      []PlanChange `json:"changes,omitempty"`
+}
+
+// PlanChange - single resource change in a change-set
+type PlanChange struct {
+	Action      string `json:"action"`
+	LogicalID   string `json:"logical_id"`
+	Type        string `json:"type"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// HasChanges - returns true if the stack has a change-set to execute
+func (ps *PlanStack) HasChanges() bool {
+	return ps.ChangeSetID != "" && !ps.Deferred
+}
+
+// SetChanges - records resource changes and updates the change counts
+func (ps *PlanStack) SetChanges(changes []*cloudformation.Change) {
+	ps.Changes = nil
+	ps.Adds, ps.Modifies, ps.Removes, ps.Replacements = 0, 0, 0, 0
+
+	for _, c := range changes {
+		rc := c.ResourceChange
+		if rc == nil {
+			continue
+		}
+
+		pc := PlanChange{
+			Action:      aws.StringValue(rc.Action),
+			LogicalID:   aws.StringValue(rc.LogicalResourceId),
+			Type:        aws.StringValue(rc.ResourceType),
+			Replacement: aws.StringValue(rc.Replacement),
+		}
+
+		switch pc.Action {
+		case cloudformation.ChangeActionAdd:
+			ps.Adds++
+		case cloudformation.ChangeActionModify:
+			ps.Modifies++
+			switch pc.Replacement {
+			case cloudformation.ReplacementTrue, cloudformation.ReplacementConditional:
+				ps.Replacements++
+			}
+		case cloudformation.ChangeActionRemove:
+			ps.Removes++
+		}
+
+		ps.Changes = append(ps.Changes, pc)
+	}
+}
+
+// Save - writes the plan to the given file as JSON
+func (p *Plan) Save(path string) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// LoadPlan - reads a plan from the given file
+func LoadPlan(path string) (*Plan, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Plan
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("invalid plan file [%s]: %v", path, err)
+	}
+	return &p, nil
+}
+
+// Get - returns the planned stack with the given name
+func (p *Plan) Get(name string) (*PlanStack, bool) {
+	for _, ps := range p.Stacks {
+		if ps.Name == name {
+			return ps, true
+		}
+	}
+	return nil, false
+}
+
+// Print - writes a summary of the plan & resource changes to w
+func (p *Plan) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "STACK\tTYPE\tADD\tMODIFY\tREMOVE\tREPLACE\tSTATUS")
+	for _, ps := range p.Stacks {
+		status := "no changes"
+		switch {
+		case ps.Deferred:
+			status = ActionDeferred
+		case ps.HasChanges():
+			status = "pending"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%s\n", ps.Name, ps.Type, ps.Adds, ps.Modifies, ps.Removes, ps.Replacements, status)
+	}
+	tw.Flush()
+
+	for _, ps := range p.Stacks {
+		if ps.Deferred {
+			fmt.Fprintf(w, "\n%s: deferred - %s\n", ps.Name, ps.Reason)
+			continue
+		}
+
+		if len(ps.Changes) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "\n%s:\n", ps.Name)
+		tw = tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		for _, c := range ps.Changes {
+			replace := ""
+			if c.Action == cloudformation.ChangeActionModify && c.Replacement != "" && c.Replacement != cloudformation.ReplacementFalse {
+				replace = fmt.Sprintf("replacement: %s", c.Replacement)
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", c.Action, c.LogicalID, c.Type, replace)
+		}
+		tw.Flush()
+	}
+}
+
+// describe - returns the deployed stack, nil if it does not exist
+func (s *Stack) describe() (*cloudformation.Stack, error) {
+	svc := s.cfn()
+	params := &cloudformation.DescribeStacksInput{
+		StackName: aws.String(s.Stackname),
+	}
+
+	log.Debug("calling [DescribeStacks] with parameters: %s", params)
+	resp, err := svc.DescribeStacks(params)
+	if err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(resp.Stacks) == 0 {
+		return nil, nil
+	}
+	return resp.Stacks[0], nil
+}
+
+// lastUpdated - returns the last update time of a deployed stack
+func lastUpdated(stk *cloudformation.Stack) time.Time {
+	if stk.LastUpdatedTime != nil {
+		return *stk.LastUpdatedTime
+	}
+	return aws.TimeValue(stk.CreationTime)
+}
+
+// PlanHandler - creates change-sets for all actioned stacks in dependency order.
+// New stacks get a CREATE change-set, existing stacks an UPDATE change-set. Stacks
+// that depend on stacks created by this plan are deferred, as their deploy-time
+// values cannot be resolved until the dependency exists.
+func PlanHandler(ctx context.Context, m *Map, project string, opts HandlerOptions) (*Plan, error) {
+	sc, err := NewScheduler(m, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Plan{
+		Project:   project,
+		ChangeSet: fmt.Sprintf("qaz-plan-%d", time.Now().Unix()),
+		Created:   time.Now().UTC(),
+	}
+
+	var mu sync.Mutex
+	planned := make(map[string]*PlanStack)
+
+	results := runHandler(ctx, sc, "plan", func(s *Stack) (string, error) {
+		ps := &PlanStack{
+			Name:      s.Name,
+			Stackname: s.Stackname,
+			Type:      cloudformation.ChangeSetTypeUpdate,
+		}
+
+		defer func() {
+			mu.Lock()
+			defer mu.Unlock()
+			planned[s.Name] = ps
+		}()
+
+		if s.IsStackSet() {
+			return "", fmt.Errorf("change-set plans are not supported for stacksets: [%s]", s.Name)
+		}
+
+		stk, err := s.describe()
+		if err != nil {
+			return "", err
+		}
+
+		if stk == nil || aws.StringValue(stk.StackStatus) == reviewInProgress {
+			ps.Type = cloudformation.ChangeSetTypeCreate
+		}
+
+		if stk != nil {
+			ps.StackStatus = aws.StringValue(stk.StackStatus)
+			ps.LastUpdated = lastUpdated(stk)
+		}
+
+		// defer stacks that depend on stacks created by this plan
+		mu.Lock()
+		for _, dep := range s.DependsOn {
+			if d, ok := planned[dep]; ok && (d.Type == cloudformation.ChangeSetTypeCreate || d.Deferred) {
+				ps.Deferred = true
+				ps.Reason = fmt.Sprintf("depends on [%s], which is created by this plan, run plan again after apply", dep)
+			}
+		}
+		mu.Unlock()
+
+		if ps.Deferred {
+			log.Warn("[%s] %s", s.Name, ps.Reason)
+			return ActionDeferred, nil
+		}
+
+		resp, err := s.createChangeSet(ctx, p.ChangeSet, ps.Type)
+		if err != nil {
+			return "", err
+		}
+
+		if aws.StringValue(resp.Status) == cloudformation.ChangeSetStatusFailed {
+			// failed change-sets with no changes are removed
+			if !strings.Contains(aws.StringValue(resp.StatusReason), "didn't contain changes") &&
+				!strings.Contains(aws.StringValue(resp.StatusReason), "No updates are to be performed") {
+				return "", fmt.Errorf("change-set failed for [%s]: %s", s.Name, aws.StringValue(resp.StatusReason))
+			}
+
+			log.Info("no changes for stack: [%s]", s.Name)
+			if err := s.Change(ctx, rm, p.ChangeSet); err != nil {
+				log.Warn("failed to remove empty change-set for [%s]: %v", s.Name, err)
+			}
+			return ActionUnchanged, nil
+		}
+
+		ps.ChangeSetID = aws.StringValue(resp.ChangeSetId)
+		ps.SetChanges(resp.Changes)
+		return ActionPlanned, nil
+	})
+
+	// order planned stacks by dependency
+	g, _ := NewGraph(m)
+	for _, n := range g.Nodes() {
+		if ps, ok := planned[n]; ok {
+			p.Stacks = append(p.Stacks, ps)
+		}
+	}
+
+	return p, results.Err()
+}
+
+// Verify - checks that planned stacks & change-sets have not changed since planning
+func (p *Plan) Verify(m *Map) error {
+	var errs []string
+	for _, ps := range p.Stacks {
+		s, ok := m.Get(ps.Name)
+		if !ok {
+			errs = append(errs, fmt.Sprintf("[%s] is not defined in config", ps.Name))
+			continue
+		}
+
+		if s.Stackname != ps.Stackname {
+			errs = append(errs, fmt.Sprintf("[%s] stack name changed from [%s] to [%s]", ps.Name, ps.Stackname, s.Stackname))
+			continue
+		}
+
+		stk, err := s.describe()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case stk == nil && ps.StackStatus != "":
+			errs = append(errs, fmt.Sprintf("[%s] no longer exists", ps.Name))
+			continue
+		case stk != nil && ps.Type == cloudformation.ChangeSetTypeCreate &&
+			aws.StringValue(stk.StackStatus) != reviewInProgress:
+			errs = append(errs, fmt.Sprintf("[%s] was created after planning: %s", ps.Name, aws.StringValue(stk.StackStatus)))
+			continue
+		case stk != nil && ps.Type == cloudformation.ChangeSetTypeUpdate &&
+			(aws.StringValue(stk.StackStatus) != ps.StackStatus || !lastUpdated(stk).Equal(ps.LastUpdated)):
+			errs = append(errs, fmt.Sprintf(
+				"[%s] changed since planning: %s @ %s, planned against %s @ %s",
+				ps.Name, aws.StringValue(stk.StackStatus), lastUpdated(stk).Format(time.RFC3339),
+				ps.StackStatus, ps.LastUpdated.Format(time.RFC3339),
+			))
+			continue
+		}
+
+		if !ps.HasChanges() {
+			continue
+		}
+
+		svc := s.cfn()
+		params := &cloudformation.DescribeChangeSetInput{
+			ChangeSetName: aws.String(ps.ChangeSetID),
+		}
+
+		log.Debug("calling [DescribeChangeSet] with parameters: %s", params)
+		resp, err := svc.DescribeChangeSet(params)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("[%s] change-set not found: %v", ps.Name, err))
+			continue
+		}
+
+		if aws.StringValue(resp.ExecutionStatus) != cloudformation.ExecutionStatusAvailable {
+			errs = append(errs, fmt.Sprintf("[%s] change-set is not available for execution: %s", ps.Name, aws.StringValue(resp.ExecutionStatus)))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("refusing to apply plan, stacks changed since planning:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// execute - executes a planned change-set and waits for completion
+func (s *Stack) execute(ctx context.Context, ps *PlanStack) error {
+	svc := s.cfn()
+	params := &cloudformation.ExecuteChangeSetInput{
+		ChangeSetName: aws.String(ps.ChangeSetID),
+	}
+
+	start := time.Now()
+	log.Debug("calling [ExecuteChangeSet] with parameters: %s", params)
+	if _, err := svc.ExecuteChangeSetWithContext(ctx, params); err != nil {
+		return err
+	}
+
+	describeStacksInput := &cloudformation.DescribeStacksInput{
+		StackName: aws.String(s.Stackname),
+	}
+
+	stop := s.tail(ctx)
+	defer stop()
+
+	var err error
+	if ps.Type == cloudformation.ChangeSetTypeCreate {
+		log.Debug("calling [WaitUntilStackCreateComplete] with parameters: %s", describeStacksInput)
+		err = svc.WaitUntilStackCreateCompleteWithContext(ctx, describeStacksInput)
+	} else {
+		log.Debug("calling [WaitUntilStackUpdateComplete] with parameters: %s", describeStacksInput)
+		err = svc.WaitUntilStackUpdateCompleteWithContext(ctx, describeStacksInput)
+	}
+
+	if err != nil {
+		stop()
+		return s.failed(ctx, start, err)
+	}
+
+	return s.applyTerminationProtection(ctx)
+}
+
+// ApplyHandler - executes the change-sets of a plan in dependency order,
+// apply is refused if any planned stack changed since planning
+func ApplyHandler(ctx context.Context, m *Map, p *Plan, opts HandlerOptions) (Results, error) {
+	if err := p.Verify(m); err != nil {
+		return nil, err
+	}
+
+	// only stacks in the plan are actioned
+	m.Range(func(k string, s *Stack) bool {
+		_, s.Actioned = p.Get(k)
+		return true
+	})
+
+	sc, err := NewScheduler(m, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	results := runHandler(ctx, sc, "apply", func(s *Stack) (string, error) {
+		ps, _ := p.Get(s.Name)
+		switch {
+		case ps.Deferred:
+			log.Warn("[%s] was deferred at plan time, run plan again to apply changes", s.Name)
+			return ActionDeferred, nil
+		case !ps.HasChanges():
+			return ActionUnchanged, nil
+		}
+
+		log.Info("executing change-set [%s] for stack [%s]", p.ChangeSet, s.Name)
+		if err := s.execute(ctx, ps); err != nil {
+			log.Error("error applying change-set for stack [%s]: %v", s.Name, err)
+			if ctx.Err() != nil && opts.CancelOnInterrupt && ps.Type == cloudformation.ChangeSetTypeUpdate {
+				if cerr := s.CancelUpdate(); cerr != nil {
+					log.Error("failed to cancel update for stack [%s]: %v", s.Name, cerr)
+				}
+			}
+			return "", err
+		}
+
+		if ps.Type == cloudformation.ChangeSetTypeCreate {
+			return ActionCreated, nil
+		}
+		return ActionUpdated, nil
+	})
+
+	return results, results.Err()
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/daidokoro/qaz/log"
 )
@@ -16,7 +15,7 @@ func (s *Stack) StackPolicy() error {
 		return fmt.Errorf("empty stack policy value detected")
 	}
 
-	svc := cloudformation.New(s.Session, &aws.Config{Credentials: s.creds()})
+	svc := s.cfn()
 
 	params := &cloudformation.SetStackPolicyInput{
 		StackName: &s.Stackname,
@@ -8,7 +8,7 @@ import (
 
 // Protect - enables stack termination-protection
 func (s *Stack) Protect(enable *bool) error {
-	svc := cloudformation.New(s.Session, &aws.Config{Credentials: s.creds()})
+	svc := s.cfn()
 
 	params := &cloudformation.UpdateTerminationProtectionInput{
 		EnableTerminationProtection: aws.Bool(!*enable),
@@ -0,0 +1,212 @@
+package stacks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/daidokoro/qaz/log"
+)
+
+// stack event status marking the start of the operation that left
+// the stack in a recoverable state
+var recoverStart = map[string]string{
+	cloudformation.StackStatusUpdateRollbackFailed: cloudformation.StackStatusUpdateRollbackInProgress,
+	cloudformation.StackStatusDeleteFailed:         cloudformation.StackStatusDeleteInProgress,
+}
+
+// FailedResource - stack resource that failed during a stack operation
+type FailedResource struct {
+	LogicalID string
+	Type      string
+	Status    string
+	Reason    string
+}
+
+// Recoverable - returns true if the stack status can be recovered by Recover
+func Recoverable(status string) bool {
+	_, ok := recoverStart[status]
+	return ok
+}
+
+// ParseFailedResources - returns the resources that failed during the most recent
+// operation that left the stack in the given status. Events are expected newest
+// first, as returned by DescribeStackEvents.
+func ParseFailedResources(events []*cloudformation.StackEvent, status string) []FailedResource {
+	start, ok := recoverStart[status]
+	if !ok {
+		return nil
+	}
+
+	var failed []FailedResource
+	seen := make(map[string]bool)
+	for _, e := range events {
+		id := aws.StringValue(e.LogicalResourceId)
+		stat := aws.StringValue(e.ResourceStatus)
+
+		// stack level events
+		if aws.StringValue(e.ResourceType) == "AWS::CloudFormation::Stack" && aws.StringValue(e.PhysicalResourceId) == aws.StringValue(e.StackId) {
+			if stat == start {
+				break
+			}
+			continue
+		}
+
+		// only the latest status of each resource is relevant
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if strings.HasSuffix(stat, "_FAILED") {
+			failed = append(failed, FailedResource{
+				LogicalID: id,
+				Type:      aws.StringValue(e.ResourceType),
+				Status:    stat,
+				Reason:    aws.StringValue(e.ResourceStatusReason),
+			})
+		}
+	}
+	return failed
+}
+
+// FailedResources - returns the stack status and the resources that failed
+// during the operation that left the stack in that status
+func (s *Stack) FailedResources(ctx context.Context) (string, []FailedResource, error) {
+	status, err := s.StackStatus()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !Recoverable(status) {
+		return status, nil, nil
+	}
+
+	svc := s.cfn()
+	params := &cloudformation.DescribeStackEventsInput{
+		StackName: aws.String(s.Stackname),
+	}
+
+	var events []*cloudformation.StackEvent
+	log.Debug("calling [DescribeStackEvents] with parameters: %s", params)
+	err = svc.DescribeStackEventsPagesWithContext(ctx, params, func(page *cloudformation.DescribeStackEventsOutput, last bool) bool {
+		events = append(events, page.StackEvents...)
+
+		// stop paging once the start of the failed operation is found
+		for _, e := range page.StackEvents {
+			if aws.StringValue(e.ResourceStatus) == recoverStart[status] && aws.StringValue(e.PhysicalResourceId) == aws.StringValue(e.StackId) {
+				return false
+			}
+		}
+		return true
+	})
+
+	if err != nil {
+		return status, nil, err
+	}
+
+	return status, ParseFailedResources(events, status), nil
+}
+
+// Recover - recovers a stack stuck in UPDATE_ROLLBACK_FAILED by continuing the
+// rollback, skipping the given resources, or in DELETE_FAILED by retrying the
+// delete, retaining the given resources
+func (s *Stack) Recover(ctx context.Context, skip, retain []string) error {
+	status, err := s.StackStatus()
+	if err != nil {
+		return err
+	}
+
+	svc := s.cfn()
+
+	switch status {
+	case cloudformation.StackStatusUpdateRollbackFailed:
+		if len(retain) > 0 {
+			return fmt.Errorf("retain is only valid for stacks in %s, [%s] is in %s", cloudformation.StackStatusDeleteFailed, s.Name, status)
+		}
+
+		params := &cloudformation.ContinueUpdateRollbackInput{
+			StackName: aws.String(s.Stackname),
+		}
+
+		if len(skip) > 0 {
+			params.ResourcesToSkip = aws.StringSlice(skip)
+		}
+
+		log.Debug("calling [ContinueUpdateRollback] with parameters: %s", params)
+		if _, err := svc.ContinueUpdateRollbackWithContext(ctx, params); err != nil {
+			return err
+		}
+
+		log.Info("continuing update rollback: [%s]", s.Stackname)
+		stop := s.tail(ctx)
+		defer stop()
+
+		// the status lags behind the call, UPDATE_ROLLBACK_FAILED is terminal
+		// so wait for the rollback to start before waiting for it to finish
+		if err := waitLeaveWithContext(ctx, s.StackStatus, status); err != nil {
+			return err
+		}
+
+		if err := WaitWithContext(ctx, s.StackStatus); err != nil {
+			return err
+		}
+
+		status, err := s.StackStatus()
+		if err != nil {
+			return err
+		}
+
+		if status != cloudformation.StackStatusUpdateRollbackComplete {
+			return fmt.Errorf("rollback failed for stack [%s]: %s", s.Name, status)
+		}
+
+		log.Info("rollback completed: [%s]", s.Stackname)
+		return nil
+
+	case cloudformation.StackStatusDeleteFailed:
+		if len(skip) > 0 {
+			return fmt.Errorf("skip is only valid for stacks in %s, [%s] is in %s", cloudformation.StackStatusUpdateRollbackFailed, s.Name, status)
+		}
+
+		params := &cloudformation.DeleteStackInput{
+			StackName: aws.String(s.Stackname),
+		}
+
+		if len(retain) > 0 {
+			params.RetainResources = aws.StringSlice(retain)
+		}
+
+		start := time.Now()
+		log.Debug("calling [DeleteStack] with parameters: %s", params)
+		if _, err := svc.DeleteStackWithContext(ctx, params); err != nil {
+			return err
+		}
+
+		log.Info("retrying delete: [%s]", s.Stackname)
+		stop := s.tail(ctx)
+		defer stop()
+
+		// DELETE_FAILED is a failure of the waiter, wait for the delete to
+		// start first, stacks that are already gone have left it
+		if err := waitLeaveWithContext(ctx, s.StackStatus, status); err != nil && !strings.Contains(err.Error(), "does not exist") {
+			return err
+		}
+
+		if err := svc.WaitUntilStackDeleteCompleteWithContext(ctx, &cloudformation.DescribeStacksInput{
+			StackName: aws.String(s.Stackname),
+		}); err != nil {
+			stop()
+			return s.failed(ctx, start, err)
+		}
+
+		log.Info("deletion successful: [%s]", s.Stackname)
+		return nil
+	}
+
+	return fmt.Errorf("stack [%s] is in %s, only stacks in %s or %s can be recovered",
+		s.Name, status, cloudformation.StackStatusUpdateRollbackFailed, cloudformation.StackStatusDeleteFailed)
+}
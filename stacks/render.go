@@ -0,0 +1,130 @@
+package stacks
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// number of source lines shown before & after the line of a template error
+const templateContextLines = 2
+
+// position of text/template errors, i.e 3:14: or 3:
+var templatePosRegex = regexp.MustCompile(`(?s)^(\d+):(?:(\d+):)? (.*)$`)
+
+// TemplateError - returned when a template fails to parse or execute,
+// includes the template name, position and the surrounding source lines
+type TemplateError struct {
+	Template string
+	Line     int
+	Column   int
+	Msg      string
+
+	// Context - source lines around the error, the error line is marked
+	Context string
+}
+
+// Error - implements the error interface
+func (e *TemplateError) Error() string {
+	pos := fmt.Sprintf("%s:%d", e.Template, e.Line)
+	if e.Column > 0 {
+		pos = fmt.Sprintf("%s:%d", pos, e.Column)
+	}
+
+	if e.Context == "" {
+		return fmt.Sprintf("%s: %s", pos, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s\n%s", pos, e.Msg, e.Context)
+}
+
+// render - parses & executes a template, strict templates fail on keys
+// missing from data instead of rendering <no value>
+func render(name, src, left, right string, funcs template.FuncMap, data interface{}, strict bool) (string, error) {
+	t := template.New(name).Delims(left, right).Funcs(funcs)
+	if strict {
+		t = t.Option("missingkey=error")
+	}
+
+	if _, err := t.Parse(src); err != nil {
+		return "", templateError(name, src, err)
+	}
+
+	// so that we can write to string
+	var doc bytes.Buffer
+	if err := t.Execute(&doc, data); err != nil {
+		return "", templateError(name, src, err)
+	}
+	return doc.String(), nil
+}
+
+// templateError - returns err as a TemplateError if its position in the
+// template is known, otherwise err is returned as is
+func templateError(name, src string, err error) error {
+	msg := strings.TrimPrefix(err.Error(), fmt.Sprintf("template: %s:", name))
+	m := templatePosRegex.FindStringSubmatch(msg)
+	if m == nil {
+		return err
+	}
+
+	e := &TemplateError{Template: name, Msg: m[3]}
+	e.Line, _ = strconv.Atoi(m[1])
+
+	// text/template columns are byte offsets from the start of the line
+	if m[2] != "" {
+		col, _ := strconv.Atoi(m[2])
+		e.Column = col + 1
+	}
+
+	e.Msg = strings.TrimPrefix(e.Msg, fmt.Sprintf("executing %q ", name))
+	e.Context = sourceContext(src, e.Line, e.Column)
+	return e
+}
+
+// sourceContext - returns the lines around line of src, the line is marked
+// with > and the column, if set, with ^
+func sourceContext(src string, line, column int) string {
+	lines := strings.Split(src, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+
+	// the empty line after a trailing newline is only shown for errors on it
+	if n := len(lines); n > 1 && line < n && lines[n-1] == "" {
+		lines = lines[:n-1]
+	}
+
+	first, last := line-templateContextLines, line+templateContextLines
+	if first < 1 {
+		first = 1
+	}
+	if last > len(lines) {
+		last = len(lines)
+	}
+
+	width := len(strconv.Itoa(last))
+	var b strings.Builder
+	for i := first; i <= last; i++ {
+		marker := " "
+		if i == line {
+			marker = ">"
+		}
+		fmt.Fprintf(&b, "%s %*d | %s\n", marker, width, i, lines[i-1])
+
+		if i != line || column < 1 || column > len(lines[i-1])+1 {
+			continue
+		}
+
+		// keep tabs so the caret lines up with the column
+		pad := []byte(lines[i-1][:column-1])
+		for j := range pad {
+			if pad[j] != '\t' {
+				pad[j] = ' '
+			}
+		}
+		fmt.Fprintf(&b, "  %*s | %s^\n", width, "", pad)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,387 @@
+package stacks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/daidokoro/qaz/clients"
+	"github.com/daidokoro/qaz/log"
+)
+
+// machine-readable documents for read commands, field names are stable
+// and timestamps are RFC3339 formatted
+
+// status of stacks & stack sets that are not deployed
+const statusCreatePending = "CREATE_PENDING"
+
+// StackInfo - identifies a stack and its deployment status
+type StackInfo struct {
+	Stack     string          `json:"stack" yaml:"stack"`
+	Stackname string          `json:"stackname" yaml:"stackname"`
+	Region    string          `json:"region" yaml:"region"`
+	Status    string          `json:"status,omitempty" yaml:"status,omitempty"`
+	Reason    string          `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Created   string          `json:"created,omitempty" yaml:"created,omitempty"`
+	Updated   string          `json:"updated,omitempty" yaml:"updated,omitempty"`
+	Instances []StackInstance `json:"instances,omitempty" yaml:"instances,omitempty"`
+}
+
+// StackOutputs - outputs of a deployed stack
+type StackOutputs struct {
+	StackInfo `yaml:",inline"`
+	Outputs   []Output `json:"outputs" yaml:"outputs"`
+}
+
+// Output - a single stack output
+type Output struct {
+	Key         string `json:"key" yaml:"key"`
+	Value       string `json:"value" yaml:"value"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	ExportName  string `json:"export_name,omitempty" yaml:"export_name,omitempty"`
+}
+
+// StackParameters - parameters of a deployed stack
+type StackParameters struct {
+	StackInfo  `yaml:",inline"`
+	Parameters []Parameter `json:"parameters" yaml:"parameters"`
+}
+
+// Parameter - a deployed stack parameter, Local is set if the
+// value in config differs from the deployed value
+type Parameter struct {
+	Key   string `json:"key" yaml:"key"`
+	Value string `json:"value" yaml:"value"`
+	Local string `json:"local,omitempty" yaml:"local,omitempty"`
+}
+
+// Export - a cloudformation export
+type Export struct {
+	Name    string `json:"name" yaml:"name"`
+	Value   string `json:"value" yaml:"value"`
+	StackID string `json:"stack_id" yaml:"stack_id"`
+}
+
+// StackValues - config values of a stack
+type StackValues struct {
+	StackInfo `yaml:",inline"`
+	Values    map[string]interface{} `json:"values" yaml:"values"`
+}
+
+// StackChangeSets - change-sets of a stack
+type StackChangeSets struct {
+	StackInfo  `yaml:",inline"`
+	ChangeSets []ChangeSet `json:"change_sets" yaml:"change_sets"`
+}
+
+// ChangeSet - a change-set & its resource changes, changes are
+// only set when the change-set is described
+type ChangeSet struct {
+	Name            string           `json:"name" yaml:"name"`
+	Status          string           `json:"status" yaml:"status"`
+	ExecutionStatus string           `json:"execution_status" yaml:"execution_status"`
+	Reason          string           `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Created         string           `json:"created,omitempty" yaml:"created,omitempty"`
+	Changes         []ResourceChange `json:"changes,omitempty" yaml:"changes,omitempty"`
+}
+
+// ResourceChange - a resource change of a change-set
+type ResourceChange struct {
+	Action      string `json:"action" yaml:"action"`
+	LogicalID   string `json:"logical_id" yaml:"logical_id"`
+	PhysicalID  string `json:"physical_id,omitempty" yaml:"physical_id,omitempty"`
+	Type        string `json:"type" yaml:"type"`
+	Replacement string `json:"replacement,omitempty" yaml:"replacement,omitempty"`
+}
+
+// StackChangeSet - a described change-set of a stack
+type StackChangeSet struct {
+	StackInfo `yaml:",inline"`
+	ChangeSet ChangeSet `json:"change_set" yaml:"change_set"`
+}
+
+// TemplateValidation - result of validating a stack template
+type TemplateValidation struct {
+	StackInfo          `yaml:",inline"`
+	Valid              bool                `json:"valid" yaml:"valid"`
+	Description        string              `json:"description,omitempty" yaml:"description,omitempty"`
+	Capabilities       []string            `json:"capabilities,omitempty" yaml:"capabilities,omitempty"`
+	CapabilitiesReason string              `json:"capabilities_reason,omitempty" yaml:"capabilities_reason,omitempty"`
+	Parameters         []TemplateParameter `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+}
+
+// TemplateParameter - a parameter declared by a template
+type TemplateParameter struct {
+	Key         string `json:"key" yaml:"key"`
+	Default     string `json:"default,omitempty" yaml:"default,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	NoEcho      bool   `json:"no_echo,omitempty" yaml:"no_echo,omitempty"`
+}
+
+// timestamp - formats t as RFC3339, empty if not set
+func timestamp(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// info - returns the stack info without deployment status
+func (s *Stack) info() StackInfo {
+	return StackInfo{
+		Stack:     s.Name,
+		Stackname: s.Stackname,
+		Region:    s.region(),
+	}
+}
+
+// stackInfo - returns the stack info of a described stack
+func (s *Stack) stackInfo(stk *cloudformation.Stack) StackInfo {
+	i := s.info()
+	i.Status = aws.StringValue(stk.StackStatus)
+	i.Reason = aws.StringValue(stk.StackStatusReason)
+	i.Created = timestamp(stk.CreationTime)
+	i.Updated = timestamp(stk.LastUpdatedTime)
+	return i
+}
+
+// Info - returns the deployment status of the stack, stack set
+// instances are included for stack sets
+func (s *Stack) Info() (*StackInfo, error) {
+	i := s.info()
+
+	if s.IsStackSet() {
+		ctx := context.Background()
+		exists, err := s.stackSetExists(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			i.Status = statusCreatePending
+			return &i, nil
+		}
+
+		if i.Instances, err = s.StackInstances(ctx); err != nil {
+			return nil, err
+		}
+		i.Status = cloudformation.StackSetStatusActive
+		return &i, nil
+	}
+
+	stk, err := s.describe()
+	if err != nil {
+		return nil, err
+	}
+
+	if stk == nil {
+		i.Status = statusCreatePending
+		return &i, nil
+	}
+
+	i = s.stackInfo(stk)
+	return &i, nil
+}
+
+// StackOutputs - returns the outputs of the deployed stack
+func (s *Stack) StackOutputs() (*StackOutputs, error) {
+	stk, err := s.describe()
+	if err != nil {
+		return nil, err
+	}
+
+	if stk == nil {
+		return nil, fmt.Errorf("stack [%s] is not deployed", s.Name)
+	}
+
+	o := &StackOutputs{StackInfo: s.stackInfo(stk), Outputs: []Output{}}
+	for _, out := range stk.Outputs {
+		o.Outputs = append(o.Outputs, Output{
+			Key:         aws.StringValue(out.OutputKey),
+			Value:       aws.StringValue(out.OutputValue),
+			Description: aws.StringValue(out.Description),
+			ExportName:  aws.StringValue(out.ExportName),
+		})
+	}
+
+	sort.Slice(o.Outputs, func(i, j int) bool { return o.Outputs[i].Key < o.Outputs[j].Key })
+	return o, nil
+}
+
+// StackParameters - returns the parameters of the deployed stack, with
+// config values that differ from the deployed values
+func (s *Stack) StackParameters() (*StackParameters, error) {
+	stk, err := s.describe()
+	if err != nil {
+		return nil, err
+	}
+
+	if stk == nil {
+		return nil, fmt.Errorf("stack [%s] is not deployed", s.Name)
+	}
+
+	local := make(map[string]string)
+	for _, p := range s.Parameters {
+		local[aws.StringValue(p.ParameterKey)] = aws.StringValue(p.ParameterValue)
+	}
+
+	p := &StackParameters{StackInfo: s.stackInfo(stk), Parameters: []Parameter{}}
+	for _, param := range stk.Parameters {
+		v := Parameter{
+			Key:   aws.StringValue(param.ParameterKey),
+			Value: aws.StringValue(param.ParameterValue),
+		}
+
+		if l, ok := local[v.Key]; ok && l != v.Value {
+			v.Local = l
+		}
+		p.Parameters = append(p.Parameters, v)
+	}
+
+	sort.Slice(p.Parameters, func(i, j int) bool { return p.Parameters[i].Key < p.Parameters[j].Key })
+	return p, nil
+}
+
+// StackValues - returns the config values of the stack
+func (s *Stack) StackValues() *StackValues {
+	values, _ := s.TemplateValues[s.Name].(map[string]interface{})
+	return &StackValues{StackInfo: s.info(), Values: values}
+}
+
+// ChangeSets - returns the change-sets of the stack
+func (s *Stack) ChangeSets(ctx context.Context) (*StackChangeSets, error) {
+	svc := s.cfn()
+	params := &cloudformation.ListChangeSetsInput{
+		StackName: aws.String(s.Stackname),
+	}
+
+	c := &StackChangeSets{StackInfo: s.info(), ChangeSets: []ChangeSet{}}
+	for {
+		log.Debug("calling [ListChangeSets] with parameters: %s", params)
+		resp, err := svc.ListChangeSetsWithContext(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, i := range resp.Summaries {
+			c.ChangeSets = append(c.ChangeSets, ChangeSet{
+				Name:            aws.StringValue(i.ChangeSetName),
+				Status:          aws.StringValue(i.Status),
+				ExecutionStatus: aws.StringValue(i.ExecutionStatus),
+				Reason:          aws.StringValue(i.StatusReason),
+				Created:         timestamp(i.CreationTime),
+			})
+		}
+
+		if resp.NextToken == nil {
+			break
+		}
+		params.NextToken = resp.NextToken
+	}
+	return c, nil
+}
+
+// DescribeChangeSet - returns the change-set & its resource changes
+func (s *Stack) DescribeChangeSet(ctx context.Context, changename string) (*StackChangeSet, error) {
+	svc := s.cfn()
+	params := &cloudformation.DescribeChangeSetInput{
+		ChangeSetName: aws.String(changename),
+		StackName:     aws.String(s.Stackname),
+	}
+
+	c := &StackChangeSet{StackInfo: s.info()}
+	for {
+		log.Debug("calling [DescribeChangeSet] with parameters: %s", params)
+		resp, err := svc.DescribeChangeSetWithContext(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+
+		c.ChangeSet.Name = aws.StringValue(resp.ChangeSetName)
+		c.ChangeSet.Status = aws.StringValue(resp.Status)
+		c.ChangeSet.ExecutionStatus = aws.StringValue(resp.ExecutionStatus)
+		c.ChangeSet.Reason = aws.StringValue(resp.StatusReason)
+		c.ChangeSet.Created = timestamp(resp.CreationTime)
+
+		for _, ch := range resp.Changes {
+			rc := ch.ResourceChange
+			if rc == nil {
+				continue
+			}
+
+			c.ChangeSet.Changes = append(c.ChangeSet.Changes, ResourceChange{
+				Action:      aws.StringValue(rc.Action),
+				LogicalID:   aws.StringValue(rc.LogicalResourceId),
+				PhysicalID:  aws.StringValue(rc.PhysicalResourceId),
+				Type:        aws.StringValue(rc.ResourceType),
+				Replacement: aws.StringValue(rc.Replacement),
+			})
+		}
+
+		if resp.NextToken == nil {
+			break
+		}
+		params.NextToken = resp.NextToken
+	}
+	return c, nil
+}
+
+// Validation - validates the stack template and returns the result
+func (s *Stack) Validation() (*TemplateValidation, error) {
+	resp, err := s.validateTemplate()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &TemplateValidation{
+		StackInfo:          s.info(),
+		Valid:              true,
+		Description:        aws.StringValue(resp.Description),
+		Capabilities:       aws.StringValueSlice(resp.Capabilities),
+		CapabilitiesReason: aws.StringValue(resp.CapabilitiesReason),
+	}
+
+	for _, p := range resp.Parameters {
+		v.Parameters = append(v.Parameters, TemplateParameter{
+			Key:         aws.StringValue(p.ParameterKey),
+			Default:     aws.StringValue(p.DefaultValue),
+			Description: aws.StringValue(p.Description),
+			NoEcho:      aws.BoolValue(p.NoEcho),
+		})
+	}
+	return v, nil
+}
+
+// ListExports - returns all cloudformation exports of the session region,
+// SDK clients are used if p is nil
+func ListExports(sess *session.Session, p clients.Provider) ([]Export, error) {
+	svc := clients.Default(p).CloudFormation(sess)
+	params := &cloudformation.ListExportsInput{}
+
+	exports := []Export{}
+	for {
+		log.Debug("calling [ListExports] with parameters: %s", params)
+		resp, err := svc.ListExports(params)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range resp.Exports {
+			exports = append(exports, Export{
+				Name:    aws.StringValue(e.Name),
+				Value:   aws.StringValue(e.Value),
+				StackID: aws.StringValue(e.ExportingStackId),
+			})
+		}
+
+		if resp.NextToken == nil {
+			break
+		}
+		params.NextToken = resp.NextToken
+	}
+	return exports, nil
+}
@@ -0,0 +1,192 @@
+package stacks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// stack results reported by handlers
+const (
+	ActionCreated    = "created"
+	ActionUpdated    = "updated"
+	ActionUnchanged  = "unchanged"
+	ActionTerminated = "terminated"
+	ActionFailed     = "failed"
+	ActionCancelled  = "cancelled"
+)
+
+// ErrFailFast - returned for stacks that were not started because
+// another stack failed and fail-fast is enabled
+var ErrFailFast = errors.New("not started due to fail-fast")
+
+// Result - outcome of a handler action against a single stack
+type Result struct {
+	Stack    string
+	Action   string
+	Result   string
+	Duration time.Duration
+	Err      error
+
+	// Failure - root cause of a failed stack operation, if found
+	Failure *Failure
+}
+
+// resultDocument - machine-readable representation of a result
+type resultDocument struct {
+	Stack    string   `json:"stack" yaml:"stack"`
+	Action   string   `json:"action" yaml:"action"`
+	Result   string   `json:"result" yaml:"result"`
+	Duration string   `json:"duration" yaml:"duration"`
+	Error    string   `json:"error,omitempty" yaml:"error,omitempty"`
+	Failure  *Failure `json:"failure,omitempty" yaml:"failure,omitempty"`
+}
+
+// document - returns the machine-readable representation of the result
+func (r Result) document() resultDocument {
+	d := resultDocument{
+		Stack:    r.Stack,
+		Action:   r.Action,
+		Result:   r.Result,
+		Duration: r.Duration.Round(time.Second).String(),
+		Failure:  r.Failure,
+	}
+
+	if r.Err != nil {
+		d.Error = r.Err.Error()
+	}
+	return d
+}
+
+// MarshalJSON - implements json.Marshaler
+func (r Result) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.document())
+}
+
+// MarshalYAML - implements yaml.Marshaler
+func (r Result) MarshalYAML() (interface{}, error) {
+	return r.document(), nil
+}
+
+// Results - handler results, sorted by stack name
+type Results []Result
+
+// Failed - returns the number of stacks that failed or were cancelled
+func (r Results) Failed() int {
+	var n int
+	for _, res := range r {
+		if res.Err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Succeeded - returns the number of stacks whose action succeeded, stacks
+// that failed or were cancelled are not counted
+func (r Results) Succeeded() int {
+	var n int
+	for _, res := range r {
+		switch res.Result {
+		case ActionCreated, ActionUpdated, ActionUnchanged, ActionTerminated:
+			n++
+		}
+	}
+	return n
+}
+
+// Err - returns a HandlerError if any stack failed, else nil
+func (r Results) Err() error {
+	if r.Failed() == 0 {
+		return nil
+	}
+	return &HandlerError{Results: r}
+}
+
+// Table - writes a summary table of results to w
+func (r Results) Table(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "STACK\tACTION\tRESULT\tDURATION\tREASON")
+	for _, res := range r {
+		var reason string
+		if res.Err != nil {
+			reason = res.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", res.Stack, res.Action, res.Result, res.Duration.Round(time.Second), reason)
+	}
+	tw.Flush()
+}
+
+// HandlerError - returned by handlers when one or more stacks failed
+type HandlerError struct {
+	Results Results
+}
+
+// Error - implements the error interface
+func (e *HandlerError) Error() string {
+	return fmt.Sprintf("%d of %d stack(s) failed", e.Results.Failed(), len(e.Results))
+}
+
+// Partial - returns true if some stacks succeeded and others failed, runs
+// where stacks only failed or were cancelled are total failures
+func (e *HandlerError) Partial() bool {
+	return e.Results.Succeeded() > 0 && e.Results.Failed() > 0
+}
+
+// runHandler - runs fn via the scheduler and collects a result for each actioned
+// stack, fn returns the result of the action, i.e. created, updated
+func runHandler(ctx context.Context, sc *Scheduler, action string, fn func(*Stack) (string, error)) Results {
+	var mu sync.Mutex
+	results := make(map[string]*Result)
+
+	errs := sc.Run(ctx, func(s *Stack) error {
+		start := time.Now()
+		s.failure = nil
+		res, err := fn(s)
+
+		mu.Lock()
+		defer mu.Unlock()
+		results[s.Name] = &Result{
+			Stack:    s.Name,
+			Action:   action,
+			Result:   res,
+			Duration: time.Since(start),
+			Failure:  s.failure,
+		}
+		return err
+	})
+
+	// stacks that were never started have no result
+	sc.stacks.Range(func(k string, s *Stack) bool {
+		if _, ok := results[k]; !ok && s.Actioned {
+			results[k] = &Result{Stack: k, Action: action}
+		}
+		return true
+	})
+
+	var out Results
+	for k, res := range results {
+		if err, ok := errs[k]; ok {
+			res.Err = err
+			res.Result = ActionFailed
+			switch err.(type) {
+			case *DependencyError:
+				res.Result = ActionCancelled
+			}
+
+			if err == ErrFailFast || err == ErrInterrupted {
+				res.Result = ActionCancelled
+			}
+		}
+		out = append(out, *res)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Stack < out[j].Stack })
+	return out
+}
@@ -0,0 +1,245 @@
+package stacks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/daidokoro/qaz/log"
+)
+
+// interval between status checks for dependencies that are
+// not actioned in the current run, i.e. deployed elsewhere
+var externalPollInterval = time.Second * 10
+
+// HandlerOptions - options for multi-stack handlers
+type HandlerOptions struct {
+	// Parallel - max number of stacks actioned concurrently, 0 for no limit
+	Parallel int
+
+	// FailFast - stop starting new stacks after the first failure
+	FailFast bool
+
+	// CancelOnInterrupt - cancel in-progress stack updates when interrupted
+	CancelOnInterrupt bool
+}
+
+// ErrInterrupted - returned for stacks that were not started
+// because the run was interrupted
+var ErrInterrupted = errors.New("not started due to interrupt")
+
+// Scheduler - runs an action against all actioned stacks in dependency order.
+// Stacks are started only when all stacks they wait on have signalled completion.
+type Scheduler struct {
+	stacks *Map
+	graph  *Graph
+
+	// Parallel - max number of concurrent actions, 0 for no limit
+	Parallel int
+
+	// FailFast - when true, stacks not yet started are cancelled
+	// with ErrFailFast once any stack fails
+	FailFast bool
+
+	// Reverse - when true, stacks wait on their dependents instead
+	// of their dependencies, i.e. for terminating stacks
+	Reverse bool
+
+	// External - called for stacks that are waited on but not actioned in this
+	// run, should block until the stack is ready, ctx is done or return an error
+	External func(context.Context, *Stack) error
+}
+
+// NewScheduler - returns a scheduler for the given stack map, an error
+// is returned if the stack dependencies are invalid
+func NewScheduler(m *Map, opts HandlerOptions) (*Scheduler, error) {
+	g, err := NewGraph(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Scheduler{
+		stacks:   m,
+		graph:    g,
+		Parallel: opts.Parallel,
+		FailFast: opts.FailFast,
+		External: func(context.Context, *Stack) error { return nil },
+	}, nil
+}
+
+// DependencyError - returned for stacks that were not actioned
+// due to the failure of a stack they depend on
+type DependencyError struct {
+	Stack      string
+	Dependency string
+}
+
+// Error - implements the error interface
+func (e *DependencyError) Error() string {
+	return fmt.Sprintf("[%s] cancelled due to failure of [%s]", e.Stack, e.Dependency)
+}
+
+// upstream - returns the stacks that must complete before the given stack
+func (sc *Scheduler) upstream(n string) []string {
+	if sc.Reverse {
+		return sc.graph.Dependents(n)
+	}
+	return sc.graph.Dependencies(n)
+}
+
+// Run - executes fn for all actioned stacks and returns a map of stack name to
+// error for each stack that failed or was cancelled. When ctx is done no new stacks
+// are started, stacks still in progress are logged and Run waits for fn to return.
+func (sc *Scheduler) Run(ctx context.Context, fn func(*Stack) error) map[string]error {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		errs    = make(map[string]error)
+		done    = make(map[string]chan struct{})
+		running = make(map[string]bool)
+		limiter chan struct{}
+		stopped bool
+		finish  = make(chan struct{})
+	)
+
+	if sc.Parallel > 0 {
+		limiter = make(chan struct{}, sc.Parallel)
+	}
+
+	// create completion channels for actioned stacks
+	sc.stacks.Range(func(k string, s *Stack) bool {
+		if s.Actioned {
+			done[k] = make(chan struct{})
+		}
+		return true
+	})
+
+	result := func(n string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs[n] = err
+			if sc.FailFast {
+				stopped = true
+			}
+		}
+		close(done[n])
+	}
+
+	stop := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return stopped
+	}
+
+	setRunning := func(n string, ok bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if ok {
+			running[n] = true
+			return
+		}
+		delete(running, n)
+	}
+
+	// report in-progress stacks on interrupt
+	go func() {
+		select {
+		case <-finish:
+		case <-ctx.Done():
+			mu.Lock()
+			var names []string
+			for n := range running {
+				names = append(names, n)
+			}
+			mu.Unlock()
+			sort.Strings(names)
+
+			log.Warn("interrupted, no new stacks will be started")
+			if len(names) > 0 {
+				log.Warn("stacks still in progress, waiting for them to return: %s", names)
+			}
+		}
+	}()
+
+	failed := func(n string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		_, ok := errs[n]
+		return ok
+	}
+
+	for _, n := range sc.graph.Nodes() {
+		if _, ok := done[n]; !ok {
+			log.Debug("%s: not actioned, skipping", n)
+			continue
+		}
+
+		wg.Add(1)
+		go func(n string) {
+			defer wg.Done()
+			s := sc.stacks.MustGet(n)
+
+			for _, u := range sc.upstream(n) {
+				if ch, ok := done[u]; ok {
+					log.Debug("[%s] waiting on [%s]", n, u)
+					select {
+					case <-ch:
+					case <-ctx.Done():
+					}
+
+					if ctx.Err() != nil {
+						result(n, ErrInterrupted)
+						return
+					}
+
+					if failed(u) {
+						result(n, &DependencyError{Stack: n, Dependency: u})
+						return
+					}
+					continue
+				}
+
+				// stack is not actioned in this run
+				if err := sc.External(ctx, sc.stacks.MustGet(u)); err != nil {
+					if ctx.Err() != nil {
+						err = ErrInterrupted
+					}
+					result(n, err)
+					return
+				}
+			}
+
+			result(n, func() error {
+				if limiter != nil {
+					select {
+					case limiter <- struct{}{}:
+					case <-ctx.Done():
+						return ErrInterrupted
+					}
+					defer func() { <-limiter }()
+				}
+
+				if stop() {
+					log.Debug("[%s] not started, fail-fast is set", n)
+					return ErrFailFast
+				}
+
+				if ctx.Err() != nil {
+					return ErrInterrupted
+				}
+
+				setRunning(n, true)
+				defer setRunning(n, false)
+				return fn(s)
+			}())
+		}(n)
+	}
+
+	wg.Wait()
+	close(finish)
+	return errs
+}
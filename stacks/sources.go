@@ -9,7 +9,9 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/daidokoro/qaz/bucket"
+	"github.com/daidokoro/qaz/clients"
 	"github.com/daidokoro/qaz/log"
+	"github.com/daidokoro/qaz/repo"
 	"github.com/daidokoro/qaz/utils"
 )
 
@@ -28,6 +30,12 @@ type SourceReceiver interface {
 	// SourceReceivers may require sessions if calling aws resources
 	// like Lambda & S3
 	GetSession() *session.Session
+
+	// GetRepo - returns the git repo file sources are read from, may be nil
+	GetRepo() *repo.Repo
+
+	// GetClients returns the provider of AWS clients, nil for SDK clients
+	GetClients() clients.Provider
 }
 
 // GetSource - takes a Source interface and retrieves source data
@@ -44,6 +52,16 @@ func (s *Stack) GetSession() *session.Session {
 	return s.Session
 }
 
+// GetRepo - Returns the git repo of file sources
+func (s *Stack) GetRepo() *repo.Repo {
+	return s.Repo
+}
+
+// GetClients - Returns the provider of AWS clients used by sources
+func (s *Stack) GetClients() clients.Provider {
+	return s.Clients
+}
+
 // GetSource - takes a Source interface and retrieves source data
 func (c *Config) GetSource(src Source) (err error) {
 	c.String, err = src.Handle()
@@ -58,6 +76,16 @@ func (c *Config) GetSession() *session.Session {
 	return c.Session
 }
 
+// GetRepo - Returns the git repo of file sources
+func (c *Config) GetRepo() *repo.Repo {
+	return c.Repo
+}
+
+// GetClients - Returns the provider of AWS clients used by sources
+func (c *Config) GetClients() clients.Provider {
+	return c.Clients
+}
+
 // FetchSource - uses interfaces to initiate source retreival
 func FetchSource(src string, rcv SourceReceiver) error {
 	var source Source
@@ -72,11 +100,11 @@ func FetchSource(src string, rcv SourceReceiver) error {
 	case "http", "https":
 		source = &HTTPSource{src}
 	case "lambda":
-		source = &LambdaSource{src, rcv.GetSession()}
+		source = &LambdaSource{src, rcv.GetSession(), rcv.GetClients()}
 	case "s3":
-		source = &S3Source{src, rcv.GetSession()}
+		source = &S3Source{src, rcv.GetSession(), rcv.GetClients()}
 	default:
-		source = &FileSource{src}
+		source = &FileSource{src, rcv.GetRepo()}
 	}
 
 	return rcv.GetSource(source)
@@ -99,18 +127,20 @@ func (h HTTPSource) Handle() (string, error) {
 type S3Source struct {
 	Src     string
 	Session *session.Session
+	Clients clients.Provider
 }
 
 // Handle - Source Handle
 func (s3 S3Source) Handle() (string, error) {
 	log.Debug("Source Type: [s3] Detected, Fetching Source: %s", s3.Src)
-	return bucket.S3Read(s3.Src, s3.Session)
+	return bucket.S3Read(s3.Src, s3.Session, s3.Clients)
 }
 
 // LambdaSource - lambda source handle
 type LambdaSource struct {
 	Src     string
 	Session *session.Session
+	Clients clients.Provider
 }
 
 // Handle - Source Handle
@@ -145,7 +175,7 @@ func (l LambdaSource) Handle() (string, error) {
 		payload: event,
 	}
 
-	if err := f.Invoke(l.Session); err != nil {
+	if err := f.Invoke(l.Session, l.Clients); err != nil {
 		return "", err
 	}
 
@@ -155,14 +185,15 @@ func (l LambdaSource) Handle() (string, error) {
 // FileSource - interface type
 // NOTE: file is assumed if no other type if matched
 type FileSource struct {
-	Src string
+	Src  string
+	Repo *repo.Repo
 }
 
 // Handle - Source Handle
 func (f FileSource) Handle() (resp string, err error) {
-	if gitrepo.URL != "" {
+	if f.Repo != nil && f.Repo.URL != "" {
 		log.Debug("Source Type: [git-repo file] Detected, Fetching Source: %s", f.Src)
-		out, ok := gitrepo.Files[f.Src]
+		out, ok := f.Repo.Files[f.Src]
 		if ok {
 			resp = out
 			return
@@ -3,25 +3,21 @@ package stacks
 import (
 	"fmt"
 	"strings"
-	"sync"
 
 	"github.com/daidokoro/qaz/repo"
 
 	"text/template"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/daidokoro/qaz/clients"
 )
 
 var (
-	// define waitGroup
-	wg sync.WaitGroup
-
-	// Git repo for stack deployment
-	gitrepo *repo.Repo
-
 	// OutputRegex for printing yaml/json output
 	OutputRegex = `(?m)^[ ]*([^\r\n:]+?)\s*:`
 )
@@ -49,12 +45,15 @@ type Stack struct {
 	Policy         string
 	Tags           []*cloudformation.Tag
 	Session        *session.Session
+	Clients        clients.Provider
+	Repo           *repo.Repo
 	Profile        string
 	Region         string
 	Source         string
 	Bucket         string
 	Role           string
 	Rollback       bool
+	Lenient        bool
 	GenTimeFunc    *template.FuncMap
 	DeployTimeFunc *template.FuncMap
 	DeployDelims   *string
@@ -72,6 +71,37 @@ type Stack struct {
 
 	// list of SNS notification ARNs
 	NotificationARNs []string
+
+	// StackSet - when set, the stack is deployed as a StackSet
+	StackSet *StackSetConfig
+
+	// Imports - existing resources imported by IMPORT change-sets
+	Imports ImportMapping
+
+	// Hooks - commands & lambdas run before and after stack operations
+	Hooks *Hooks
+
+	// Capabilities - acknowledged capabilities, inferred from the template if not set
+	Capabilities []string
+
+	// OnFailure - create failure policy: DO_NOTHING, ROLLBACK or DELETE
+	OnFailure string
+
+	// RollbackTriggers - alarms monitored during create & update
+	RollbackTriggers *RollbackTriggers
+
+	// TerminationProtection - enables/disables termination protection, unchanged if nil
+	TerminationProtection *bool
+
+	// RoleARN - CloudFormation service role, unlike Role which is
+	// assumed by qaz to make API calls
+	RoleARN string
+
+	// Artifacts - key prefix & encryption of bucket uploads
+	Artifacts *ArtifactConfig
+
+	// root cause of the last failed operation
+	failure *Failure
 }
 
 // SetStackName - sets the.Stackname with struct
@@ -90,6 +120,24 @@ func (s *Stack) creds() *credentials.Credentials {
 	return stscreds.NewCredentials(s.Session, s.Role)
 }
 
+// provider - returns the client provider of the stack, SDK clients if not set
+func (s *Stack) provider() clients.Provider {
+	return clients.Default(s.Clients)
+}
+
+// cfn - returns a CloudFormation client using the stack credentials
+func (s *Stack) cfn() cloudformationiface.CloudFormationAPI {
+	return s.provider().CloudFormation(s.Session, &aws.Config{Credentials: s.creds()})
+}
+
+// region - returns the stack region, defaults to the session region
+func (s *Stack) region() string {
+	if s.Region == "" && s.Session != nil {
+		return aws.StringValue(s.Session.Config.Region)
+	}
+	return s.Region
+}
+
 // delims - returns delimiters for parsing templates
 func (s *Stack) delims(lvl string) (string, string) {
 	if lvl == "deploy" {
@@ -110,8 +158,3 @@ func (s *Stack) delims(lvl string) (string, string) {
 	// default
 	return "{{", "}}"
 }
-
-// Git - set git repo for stack deployments
-func Git(r *repo.Repo) {
-	gitrepo = r
-}
@@ -0,0 +1,611 @@
+package stacks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/daidokoro/qaz/log"
+)
+
+// interval between stack set operation status checks
+var stackSetPollInterval = time.Second * 5
+
+// StackSetConfig - deploys a stack as a StackSet to the given accounts
+// or organizational units and regions
+type StackSetConfig struct {
+	// Accounts - target accounts for self managed stack sets
+	Accounts []string `yaml:"accounts,omitempty" json:"accounts,omitempty" hcl:"accounts,omitempty"`
+
+	// OrganizationalUnits - target OUs for service managed stack sets
+	OrganizationalUnits []string `yaml:"organizational_units,omitempty" json:"organizational_units,omitempty" hcl:"organizational_units,omitempty"`
+
+	// Regions - target regions
+	Regions []string `yaml:"regions" json:"regions" hcl:"regions"`
+
+	// PermissionModel - SELF_MANAGED or SERVICE_MANAGED, defaults to
+	// SERVICE_MANAGED if organizational units are set
+	PermissionModel string `yaml:"permission_model,omitempty" json:"permission_model,omitempty" hcl:"permission_model,omitempty"`
+
+	// AdministrationRoleARN & ExecutionRoleName - roles for self managed stack sets
+	AdministrationRoleARN string `yaml:"administration_role_arn,omitempty" json:"administration_role_arn,omitempty" hcl:"administration_role_arn,omitempty"`
+	ExecutionRoleName     string `yaml:"execution_role_name,omitempty" json:"execution_role_name,omitempty" hcl:"execution_role_name,omitempty"`
+
+	// AutoDeployment - deploy to accounts added to target OUs, service managed only
+	AutoDeployment bool `yaml:"auto_deployment,omitempty" json:"auto_deployment,omitempty" hcl:"auto_deployment,omitempty"`
+
+	// RetainStacksOnAccountRemoval - service managed only
+	RetainStacksOnAccountRemoval bool `yaml:"retain_stacks_on_account_removal,omitempty" json:"retain_stacks_on_account_removal,omitempty" hcl:"retain_stacks_on_account_removal,omitempty"`
+
+	// Preferences - stack set operation preferences
+	Preferences StackSetPreferences `yaml:"preferences,omitempty" json:"preferences,omitempty" hcl:"preferences,omitempty"`
+}
+
+// StackSetPreferences - stack set operation preferences
+type StackSetPreferences struct {
+	FailureToleranceCount      int64    `yaml:"failure_tolerance_count,omitempty" json:"failure_tolerance_count,omitempty" hcl:"failure_tolerance_count,omitempty"`
+	FailureTolerancePercentage int64    `yaml:"failure_tolerance_percentage,omitempty" json:"failure_tolerance_percentage,omitempty" hcl:"failure_tolerance_percentage,omitempty"`
+	MaxConcurrentCount         int64    `yaml:"max_concurrent_count,omitempty" json:"max_concurrent_count,omitempty" hcl:"max_concurrent_count,omitempty"`
+	MaxConcurrentPercentage    int64    `yaml:"max_concurrent_percentage,omitempty" json:"max_concurrent_percentage,omitempty" hcl:"max_concurrent_percentage,omitempty"`
+	RegionOrder                []string `yaml:"region_order,omitempty" json:"region_order,omitempty" hcl:"region_order,omitempty"`
+}
+
+// StackInstance - status of a single stack set instance
+type StackInstance struct {
+	Account string `json:"account" yaml:"account"`
+	Region  string `json:"region" yaml:"region"`
+	Status  string `json:"status" yaml:"status"`
+	Reason  string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// serviceManaged - returns true if the stack set uses the service managed permission model
+func (c *StackSetConfig) serviceManaged() bool {
+	if c.PermissionModel != "" {
+		return c.PermissionModel == cloudformation.PermissionModelsServiceManaged
+	}
+	return len(c.OrganizationalUnits) > 0
+}
+
+// permissionModel - returns the configured or derived permission model
+func (c *StackSetConfig) permissionModel() string {
+	if c.serviceManaged() {
+		return cloudformation.PermissionModelsServiceManaged
+	}
+	return cloudformation.PermissionModelsSelfManaged
+}
+
+// preferences - returns operation preferences, nil if none are set
+func (c *StackSetConfig) preferences() *cloudformation.StackSetOperationPreferences {
+	p := c.Preferences
+	if p.FailureToleranceCount == 0 && p.FailureTolerancePercentage == 0 &&
+		p.MaxConcurrentCount == 0 && p.MaxConcurrentPercentage == 0 && len(p.RegionOrder) == 0 {
+		return nil
+	}
+
+	prefs := &cloudformation.StackSetOperationPreferences{}
+	if p.FailureToleranceCount > 0 {
+		prefs.FailureToleranceCount = aws.Int64(p.FailureToleranceCount)
+	}
+
+	if p.FailureTolerancePercentage > 0 {
+		prefs.FailureTolerancePercentage = aws.Int64(p.FailureTolerancePercentage)
+	}
+
+	if p.MaxConcurrentCount > 0 {
+		prefs.MaxConcurrentCount = aws.Int64(p.MaxConcurrentCount)
+	}
+
+	if p.MaxConcurrentPercentage > 0 {
+		prefs.MaxConcurrentPercentage = aws.Int64(p.MaxConcurrentPercentage)
+	}
+
+	if len(p.RegionOrder) > 0 {
+		prefs.RegionOrder = aws.StringSlice(p.RegionOrder)
+	}
+	return prefs
+}
+
+// Validate - checks stack set targets
+func (c *StackSetConfig) Validate() error {
+	if len(c.Regions) == 0 {
+		return fmt.Errorf("stackset requires at least one region")
+	}
+
+	if c.serviceManaged() {
+		if len(c.OrganizationalUnits) == 0 {
+			return fmt.Errorf("service managed stacksets require organizational_units")
+		}
+		return nil
+	}
+
+	if len(c.Accounts) == 0 {
+		return fmt.Errorf("self managed stacksets require accounts")
+	}
+	return nil
+}
+
+// IsStackSet - returns true if the stack is deployed as a StackSet
+func (s *Stack) IsStackSet() bool {
+	return s.StackSet != nil
+}
+
+// stackSetExists - returns true if the stack set exists and is active
+func (s *Stack) stackSetExists(ctx context.Context) (bool, error) {
+	svc := s.cfn()
+	params := &cloudformation.DescribeStackSetInput{
+		StackSetName: aws.String(s.Stackname),
+	}
+
+	log.Debug("calling [DescribeStackSet] with parameters: %s", params)
+	resp, err := svc.DescribeStackSetWithContext(ctx, params)
+	if err != nil {
+		if strings.Contains(err.Error(), cloudformation.ErrCodeStackSetNotFoundException) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return aws.StringValue(resp.StackSet.Status) == cloudformation.StackSetStatusActive, nil
+}
+
+// StackInstances - returns the instances of the stack set
+func (s *Stack) StackInstances(ctx context.Context) ([]StackInstance, error) {
+	svc := s.cfn()
+	params := &cloudformation.ListStackInstancesInput{
+		StackSetName: aws.String(s.Stackname),
+	}
+
+	var instances []StackInstance
+	for {
+		log.Debug("calling [ListStackInstances] with parameters: %s", params)
+		page, err := svc.ListStackInstancesWithContext(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, i := range page.Summaries {
+			instances = append(instances, StackInstance{
+				Account: aws.StringValue(i.Account),
+				Region:  aws.StringValue(i.Region),
+				Status:  aws.StringValue(i.Status),
+				Reason:  aws.StringValue(i.StatusReason),
+			})
+		}
+
+		if page.NextToken == nil {
+			break
+		}
+		params.NextToken = page.NextToken
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].Account == instances[j].Account {
+			return instances[i].Region < instances[j].Region
+		}
+		return instances[i].Account < instances[j].Account
+	})
+
+	return instances, nil
+}
+
+// deployStackSet - creates or updates the stack set and creates missing stack instances
+func (s *Stack) deployStackSet(ctx context.Context) (string, error) {
+	if err := s.StackSet.Validate(); err != nil {
+		return "", fmt.Errorf("invalid stackset config for [%s]: %v", s.Name, err)
+	}
+
+	if err := s.DeployTimeParser(); err != nil {
+		return "", err
+	}
+
+	// upload local artifacts & rewrite template references
+	if err := s.Package(); err != nil {
+		return "", err
+	}
+
+	exists, err := s.stackSetExists(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var url string
+	if s.Bucket != "" {
+		if url, err = resolveBucket(s); err != nil {
+			return "", err
+		}
+	}
+
+	svc := s.cfn()
+	action := ActionUpdated
+
+	if !exists {
+		params := &cloudformation.CreateStackSetInput{
+			StackSetName:    aws.String(s.Stackname),
+			PermissionModel: aws.String(s.StackSet.permissionModel()),
+			Capabilities:    s.capabilities(),
+		}
+
+		if url != "" {
+			params.TemplateURL = aws.String(url)
+		} else {
+			params.TemplateBody = aws.String(s.Template)
+		}
+
+		if len(s.Parameters) > 0 {
+			params.Parameters = s.Parameters
+		}
+
+		if len(s.Tags) > 0 {
+			params.Tags = s.Tags
+		}
+
+		if s.StackSet.AdministrationRoleARN != "" {
+			params.AdministrationRoleARN = aws.String(s.StackSet.AdministrationRoleARN)
+		}
+
+		if s.StackSet.ExecutionRoleName != "" {
+			params.ExecutionRoleName = aws.String(s.StackSet.ExecutionRoleName)
+		}
+
+		if s.StackSet.serviceManaged() {
+			params.AutoDeployment = &cloudformation.AutoDeployment{
+				Enabled:                      aws.Bool(s.StackSet.AutoDeployment),
+				RetainStacksOnAccountRemoval: aws.Bool(s.StackSet.RetainStacksOnAccountRemoval),
+			}
+		}
+
+		log.Debug("calling [CreateStackSet] with parameters: %s", params)
+		if _, err := svc.CreateStackSetWithContext(ctx, params); err != nil {
+			return "", fmt.Errorf("stackset create failed: %v", err)
+		}
+
+		log.Info("stackset created: [%s]", s.Stackname)
+		action = ActionCreated
+	} else {
+		params := &cloudformation.UpdateStackSetInput{
+			StackSetName:         aws.String(s.Stackname),
+			Capabilities:         s.capabilities(),
+			OperationPreferences: s.StackSet.preferences(),
+		}
+
+		if url != "" {
+			params.TemplateURL = aws.String(url)
+		} else {
+			params.TemplateBody = aws.String(s.Template)
+		}
+
+		if len(s.Parameters) > 0 {
+			params.Parameters = s.Parameters
+		}
+
+		if len(s.Tags) > 0 {
+			params.Tags = s.Tags
+		}
+
+		if s.StackSet.AdministrationRoleARN != "" {
+			params.AdministrationRoleARN = aws.String(s.StackSet.AdministrationRoleARN)
+		}
+
+		if s.StackSet.ExecutionRoleName != "" {
+			params.ExecutionRoleName = aws.String(s.StackSet.ExecutionRoleName)
+		}
+
+		log.Debug("calling [UpdateStackSet] with parameters: %s", params)
+		resp, err := svc.UpdateStackSetWithContext(ctx, params)
+		if err != nil {
+			return "", fmt.Errorf("stackset update failed: %v", err)
+		}
+
+		log.Info("updating stackset instances: [%s]", s.Stackname)
+		if err := s.waitStackSetOperation(ctx, aws.StringValue(resp.OperationId)); err != nil {
+			return "", err
+		}
+	}
+
+	if err := s.createStackInstances(ctx); err != nil {
+		return "", err
+	}
+
+	log.Info("stackset deployment completed: [%s]", s.Stackname)
+	return action, nil
+}
+
+// createStackInstances - creates stack instances for configured targets that do not exist
+func (s *Stack) createStackInstances(ctx context.Context) error {
+	instances, err := s.StackInstances(ctx)
+	if err != nil {
+		return err
+	}
+
+	params := &cloudformation.CreateStackInstancesInput{
+		StackSetName:         aws.String(s.Stackname),
+		OperationPreferences: s.StackSet.preferences(),
+	}
+
+	// existing instances by account/region & region
+	existing := make(map[string]bool)
+	deployed := make(map[string]bool)
+	for _, i := range instances {
+		existing[i.Account+"/"+i.Region] = true
+		deployed[i.Region] = true
+	}
+
+	if s.StackSet.serviceManaged() {
+		// OU targets resolve to accounts, new regions are added for all OUs
+		var regions []string
+		for _, r := range s.StackSet.Regions {
+			if !deployed[r] {
+				regions = append(regions, r)
+			}
+		}
+
+		if len(regions) == 0 {
+			return nil
+		}
+
+		params.DeploymentTargets = &cloudformation.DeploymentTargets{
+			OrganizationalUnitIds: aws.StringSlice(s.StackSet.OrganizationalUnits),
+		}
+		params.Regions = aws.StringSlice(regions)
+	} else {
+		// accounts missing the same regions are created in a single operation
+		accounts := make(map[string][]string)
+		for _, a := range s.StackSet.Accounts {
+			missing := missingRegions(a, s.StackSet.Regions, existing)
+			if len(missing) == 0 {
+				continue
+			}
+
+			k := strings.Join(missing, ",")
+			accounts[k] = append(accounts[k], a)
+		}
+
+		keys := make([]string, 0, len(accounts))
+		for k := range accounts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			p := *params
+			p.Accounts = aws.StringSlice(accounts[k])
+			p.Regions = aws.StringSlice(strings.Split(k, ","))
+			if err := s.runCreateStackInstances(ctx, &p); err != nil {
+				return err
+			}
+		}
+
+		s.warnExtraInstances(instances)
+		return nil
+	}
+
+	return s.runCreateStackInstances(ctx, params)
+}
+
+// missingRegions - returns the regions without an instance for the given account
+func missingRegions(account string, regions []string, existing map[string]bool) []string {
+	var missing []string
+	for _, r := range regions {
+		if !existing[account+"/"+r] {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+// warnExtraInstances - logs stack instances that are no longer in the stack set config
+func (s *Stack) warnExtraInstances(instances []StackInstance) {
+	for _, i := range instances {
+		if !contains(s.StackSet.Accounts, i.Account) || !contains(s.StackSet.Regions, i.Region) {
+			log.Warn("stackset [%s] instance %s/%s is not in config, it is not removed automatically", s.Name, i.Account, i.Region)
+		}
+	}
+}
+
+// contains - returns true if v is in l
+func contains(l []string, v string) bool {
+	for _, i := range l {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
+
+// runCreateStackInstances - calls CreateStackInstances and waits for the operation
+func (s *Stack) runCreateStackInstances(ctx context.Context, params *cloudformation.CreateStackInstancesInput) error {
+	svc := s.cfn()
+
+	log.Debug("calling [CreateStackInstances] with parameters: %s", params)
+	resp, err := svc.CreateStackInstancesWithContext(ctx, params)
+	if err != nil {
+		return fmt.Errorf("stackset instance creation failed: %v", err)
+	}
+
+	log.Info("creating stackset instances: [%s] - regions: %s", s.Stackname, aws.StringValueSlice(params.Regions))
+	return s.waitStackSetOperation(ctx, aws.StringValue(resp.OperationId))
+}
+
+// terminateStackSet - deletes all stack instances and the stack set
+func (s *Stack) terminateStackSet(ctx context.Context) error {
+	exists, err := s.stackSetExists(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		log.Info("%s: does not exist...", s.Name)
+		return nil
+	}
+
+	instances, err := s.StackInstances(ctx)
+	if err != nil {
+		return err
+	}
+
+	svc := s.cfn()
+	if len(instances) > 0 {
+		var accounts, regions []string
+		for _, i := range instances {
+			if !contains(accounts, i.Account) {
+				accounts = append(accounts, i.Account)
+			}
+
+			if !contains(regions, i.Region) {
+				regions = append(regions, i.Region)
+			}
+		}
+
+		params := &cloudformation.DeleteStackInstancesInput{
+			StackSetName:         aws.String(s.Stackname),
+			Regions:              aws.StringSlice(regions),
+			RetainStacks:         aws.Bool(false),
+			OperationPreferences: s.StackSet.preferences(),
+		}
+
+		if s.StackSet.serviceManaged() {
+			params.DeploymentTargets = &cloudformation.DeploymentTargets{
+				OrganizationalUnitIds: aws.StringSlice(s.StackSet.OrganizationalUnits),
+			}
+		} else {
+			params.Accounts = aws.StringSlice(accounts)
+		}
+
+		log.Debug("calling [DeleteStackInstances] with parameters: %s", params)
+		resp, err := svc.DeleteStackInstancesWithContext(ctx, params)
+		if err != nil {
+			return fmt.Errorf("stackset instance deletion failed: %v", err)
+		}
+
+		log.Info("deleting stackset instances: [%s]", s.Stackname)
+		if err := s.waitStackSetOperation(ctx, aws.StringValue(resp.OperationId)); err != nil {
+			return err
+		}
+	}
+
+	params := &cloudformation.DeleteStackSetInput{
+		StackSetName: aws.String(s.Stackname),
+	}
+
+	log.Debug("calling [DeleteStackSet] with parameters: %s", params)
+	if _, err := svc.DeleteStackSetWithContext(ctx, params); err != nil {
+		return fmt.Errorf("stackset deletion failed: %v", err)
+	}
+
+	log.Info("deletion successful: [%s]", s.Stackname)
+	return nil
+}
+
+// waitStackSetOperation - waits for a stack set operation to complete, per-instance
+// results are logged and an error is returned if the operation did not succeed
+func (s *Stack) waitStackSetOperation(ctx context.Context, id string) error {
+	svc := s.cfn()
+	params := &cloudformation.DescribeStackSetOperationInput{
+		StackSetName: aws.String(s.Stackname),
+		OperationId:  aws.String(id),
+	}
+
+	tick := time.NewTicker(stackSetPollInterval)
+	defer tick.Stop()
+
+	var status string
+	for {
+		log.Debug("calling [DescribeStackSetOperation] with parameters: %s", params)
+		resp, err := svc.DescribeStackSetOperationWithContext(ctx, params)
+		if err != nil {
+			return err
+		}
+
+		status = aws.StringValue(resp.StackSetOperation.Status)
+		switch status {
+		case cloudformation.StackSetOperationStatusRunning,
+			cloudformation.StackSetOperationStatusQueued,
+			cloudformation.StackSetOperationStatusStopping:
+
+			select {
+			case <-tick.C:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		break
+	}
+
+	// report per-instance results
+	results := &cloudformation.ListStackSetOperationResultsInput{
+		StackSetName: aws.String(s.Stackname),
+		OperationId:  aws.String(id),
+	}
+
+	for {
+		log.Debug("calling [ListStackSetOperationResults] with parameters: %s", results)
+		page, err := svc.ListStackSetOperationResultsWithContext(ctx, results)
+		if err != nil {
+			log.Debug("failed to list stackset operation results: %v", err)
+			break
+		}
+
+		for _, r := range page.Summaries {
+			lg := log.Info
+			if aws.StringValue(r.Status) != cloudformation.StackSetOperationResultStatusSucceeded {
+				lg = log.Error
+			}
+
+			lg(strings.Trim(strings.Join([]string{
+				s.Stackname,
+				aws.StringValue(r.Account),
+				aws.StringValue(r.Region),
+				log.ColorMap(aws.StringValue(r.Status)),
+				aws.StringValue(r.StatusReason),
+			}, " - "), "- "))
+		}
+
+		if page.NextToken == nil {
+			break
+		}
+		results.NextToken = page.NextToken
+	}
+
+	if status != cloudformation.StackSetOperationStatusSucceeded {
+		return fmt.Errorf("stackset operation [%s] for [%s] finished with status: %s", id, s.Name, status)
+	}
+	return nil
+}
+
+// stackSetStatus - prints the stack set status and the status of each instance
+func (s *Stack) stackSetStatus() error {
+	ctx := context.Background()
+	exists, err := s.stackSetExists(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		fmt.Printf("create_pending -> %s [%s] (stackset)\n", s.Name, s.Stackname)
+		return nil
+	}
+
+	instances, err := s.StackInstances(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf(
+		"%s - %s --> %s - [%s] - %d instance(s)\n",
+		log.ColorString("stackset", log.MAGENTA),
+		strings.ToLower(log.ColorMap(cloudformation.StackSetStatusActive)),
+		s.Name,
+		s.Stackname,
+		len(instances),
+	)
+
+	for _, i := range instances {
+		fmt.Printf("  %s/%s - %s %s\n", i.Account, i.Region, strings.ToLower(log.ColorMap(i.Status)), i.Reason)
+	}
+	return nil
+}
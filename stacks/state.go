@@ -1,6 +1,7 @@
 package stacks
 
 import (
+	"context"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -8,9 +9,27 @@ import (
 	"github.com/daidokoro/qaz/log"
 )
 
+// stack statuses of deployed stacks, stacks in any other status that
+// is not in progress failed to deploy or need to be recovered
+var deployedStatuses = map[string]bool{
+	cloudformation.StackStatusCreateComplete:         true,
+	cloudformation.StackStatusUpdateComplete:         true,
+	cloudformation.StackStatusUpdateRollbackComplete: true,
+	cloudformation.StackStatusImportComplete:         true,
+	cloudformation.StackStatusImportRollbackComplete: true,
+}
+
+// stack statuses of stacks that failed to create, they can't be updated
+// and are deleted & recreated on deploy
+var recreateStatuses = map[string]bool{
+	cloudformation.StackStatusCreateFailed:     true,
+	cloudformation.StackStatusRollbackComplete: true,
+	cloudformation.StackStatusRollbackFailed:   true,
+}
+
 // StackExists - Returns true if stack exists in AWS Account, returns false if err when checking
 func (s *Stack) StackExists() bool {
-	svc := cloudformation.New(s.Session, &aws.Config{Credentials: s.creds()})
+	svc := s.cfn()
 
 	describeStacksInput := &cloudformation.DescribeStacksInput{
 		StackName: aws.String(s.Stackname),
@@ -28,32 +47,34 @@ func (s *Stack) StackExists() bool {
 
 // State - returns complete/failed/pending state of stack
 func (s *Stack) State() (string, error) {
-	svc := cloudformation.New(s.Session, &aws.Config{Credentials: s.creds()})
-
-	describeStacksInput := &cloudformation.DescribeStacksInput{
-		StackName: aws.String(s.Stackname),
+	if s.IsStackSet() {
+		exists, err := s.stackSetExists(context.Background())
+		if err != nil || !exists {
+			return statePending, err
+		}
+		return stateComplete, nil
 	}
 
-	log.Debug("calling [DescribeStacks] with parameters: %s", describeStacksInput)
-	status, err := svc.DescribeStacks(describeStacksInput)
+	status, err := s.StackStatus()
 	if err != nil {
 		if strings.Contains(err.Error(), "not exist") {
-			return state.pending, nil
+			return statePending, nil
 		}
 		return "", err
 	}
 
-	if strings.Contains(strings.ToLower(status.GoString()), "complete") {
-		return state.complete, nil
-	} else if strings.Contains(strings.ToLower(status.GoString()), "fail") {
-		return state.failed, nil
+	switch {
+	case strings.HasSuffix(status, "_IN_PROGRESS"):
+		return "", nil
+	case deployedStatuses[status]:
+		return stateComplete, nil
 	}
-	return "", nil
+	return stateFailed, nil
 }
 
 // ChangeSetStatus - returns the literal change-set status
 func (s *Stack) ChangeSetStatus(args ...string) (string, error) {
-	svc := cloudformation.New(s.Session, &aws.Config{Credentials: s.creds()})
+	svc := s.cfn()
 
 	params := &cloudformation.DescribeChangeSetInput{
 		StackName:     aws.String(s.Stackname),
@@ -72,7 +93,7 @@ func (s *Stack) ChangeSetStatus(args ...string) (string, error) {
 
 // StackStatus - return the literal stack status
 func (s *Stack) StackStatus(args ...string) (string, error) {
-	svc := cloudformation.New(s.Session, &aws.Config{Credentials: s.creds()})
+	svc := s.cfn()
 	params := &cloudformation.DescribeStacksInput{
 		StackName: aws.String(s.Stackname),
 	}
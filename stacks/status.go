@@ -12,7 +12,11 @@ import (
 
 // Status - Checks stack status, pending, failed, complete
 func (s *Stack) Status() error {
-	svc := cloudformation.New(s.Session, &aws.Config{Credentials: s.creds()})
+	if s.IsStackSet() {
+		return s.stackSetStatus()
+	}
+
+	svc := s.cfn()
 
 	describeStacksInput := &cloudformation.DescribeStacksInput{
 		StackName: aws.String(s.Stackname),
@@ -1,69 +1,36 @@
 package stacks
 
 import (
-	"strings"
+	"context"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/daidokoro/qaz/log"
 )
 
-// tail - tracks the progress during stack updates. c - command Type
-func (s *Stack) tail(c string, done <-chan bool) {
-	svc := cloudformation.New(s.Session, &aws.Config{Credentials: s.creds()})
+// events older than the start of a tail by more than tailSkew are
+// never printed, allows for clock differences with cloudformation
+const tailSkew = time.Minute
 
-	params := &cloudformation.DescribeStackEventsInput{
-		StackName: aws.String(s.Stackname),
-	}
-
-	// used to track what lines have already been printed, to prevent dubplicate output
-	printed := make(map[string]interface{})
-
-	// NOTE: for loop with instant start ticker
-	for ch := time.Tick(time.Millisecond * 1300); ; <-ch {
-		select {
-		case <-done:
-			log.Debug("Tail run.Completed")
-			return
-		default:
-			// If channel is not populated, run verbose cf print
-			log.Debug("calling [DescribeStackEvents] with parameters: %s", params)
-			stackevents, err := svc.DescribeStackEvents(params)
-			if err != nil {
-				log.Debug("error when tailing events: %v", err)
-				continue
-			}
-
-			log.Debug("response: %s", stackevents)
-
-			event := stackevents.StackEvents[0]
-
-			statusReason := ""
-			var lg = log.Info
-			if strings.Contains(*event.ResourceStatus, "FAILED") {
-				statusReason = *event.ResourceStatusReason
-				lg = log.Error
-			}
-
-			line := strings.Join([]string{
-				*event.StackName,
-				log.ColorMap(*event.ResourceStatus),
-				*event.ResourceType,
-				*event.LogicalResourceId,
-				statusReason,
-			}, " - ")
-
-			if _, ok := printed[line]; !ok {
-				evt := strings.Split(*event.ResourceStatus, "_")[0]
-				if evt == c || c == "" || strings.Contains(strings.ToLower(evt), "rollback") {
-					lg(strings.Trim(line, "- "))
-				}
+// tail - prints the events of the current stack operation in the background
+// until ctx is done or stop is called. stop waits for the tail to return, so
+// no events are printed after the operation that started it has returned.
+func (s *Stack) tail(ctx context.Context) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
 
-				printed[line] = nil
-			}
+	e := s.EventStreamer(time.Now().Add(-tailSkew))
+	e.Operation = true
 
+	go func() {
+		defer close(done)
+		if err := e.Stream(ctx); err != nil {
+			log.Debug("error when tailing events: %v", err)
 		}
+		log.Debug("Tail run.Completed")
+	}()
 
+	return func() {
+		cancel()
+		<-done
 	}
 }
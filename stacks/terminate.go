@@ -1,50 +1,50 @@
 package stacks
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/daidokoro/qaz/log"
 )
 
-func (s *Stack) terminate() error {
+func (s *Stack) terminate(ctx context.Context) error {
 	log.Debug("terminate called for: [%s]", s.Name)
 	if !s.StackExists() {
 		log.Info("%s: does not exist...", s.Name)
 		return nil
 	}
 
-	done := make(chan bool)
-	svc := cloudformation.New(s.Session, &aws.Config{Credentials: s.creds()})
+	svc := s.cfn()
 
 	params := &cloudformation.DeleteStackInput{
 		StackName: aws.String(s.Stackname),
 	}
 
-	// create wait handler for tail
-	var tailinput = TailServiceInput{
-		printed: make(map[string]interface{}),
-		stk:     *s,
-		command: "DELETE",
-	}
-
-	go tailWait(done, &tailinput)
-
+	start := time.Now()
 	log.Debug("calling [DeleteStack] with parameters: %s", params)
-	if _, err := svc.DeleteStack(params); err != nil {
-		done <- true
+	if _, err := svc.DeleteStackWithContext(ctx, params); err != nil {
 		return errors.New(fmt.Sprintln("Deleting failed: ", err))
 	}
 
-	if err := svc.WaitUntilStackDeleteComplete(&cloudformation.DescribeStacksInput{
+	// tail events until the stack is deleted or ctx is cancelled
+	stop := s.tail(ctx)
+	defer stop()
+
+	if err := svc.WaitUntilStackDeleteCompleteWithContext(ctx, &cloudformation.DescribeStacksInput{
 		StackName: aws.String(s.Stackname),
 	}); err != nil {
+		stop()
+		err = s.failed(ctx, start, err)
+		if status, serr := s.StackStatus(); serr == nil && status == cloudformation.StackStatusDeleteFailed {
+			return fmt.Errorf("%v - stack is in %s, use [qaz recover %s --retain] to retry", err, status, s.Name)
+		}
 		return err
 	}
 
-	done <- true
 	log.Info("deletion successful: [%s]", s.Stackname)
 
 	return nil
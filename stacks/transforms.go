@@ -1,7 +1,9 @@
 package stacks
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
@@ -11,7 +13,7 @@ import (
 // support for SAM - Serverless Arch Model Cloudformation templates
 
 // DeploySAM deploys SAMs Cloudformation templates
-func (s *Stack) DeploySAM() error {
+func (s *Stack) DeploySAM(ctx context.Context) error {
 	changename := fmt.Sprintf("%s-change-set", s.Stackname)
 	log.Info(
 		"%s [SAM] deploy detected via [%s]: deploying serverless template via change-set",
@@ -19,27 +21,33 @@ func (s *Stack) DeploySAM() error {
 		s.Stackname,
 	)
 
-	if err := s.Change(transform, changename); err != nil {
+	if err := s.Change(ctx, transform, changename); err != nil {
 		return err
 	}
 
-	if err := s.Change(serverless, changename); err != nil {
+	start := time.Now()
+	if err := s.Change(ctx, serverless, changename); err != nil {
 		return err
 	}
 
-	done := make(chan bool)
-	svc := cloudformation.New(s.Session, &aws.Config{Credentials: s.creds()})
-	go s.tail("CREATE", done)
+	stop := s.tail(ctx)
+	defer stop()
+
+	svc := s.cfn()
 	describeStacksInput := &cloudformation.DescribeStacksInput{
 		StackName: aws.String(s.Stackname),
 	}
 
 	log.Debug("Calling [WaitUntilStackCreateComplete] with parameters: %s", describeStacksInput)
-	if err := svc.WaitUntilStackCreateComplete(describeStacksInput); err != nil {
+	if err := svc.WaitUntilStackCreateCompleteWithContext(ctx, describeStacksInput); err != nil {
+		stop()
+		return s.failed(ctx, start, err)
+	}
+
+	if err := s.applyTerminationProtection(ctx); err != nil {
 		return err
 	}
 
-	done <- true
 	log.Info(
 		"%s [SAM] - deploy completed - %s",
 		log.ColorString("serverless", log.CYAN),
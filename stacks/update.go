@@ -1,6 +1,7 @@
 package stacks
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
@@ -8,23 +9,36 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
-	"github.com/daidokoro/qaz/bucket"
 	"github.com/daidokoro/qaz/log"
 )
 
+// ErrNoUpdates - returned by Update when the stack is already up to date
+var ErrNoUpdates = errors.New("no updates are to be performed")
+
 // Update - Update Cloudformation Stack
-func (s *Stack) Update() error {
+func (s *Stack) Update(ctx context.Context) error {
+
+	if !s.StackExists() {
+		return fmt.Errorf("update failed: stack [%s] does not exist", s.Stackname)
+	}
 
 	err := s.DeployTimeParser()
 	if err != nil {
 		return err
 	}
 
-	done := make(chan bool)
-	svc := cloudformation.New(s.Session, &aws.Config{Credentials: s.creds()})
+	// upload local artifacts & rewrite template references
+	if err := s.Package(); err != nil {
+		return err
+	}
+
+	svc := s.cfn()
 	updateParams := &cloudformation.UpdateStackInput{
-		StackName:    aws.String(s.Stackname),
-		TemplateBody: aws.String(s.Template),
+		StackName:             aws.String(s.Stackname),
+		TemplateBody:          aws.String(s.Template),
+		Capabilities:          s.capabilities(),
+		RollbackConfiguration: s.rollbackConfiguration(),
+		RoleARN:               s.roleARN(),
 	}
 
 	// NOTE: Add parameters and tags flag here if set
@@ -42,64 +56,57 @@ func (s *Stack) Update() error {
 
 	// If bucket - upload to s3
 	if s.Bucket != "" {
-		exists, err := bucket.Exists(s.Bucket, s.Session)
-		if err != nil {
-			log.Warn("Received Error when checking if [%s] exists: %v", s.Bucket, err)
-		}
-
-		if !exists {
-			log.Info("Creating Bucket [%s]", s.Bucket)
-			if err = bucket.Create(s.Bucket, s.Session); err != nil {
-				return err
-			}
-		}
-		t := time.Now()
-		tStamp := fmt.Sprintf("%d-%d-%d_%d%d", t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute())
-		url, err := bucket.S3write(s.Bucket, fmt.Sprintf("%s_%s.Template", s.Stackname, tStamp), s.Template, s.Session)
+		url, err := resolveBucket(s)
 		if err != nil {
 			return err
 		}
 		updateParams.TemplateURL = &url
-	} else {
-		updateParams.TemplateBody = &s.Template
+		updateParams.TemplateBody = nil
 	}
 
-	// NOTE: Add parameters flag here if params set
-	if len(s.Parameters) > 0 {
-		updateParams.Parameters = s.Parameters
-	}
+	log.Info("Stack exists, updating...")
 
-	// If IAM is being touched, add Capabilities
-	if strings.Contains(s.Template, "AWS::IAM") {
-		updateParams.Capabilities = []*string{
-			aws.String(cloudformation.CapabilityCapabilityIam),
-			aws.String(cloudformation.CapabilityCapabilityNamedIam),
+	start := time.Now()
+	log.Debug("calling [UpdateStack] with parameters: %s", updateParams)
+	if _, err = svc.UpdateStackWithContext(ctx, updateParams); err != nil {
+		if strings.Contains(err.Error(), "No updates are to be performed") {
+			return ErrNoUpdates
 		}
+		return errors.New(fmt.Sprintln("Update failed: ", err))
 	}
 
-	if s.StackExists() {
-		log.Info("Stack exists, updating...")
-
-		log.Debug("calling [UpdateStack] with parameters: %s", updateParams)
-		_, err := svc.UpdateStack(updateParams)
+	stop := s.tail(ctx)
+	defer stop()
 
-		if err != nil {
-			return errors.New(fmt.Sprintln("Update failed: ", err))
-		}
+	describeStacksInput := &cloudformation.DescribeStacksInput{
+		StackName: aws.String(s.Stackname),
+	}
+	log.Debug("calling [WaitUntilStackUpdateComplete] with parameters: %s", describeStacksInput)
+	if err := svc.WaitUntilStackUpdateCompleteWithContext(ctx, describeStacksInput); err != nil {
+		stop()
+		return s.failed(ctx, start, err)
+	}
 
-		go s.tail("UPDATE", done)
+	if err := s.applyTerminationProtection(ctx); err != nil {
+		return err
+	}
 
-		describeStacksInput := &cloudformation.DescribeStacksInput{
-			StackName: aws.String(s.Stackname),
-		}
-		log.Debug("calling [WaitUntilStackUpdateComplete] with parameters: %s", describeStacksInput)
-		if err := svc.WaitUntilStackUpdateComplete(describeStacksInput); err != nil {
-			return err
-		}
+	log.Info("stack update successful: [%s]", s.Stackname)
+	return nil
+}
 
-		log.Info("stack update successful: [%s]", s.Stackname)
+// CancelUpdate - cancels an in-progress stack update, the stack is rolled back
+func (s *Stack) CancelUpdate() error {
+	svc := s.cfn()
+	params := &cloudformation.CancelUpdateStackInput{
+		StackName: aws.String(s.Stackname),
+	}
 
+	log.Debug("calling [CancelUpdateStack] with parameters: %s", params)
+	if _, err := svc.CancelUpdateStack(params); err != nil {
+		return err
 	}
-	done <- true
+
+	log.Warn("update cancelled, rolling back stack: [%s]", s.Stackname)
 	return nil
 }
@@ -0,0 +1,419 @@
+package stacks
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/daidokoro/hcl"
+	"github.com/daidokoro/qaz/log"
+	"github.com/hashicorp/hcl/hcl/ast"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	// matches line prefixed yaml errors, i.e. line 4: field x not found in type y
+	yamlLineRegex = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+	// matches yaml unknown field errors
+	yamlFieldRegex = regexp.MustCompile(`^field (\S+) not found in type (\S+)$`)
+
+	// matches stack_output references in configs & templates
+	stackOutputRegex = regexp.MustCompile(`stack_output\s+"([^"]*?)::`)
+)
+
+// ConfigError - config validation error, includes the
+// source file and line where the error was found
+type ConfigError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+// Error - implements the error interface
+func (e ConfigError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s", e.File, e.Msg)
+}
+
+// ConfigErrors - list of config validation errors
+type ConfigErrors []ConfigError
+
+// Error - implements the error interface
+func (e ConfigErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("invalid config:\n%s", strings.Join(msgs, "\n"))
+}
+
+// Validate - checks config for unknown keys, invalid delimiters and
+// references to stacks that are not defined in the config.
+func (c *Config) Validate() error {
+	log.Debug("validating config: [%s]", c.File)
+	var errs ConfigErrors
+
+	errs = append(errs, c.validateKeys()...)
+	for _, o := range c.overlays {
+		errs = append(errs, o.validateKeys()...)
+	}
+
+	errs = append(errs, c.validateDelims()...)
+	errs = append(errs, c.validateRefs()...)
+	errs = append(errs, c.validateCycles()...)
+	errs = append(errs, c.validateBlocks()...)
+
+	if c.Artifacts != nil {
+		if err := c.Artifacts.Validate(); err != nil {
+			errs = append(errs, c.newError(c.lineOf(0, "artifacts"), "%v", err))
+		}
+	}
+
+	if c.Endpoints != nil {
+		if err := c.Endpoints.Validate(); err != nil {
+			errs = append(errs, c.newError(c.lineOf(0, "endpoints"), "%v", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// newError - returns a ConfigError for the config source
+func (c *Config) newError(line int, msg string, args ...interface{}) ConfigError {
+	file := c.File
+	if file == "" {
+		file = "config"
+	}
+	return ConfigError{File: file, Line: line, Msg: fmt.Sprintf(msg, args...)}
+}
+
+// validateKeys - checks config source for keys that are not part of the config schema
+func (c *Config) validateKeys() (errs ConfigErrors) {
+	src := strings.TrimSpace(c.String)
+	if src == "" {
+		return
+	}
+
+	// NOTE: JSON is valid YAML, the yaml parser is used for JSON as it
+	// reports line numbers for unknown fields
+	if !strings.HasPrefix(src, "{") {
+		if f, err := hcl.Parse(c.String); err == nil {
+			c.walkHCL(f.Node, reflect.TypeOf(Config{}), "config", &errs)
+			return
+		}
+	}
+
+	var strict Config
+	err := yaml.UnmarshalStrict([]byte(c.String), &strict)
+	if err == nil {
+		return
+	}
+
+	var msgs []string
+	switch e := err.(type) {
+	case *yaml.TypeError:
+		msgs = e.Errors
+	default:
+		msgs = []string{err.Error()}
+	}
+
+	for _, m := range msgs {
+		m = strings.TrimSpace(m)
+		match := yamlLineRegex.FindStringSubmatch(m)
+		if match == nil {
+			errs = append(errs, c.newError(0, m))
+			continue
+		}
+
+		line, _ := strconv.Atoi(match[1])
+		if f := yamlFieldRegex.FindStringSubmatch(match[2]); f != nil {
+			errs = append(errs, c.newError(line, "unknown key [%s] in %s", f[1], schemaName(f[2])))
+			continue
+		}
+		errs = append(errs, c.newError(line, match[2]))
+	}
+	return
+}
+
+// walkHCL - checks an HCL node against the given config type
+func (c *Config) walkHCL(n ast.Node, t reflect.Type, path string, errs *ConfigErrors) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		var list *ast.ObjectList
+		switch o := n.(type) {
+		case *ast.ObjectList:
+			list = o
+		case *ast.ObjectType:
+			list = o.List
+		default:
+			return
+		}
+
+		for _, item := range list.Items {
+			c.walkHCLItem(item.Keys, item.Val, t, path, errs)
+		}
+
+	case reflect.Slice:
+		if l, ok := n.(*ast.ListType); ok {
+			for _, i := range l.List {
+				c.walkHCL(i, t.Elem(), path, errs)
+			}
+			return
+		}
+
+		// repeated blocks are decoded as slices
+		c.walkHCL(n, t.Elem(), path, errs)
+	}
+}
+
+// walkHCLItem - checks the keys of an HCL object item against the given config type
+func (c *Config) walkHCLItem(keys []*ast.ObjectKey, val ast.Node, t reflect.Type, path string, errs *ConfigErrors) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if len(keys) == 0 {
+		c.walkHCL(val, t, path, errs)
+		return
+	}
+
+	key := fmt.Sprint(keys[0].Token.Value())
+
+	switch t.Kind() {
+	case reflect.Struct:
+		f, ok := fieldByTag(t, "hcl", key)
+		if !ok {
+			*errs = append(*errs, c.newError(keys[0].Pos().Line, "unknown key [%s] in %s", key, path))
+			return
+		}
+		c.walkHCLItem(keys[1:], val, f.Type, fmt.Sprintf("%s.%s", path, key), errs)
+	case reflect.Map:
+		c.walkHCLItem(keys[1:], val, t.Elem(), fmt.Sprintf("%s.%s", path, key), errs)
+	case reflect.Slice:
+		c.walkHCLItem(keys, val, t.Elem(), path, errs)
+	}
+}
+
+// fieldByTag - returns the struct field with the given tag name
+func fieldByTag(t reflect.Type, tag, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		n := strings.Split(f.Tag.Get(tag), ",")[0]
+		if n == "" || n == "-" {
+			continue
+		}
+
+		if strings.EqualFold(n, name) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// schemaName - returns a readable name for config types in yaml errors
+func schemaName(t string) string {
+	switch t {
+	case "stacks.Config":
+		return "config"
+	case "stacks.StackConfig":
+		return "stack config"
+	}
+	return t
+}
+
+// validateDelims - checks gen_time & deploy_time delimiters are of the form left:right
+func (c *Config) validateDelims() (errs ConfigErrors) {
+	delims := []struct {
+		key, value, def string
+	}{
+		{"gen_time", c.GenerateDelimiter, "{{:}}"},
+		{"deploy_time", c.DeployDelimiter, "<<:>>"},
+	}
+
+	values := make(map[string]string)
+	for _, d := range delims {
+		values[d.key] = d.def
+		if d.value == "" {
+			continue
+		}
+
+		parts := strings.Split(d.value, ":")
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			errs = append(errs, c.newError(
+				c.lineOf(0, d.key),
+				"invalid %s delimiters [%s], expected format: left:right, i.e %s", d.key, d.value, d.def,
+			))
+			continue
+		}
+
+		if parts[0] == parts[1] {
+			errs = append(errs, c.newError(
+				c.lineOf(0, d.key),
+				"invalid %s delimiters [%s], left and right delimiters must differ", d.key, d.value,
+			))
+			continue
+		}
+		values[d.key] = d.value
+	}
+
+	if values["gen_time"] == values["deploy_time"] {
+		errs = append(errs, c.newError(
+			c.lineOf(0, "deploy_time"),
+			"gen_time and deploy_time delimiters must differ: [%s]", values["deploy_time"],
+		))
+	}
+	return
+}
+
+// validateRefs - checks that depends_on & stack_output references name stacks in the config
+func (c *Config) validateRefs() (errs ConfigErrors) {
+	names := make([]string, 0, len(c.Stacks))
+	for name := range c.Stacks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		stk := c.Stacks[name]
+		start := c.lineOf(0, name)
+		for _, dep := range stk.DependsOn {
+			if _, ok := c.Stacks[dep]; !ok {
+				errs = append(errs, c.newError(
+					c.lineOf(start, dep),
+					"stack [%s] depends on [%s], which is not defined in config", name, dep,
+				))
+			}
+		}
+
+		// check stack_output references in local template sources
+		if src, ok := localSource(stk.Source); ok {
+			b, err := ioutil.ReadFile(src)
+			if err != nil {
+				log.Debug("unable to read template [%s] for validation: %v", src, err)
+				continue
+			}
+			errs = append(errs, c.outputRefs(src, string(b))...)
+		}
+	}
+
+	errs = append(errs, c.outputRefs(c.File, c.String)...)
+	return
+}
+
+// validateCycles - checks stack dependencies for cycles
+func (c *Config) validateCycles() (errs ConfigErrors) {
+	deps := make(map[string][]string)
+	for name, stk := range c.Stacks {
+		deps[name] = []string{}
+		for _, d := range stk.DependsOn {
+			// missing dependencies are reported by validateRefs
+			if _, ok := c.Stacks[d]; ok {
+				deps[name] = append(deps[name], d)
+			}
+		}
+	}
+
+	g, err := buildGraph(deps)
+	if err != nil {
+		return
+	}
+
+	if cycle := g.cycle(); cycle != nil {
+		errs = append(errs, c.newError(
+			c.lineOf(0, cycle[0]),
+			"dependency cycle detected: %s", strings.Join(cycle, " -> "),
+		))
+	}
+	return
+}
+
+// validateBlocks - checks the stack options, stackset targets & hooks of stack configs
+func (c *Config) validateBlocks() (errs ConfigErrors) {
+	names := make([]string, 0, len(c.Stacks))
+	for name := range c.Stacks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		stk := c.Stacks[name]
+		line := c.lineOf(0, name)
+
+		if err := stk.validateOptions(); err != nil {
+			errs = append(errs, c.newError(line, "stack [%s]: %v", name, err))
+		}
+
+		if stk.StackSet != nil {
+			if err := stk.StackSet.Validate(); err != nil {
+				errs = append(errs, c.newError(c.lineOf(line, "stackset"), "stack [%s]: %v", name, err))
+			}
+		}
+
+		if stk.Hooks != nil {
+			if err := stk.Hooks.Validate(); err != nil {
+				errs = append(errs, c.newError(c.lineOf(line, "hooks"), "stack [%s]: %v", name, err))
+			}
+		}
+	}
+	return
+}
+
+// outputRefs - checks stack_output references in the given source
+func (c *Config) outputRefs(file, src string) (errs ConfigErrors) {
+	for i, line := range strings.Split(src, "\n") {
+		for _, m := range stackOutputRegex.FindAllStringSubmatch(line, -1) {
+			if _, ok := c.Stacks[m[1]]; !ok {
+				e := c.newError(i+1, "stack_output references stack [%s], which is not defined in config", m[1])
+				if file != "" {
+					e.File = file
+				}
+				errs = append(errs, e)
+			}
+		}
+	}
+	return
+}
+
+// lineOf - returns the first line at or after line from that contains the given word
+func (c *Config) lineOf(from int, word string) int {
+	re := regexp.MustCompile(fmt.Sprintf(`(^|[^\w-])%s($|[^\w-])`, regexp.QuoteMeta(word)))
+	for i, line := range strings.Split(c.String, "\n") {
+		if i+1 < from {
+			continue
+		}
+
+		if re.MatchString(line) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// localSource - returns the file path if src is a local file source
+func localSource(src string) (string, bool) {
+	if src == "" {
+		return "", false
+	}
+
+	uri, err := url.Parse(src)
+	if err != nil || uri.Scheme != "" {
+		return "", false
+	}
+	return src, true
+}
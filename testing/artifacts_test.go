@@ -0,0 +1,58 @@
+package testing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daidokoro/qaz/bucket"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestPruneKeys(t *testing.T) {
+	now := time.Now()
+	objects := []bucket.Object{
+		{Key: "qaz/vpc/a.template", LastModified: now.Add(-4 * time.Hour)},
+		{Key: "qaz/vpc/b.template", LastModified: now.Add(-1 * time.Hour)},
+		{Key: "qaz/vpc/c.template", LastModified: now.Add(-3 * time.Hour)},
+		{Key: "qaz/vpc/d.template", LastModified: now},
+	}
+
+	assert.Equal(t, []string{"qaz/vpc/c.template", "qaz/vpc/a.template"}, stacks.PruneKeys(objects, 2, ""))
+
+	// deployed template is kept and not counted
+	assert.Equal(t, []string{"qaz/vpc/c.template"}, stacks.PruneKeys(objects, 2, "qaz/vpc/a.template"))
+	assert.Len(t, stacks.PruneKeys(objects, 0, ""), 4)
+	assert.Empty(t, stacks.PruneKeys(objects, 10, ""))
+}
+
+func TestBucketURL(t *testing.T) {
+	assert.Equal(t, "https://bucket.s3.amazonaws.com/qaz/vpc/a.template", bucket.URL("bucket", "qaz/vpc/a.template", "us-east-1"))
+	assert.Equal(t, "https://bucket.s3.eu-west-1.amazonaws.com/a.template", bucket.URL("bucket", "a.template", "eu-west-1"))
+}
+
+func TestArtifactsConfig(t *testing.T) {
+	src := `project: qaz-test
+artifacts:
+  prefix: qaz/templates
+  sse: aws:kms
+  kms_key_id: alias/qaz
+stacks:
+  vpc:
+    bucket: qaz-bucket
+`
+	assert.Nil(t, validate(t, src, yaml.Unmarshal))
+
+	src = `project: qaz-test
+artifacts:
+  sse: AES256
+  kms_key_id: alias/qaz
+stacks:
+  vpc:
+    bucket: qaz-bucket
+`
+	errs := validate(t, src, yaml.Unmarshal)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "config:2: artifacts kms_key_id requires sse [aws:kms]", errs[0].Error())
+}
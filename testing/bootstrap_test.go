@@ -0,0 +1,134 @@
+package testing
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/daidokoro/qaz/bucket"
+	"github.com/daidokoro/qaz/clients/fake"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketPolicy(t *testing.T) {
+	p, err := bucket.Policy("qaz-artifacts", "123456789012")
+	assert.NoError(t, err)
+
+	var doc struct {
+		Statement []struct {
+			Effect    string
+			Resource  []string
+			Condition map[string]map[string]string
+		}
+	}
+	assert.NoError(t, json.Unmarshal([]byte(p), &doc))
+	assert.Len(t, doc.Statement, 2)
+
+	for _, s := range doc.Statement {
+		assert.Equal(t, "Deny", s.Effect)
+		assert.Equal(t, []string{"arn:aws:s3:::qaz-artifacts", "arn:aws:s3:::qaz-artifacts/*"}, s.Resource)
+	}
+
+	assert.Equal(t, "false", doc.Statement[0].Condition["Bool"]["aws:SecureTransport"])
+	assert.Equal(t, "123456789012", doc.Statement[1].Condition["StringNotEquals"]["aws:PrincipalAccount"])
+}
+
+func TestBucketOptions(t *testing.T) {
+	var a *stacks.ArtifactConfig
+	opts := a.BucketOptions("eu-west-1")
+	assert.Equal(t, bucket.DefaultOptions("eu-west-1"), opts)
+	assert.Equal(t, "AES256", opts.Encryption.SSE)
+
+	a = &stacks.ArtifactConfig{Prefix: "qaz", SSE: "aws:kms", KMSKeyID: "alias/qaz", NoncurrentDays: 90, RestrictToAccount: true}
+	opts = a.BucketOptions("eu-west-1")
+	assert.Equal(t, "eu-west-1", opts.Region)
+	assert.Equal(t, &bucket.Encryption{SSE: "aws:kms", KMSKeyID: "alias/qaz"}, opts.Encryption)
+	assert.Equal(t, int64(90), opts.NoncurrentDays)
+	assert.True(t, opts.RestrictToAccount)
+	assert.Equal(t, "qaz", opts.Prefix)
+
+	assert.Error(t, (&stacks.ArtifactConfig{NoncurrentDays: -1}).Validate())
+}
+
+func TestBootstrap(t *testing.T) {
+	b := fake.New("eu-west-1")
+
+	opts := bucket.DefaultOptions("eu-west-1")
+	opts.RestrictToAccount = true
+
+	// created buckets get all settings
+	assert.NoError(t, bucket.Bootstrap("qaz-new", opts, sess, b.Clients()))
+	s, ok := b.S3.Settings("qaz-new")
+	assert.True(t, ok)
+	assert.Equal(t, "Enabled", s.Versioning)
+	assert.NotNil(t, s.Encryption)
+	assert.NotNil(t, s.PublicAccessBlock)
+	assert.Len(t, s.Lifecycle, 1)
+	assert.Contains(t, s.Policy, "DenyOtherAccounts")
+
+	// existing buckets keep their settings, rules & statements are merged
+	shared := aws.String("qaz-shared")
+	_, err := b.S3.CreateBucket(&s3.CreateBucketInput{Bucket: shared})
+	assert.NoError(t, err)
+	_, err = b.S3.PutBucketLifecycleConfiguration(&s3.PutBucketLifecycleConfigurationInput{
+		Bucket: shared,
+		LifecycleConfiguration: &s3.BucketLifecycleConfiguration{
+			Rules: []*s3.LifecycleRule{{ID: aws.String("logs"), Prefix: aws.String("logs/"), Status: aws.String("Enabled")}},
+		},
+	})
+	assert.NoError(t, err)
+	_, err = b.S3.PutBucketPolicy(&s3.PutBucketPolicyInput{
+		Bucket: shared,
+		Policy: aws.String(`{"Version":"2012-10-17","Statement":{"Sid":"AllowLogs","Effect":"Allow","Principal":{"Service":"logging.s3.amazonaws.com"},"Action":"s3:PutObject","Resource":"arn:aws:s3:::qaz-shared/*"}}`),
+	})
+	assert.NoError(t, err)
+
+	policySids := func(p string) (sids []string) {
+		var doc struct{ Statement []struct{ Sid string } }
+		assert.NoError(t, json.Unmarshal([]byte(p), &doc))
+		for _, s := range doc.Statement {
+			sids = append(sids, s.Sid)
+		}
+		return
+	}
+
+	ruleIDs := func(rules []*s3.LifecycleRule) (ids []string) {
+		for _, r := range rules {
+			ids = append(ids, aws.StringValue(r.ID))
+		}
+		return
+	}
+
+	// the lifecycle rule is only added to existing buckets for an artifacts prefix
+	assert.NoError(t, bucket.Bootstrap("qaz-shared", opts, sess, b.Clients()))
+	s, _ = b.S3.Settings("qaz-shared")
+	assert.Equal(t, []string{"logs"}, ruleIDs(s.Lifecycle))
+
+	// bootstrapping twice doesn't duplicate rules or statements
+	opts.Prefix = "qaz"
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, bucket.Bootstrap("qaz-shared", opts, sess, b.Clients()))
+	}
+	s, _ = b.S3.Settings("qaz-shared")
+	assert.Equal(t, "", s.Versioning)
+	assert.Nil(t, s.PublicAccessBlock)
+	assert.NotNil(t, s.Encryption)
+	assert.Equal(t, []string{"qaz-artifacts", "logs"}, ruleIDs(s.Lifecycle))
+	assert.Equal(t, "qaz/", aws.StringValue(s.Lifecycle[0].Filter.Prefix))
+
+	// legacy prefixes are converted to filters, S3 rejects mixing them
+	assert.Nil(t, s.Lifecycle[1].Prefix)
+	assert.Equal(t, "logs/", aws.StringValue(s.Lifecycle[1].Filter.Prefix))
+	assert.Equal(t, []string{"AllowLogs", "DenyInsecureTransport", "DenyOtherAccounts"}, policySids(s.Policy))
+
+	// force replaces the settings
+	opts.Force = true
+	assert.NoError(t, bucket.Bootstrap("qaz-shared", opts, sess, b.Clients()))
+	s, _ = b.S3.Settings("qaz-shared")
+	assert.Equal(t, "Enabled", s.Versioning)
+	assert.NotNil(t, s.PublicAccessBlock)
+	assert.Equal(t, []string{"qaz-artifacts"}, ruleIDs(s.Lifecycle))
+	assert.Equal(t, []string{"DenyInsecureTransport", "DenyOtherAccounts"}, policySids(s.Policy))
+}
@@ -8,21 +8,33 @@ import (
 
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/daidokoro/qaz/bucket"
+	"github.com/daidokoro/qaz/clients"
+	"github.com/daidokoro/qaz/clients/fake"
 	"github.com/stretchr/testify/assert"
 )
 
 const (
-	// a dummy object existing in S3
+	// a dummy object written to the fake S3 backend
 	s3uri = "s3://daidokoro-dev/qaz_testing.txt"
 	body  = "3347e9fbc394bd6110c8a57da41c4abf"
 )
 
+// mockS3 - returns the clients of a fake backend with the dummy bucket
+func mockS3(t *testing.T) clients.Provider {
+	c := fake.New("eu-west-1").Clients()
+	assert.NoError(t, bucket.Create("daidokoro-dev", sess, c))
+	return c
+}
+
 func TestS3Write(t *testing.T) {
+	c := mockS3(t)
+
 	s, err := bucket.S3write(
 		"daidokoro-dev",
 		"qaz_testing.txt",
 		body,
 		sess,
+		c,
 	)
 
 	assert.NoError(t, err)
@@ -32,25 +44,35 @@ func TestS3Write(t *testing.T) {
 }
 
 func TestS3Read(t *testing.T) {
-	s, err := bucket.S3Read(s3uri, sess)
+	c := mockS3(t)
+
+	_, err := bucket.S3write("daidokoro-dev", "qaz_testing.txt", body, sess, c)
+	assert.NoError(t, err)
+
+	s, err := bucket.S3Read(s3uri, sess, c)
 	assert.NoError(t, err)
 	assert.Equal(t, "3347e9fbc394bd6110c8a57da41c4abf", s)
 }
 
 func TestS3Create(t *testing.T) {
+	c := fake.New("eu-west-1").Clients()
+
 	ti := time.Now()
 	b := fmt.Sprintf("qaz-test-bucket-%s", ti.Format("200601021504"))
-	assert.NoError(t, bucket.Create(b, sess))
+	assert.NoError(t, bucket.Create(b, sess, c))
 
 	// test exist
-	r, err := bucket.Exists(b, sess)
+	r, err := bucket.Exists(b, sess, c)
 	assert.NoError(t, err)
 	assert.Equal(t, true, r)
 
 	// remove bucket when done
-	svc := s3.New(sess)
+	svc := c.S3(sess)
 	_, err = svc.DeleteBucket(&s3.DeleteBucketInput{
 		Bucket: &b,
 	})
 	assert.NoError(t, err)
+
+	r, _ = bucket.Exists(b, sess, c)
+	assert.Equal(t, false, r)
 }
@@ -0,0 +1,72 @@
+package testing
+
+import (
+	"testing"
+
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const baseConfig = `
+region: eu-west-1
+project: qaz-test
+
+global:
+  tags:
+    env: dev
+    owner: ops
+
+stacks:
+  vpc:
+    source: templates/vpc.yml
+    parameters:
+      - size: small
+      - zone: a
+    cf:
+      cidr: 10.10.0.0/16
+      subnets:
+        private: 10.10.0.0/24
+
+environments:
+  prod:
+    region: us-east-1
+    stacks:
+      vpc:
+        profile: prod
+        parameters:
+          - size: large
+        cf:
+          subnets:
+            public: 10.10.2.0/24
+`
+
+func TestConfigMerge(t *testing.T) {
+	var c stacks.Config
+	assert.NoError(t, yaml.Unmarshal([]byte(baseConfig), &c))
+
+	c.Env = "prod"
+	c.Merge(c.Environments["prod"])
+
+	assert.Equal(t, "us-east-1", c.Region)
+	assert.Equal(t, "qaz-test", c.Project)
+	assert.Equal(t, "prod", c.Stacks["vpc"].Profile)
+	assert.Equal(t, "templates/vpc.yml", c.Stacks["vpc"].Source)
+	assert.Equal(t, []map[string]string{{"size": "large"}, {"zone": "a"}}, c.Stacks["vpc"].Parameters)
+
+	cf := c.Stacks["vpc"].CF
+	assert.Equal(t, "10.10.0.0/16", cf["cidr"])
+	assert.Equal(t, map[string]interface{}{
+		"private": "10.10.0.0/24",
+		"public":  "10.10.2.0/24",
+	}, cf["subnets"])
+
+	assert.Equal(t, "prod", c.Vars()["env"])
+}
+
+func TestEnvSource(t *testing.T) {
+	assert.Equal(t, "config.prod.yml", stacks.EnvSource("config.yml", "prod"))
+	assert.Equal(t, "path/to/config.dev.json", stacks.EnvSource("path/to/config.json", "dev"))
+	assert.Equal(t, "s3://bucket/config.prod.yml", stacks.EnvSource("s3://bucket/config.yml", "prod"))
+	assert.Equal(t, "", stacks.EnvSource(`lambda:{"some":"event"}@function`, "prod"))
+}
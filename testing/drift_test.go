@@ -0,0 +1,46 @@
+package testing
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrift(t *testing.T) {
+	d := &stacks.Drift{
+		Stack:            "vpc",
+		Stackname:        "project-vpc",
+		Status:           "DRIFTED",
+		DriftedResources: 1,
+		Resources: []stacks.ResourceDrift{
+			{
+				LogicalID:  "SecurityGroup",
+				PhysicalID: "sg-123",
+				Type:       "AWS::EC2::SecurityGroup",
+				Status:     "MODIFIED",
+				Differences: []stacks.PropertyDifference{
+					{Path: "/GroupDescription", Type: "NOT_EQUAL", Expected: "web", Actual: "manual"},
+				},
+			},
+			{
+				LogicalID:  "VPC",
+				PhysicalID: "vpc-123",
+				Type:       "AWS::EC2::VPC",
+				Status:     "IN_SYNC",
+			},
+		},
+	}
+	assert.True(t, d.Drifted())
+
+	var buf bytes.Buffer
+	d.Print(&buf)
+	assert.Equal(t, `vpc: DRIFTED - 1 resource(s) drifted
+  MODIFIED - AWS::EC2::SecurityGroup - SecurityGroup [sg-123]
+    NOT_EQUAL /GroupDescription: expected [web], actual [manual]
+`, buf.String())
+
+	assert.False(t, (&stacks.Drift{Stack: "app", Status: "IN_SYNC"}).Drifted())
+	assert.False(t, (&stacks.Drift{Stack: "app", Status: "NOT_DEPLOYED"}).Drifted())
+}
@@ -0,0 +1,71 @@
+package testing
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/daidokoro/qaz/bucket"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+)
+
+// endpointSession - returns a session with the given endpoints applied
+func endpointSession(t *testing.T, e *stacks.EndpointConfig) *session.Session {
+	opts := session.Options{Config: aws.Config{Region: aws.String("eu-west-1")}}
+	assert.NoError(t, e.Apply(&opts))
+
+	sess, err := session.NewSessionWithOptions(opts)
+	assert.NoError(t, err)
+	return sess
+}
+
+func TestEndpointConfig(t *testing.T) {
+	e := &stacks.EndpointConfig{}
+	assert.NoError(t, e.Set("", "http://localhost:4566"))
+	assert.Equal(t, "http://localhost:4566", e.SSM)
+	assert.NoError(t, e.Set("CloudFormation", "https://vpce-0a1b.cloudformation.eu-west-1.vpce.amazonaws.com"))
+	assert.EqualError(t, e.Set("ec2", "http://localhost:4566"), "unknown endpoint service [ec2], must be one of: cloudformation, kms, lambda, s3, ssm, sts")
+
+	// set values of the overrides take precedence
+	m := e.Merge(&stacks.EndpointConfig{S3: "http://minio:9000", S3PathStyle: true})
+	assert.Equal(t, "http://minio:9000", m.S3)
+	assert.Equal(t, "https://vpce-0a1b.cloudformation.eu-west-1.vpce.amazonaws.com", m.CloudFormation)
+	assert.True(t, m.S3PathStyle)
+	assert.Equal(t, "http://localhost:4566", e.S3)
+
+	assert.Error(t, (&stacks.EndpointConfig{KMS: "localhost:4566"}).Validate())
+	assert.Error(t, (&stacks.EndpointConfig{CABundle: "does-not-exist.pem"}).Apply(&session.Options{}))
+	assert.NoError(t, (*stacks.EndpointConfig)(nil).Apply(&session.Options{}))
+}
+
+func TestEndpointSession(t *testing.T) {
+	sess := endpointSession(t, &stacks.EndpointConfig{
+		CloudFormation: "http://localhost:4566",
+		S3:             "http://localhost:4566",
+		S3PathStyle:    true,
+	})
+
+	resolved, err := sess.Config.EndpointResolver.EndpointFor("cloudformation", "eu-west-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:4566", resolved.URL)
+	assert.Equal(t, "eu-west-1", resolved.SigningRegion)
+
+	// services without custom endpoints use the AWS defaults
+	resolved, err = sess.Config.EndpointResolver.EndpointFor("kms", "eu-west-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://kms.eu-west-1.amazonaws.com", resolved.URL)
+
+	assert.Equal(t, "http://localhost:4566/qaz-bucket/qaz/vpc.template", bucket.ObjectURL("qaz-bucket", "qaz/vpc.template", sess))
+	assert.Equal(t, "https://qaz-bucket.s3.eu-west-1.amazonaws.com/qaz/vpc.template", bucket.ObjectURL("qaz-bucket", "qaz/vpc.template", endpointSession(t, nil)))
+}
+
+func TestEndpointConfigValidate(t *testing.T) {
+	c := &stacks.Config{
+		String:    "project: qaz\nendpoints:\n  s3: minio:9000\nstacks:\n  vpc:\n    source: vpc.yml\n",
+		Project:   "qaz",
+		Endpoints: &stacks.EndpointConfig{S3: "minio:9000"},
+		Stacks:    map[string]stacks.StackConfig{"vpc": {Source: "vpc.yml"}},
+	}
+	assert.EqualError(t, c.Validate(), "invalid config:\nconfig:2: invalid s3 endpoint [minio:9000], must be an absolute url, i.e https://host:port")
+}
@@ -0,0 +1,164 @@
+package testing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+)
+
+// testEvent - test event, [id, stack, logical id, physical id, type, status, reason],
+// the id is the event time in seconds
+type testEvent [7]string
+
+// eventsServer - serves DescribeStackEvents from events, newest first, two events per page
+func eventsServer(events map[string][]testEvent) *httptest.Server {
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		evs := events[r.Form.Get("StackName")]
+
+		var start int
+		fmt.Sscanf(r.Form.Get("NextToken"), "%d", &start)
+
+		var b strings.Builder
+		b.WriteString(`<DescribeStackEventsResponse><DescribeStackEventsResult><StackEvents>`)
+		for i := start; i < len(evs) && i < start+2; i++ {
+			e := evs[i]
+			var sec int
+			fmt.Sscanf(e[0], "%d", &sec)
+			ts := base.Add(time.Duration(sec) * time.Second)
+			fmt.Fprintf(&b, `<member><EventId>%s</EventId><StackName>%s</StackName><StackId>%s</StackId>`+
+				`<LogicalResourceId>%s</LogicalResourceId><PhysicalResourceId>%s</PhysicalResourceId>`+
+				`<ResourceType>%s</ResourceType><ResourceStatus>%s</ResourceStatus>`+
+				`<ResourceStatusReason>%s</ResourceStatusReason><Timestamp>%s</Timestamp></member>`,
+				e[0], e[1], e[1], e[2], e[3], e[4], e[5], e[6], ts.Format(time.RFC3339))
+		}
+		b.WriteString(`</StackEvents>`)
+		if start+2 < len(evs) {
+			fmt.Fprintf(&b, `<NextToken>%d</NextToken>`, start+2)
+		}
+		b.WriteString(`</DescribeStackEventsResult></DescribeStackEventsResponse>`)
+		w.Write([]byte(b.String()))
+	}))
+}
+
+func TestEventStreamer(t *testing.T) {
+	events := map[string][]testEvent{
+		"qaz-vpc": {
+			{"5", "qaz-vpc", "Subnet", "", "AWS::EC2::Subnet", "CREATE_FAILED", "invalid cidr"},
+			{"4", "qaz-vpc", "Nested", "qaz-nested", "AWS::CloudFormation::Stack", "CREATE_IN_PROGRESS", ""},
+			{"3", "qaz-vpc", "VPC", "vpc-123", "AWS::EC2::VPC", "CREATE_COMPLETE", ""},
+			{"2", "qaz-vpc", "qaz-vpc", "qaz-vpc", "AWS::CloudFormation::Stack", "CREATE_IN_PROGRESS", "User Initiated"},
+			{"1", "qaz-vpc", "qaz-vpc", "qaz-vpc", "AWS::CloudFormation::Stack", "DELETE_COMPLETE", ""},
+		},
+		"qaz-nested": {
+			{"6", "qaz-nested", "Queue", "", "AWS::SQS::Queue", "CREATE_IN_PROGRESS", ""},
+		},
+	}
+
+	srv := eventsServer(events)
+	defer srv.Close()
+
+	s := &stacks.Stack{
+		Name:      "vpc",
+		Stackname: "qaz-vpc",
+		Session: session.Must(session.NewSession(&aws.Config{
+			Region:      aws.String("eu-west-1"),
+			Endpoint:    aws.String(srv.URL),
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		})),
+	}
+
+	var got []string
+	e := s.EventStreamer(time.Time{})
+	e.Operation = true
+	e.Emit = func(ev stacks.Event) {
+		got = append(got, fmt.Sprintf("%s/%s/%s", ev.Stackname, ev.LogicalID, ev.Status))
+	}
+
+	// events of the previous operation are skipped, nested events are followed
+	assert.NoError(t, e.Poll(context.Background()))
+	assert.Equal(t, []string{
+		"qaz-vpc/qaz-vpc/CREATE_IN_PROGRESS",
+		"qaz-vpc/VPC/CREATE_COMPLETE",
+		"qaz-vpc/Nested/CREATE_IN_PROGRESS",
+		"qaz-vpc/Subnet/CREATE_FAILED",
+		"qaz-nested/Queue/CREATE_IN_PROGRESS",
+	}, got)
+
+	// seen events are not emitted again, new events are
+	got = nil
+	events["qaz-vpc"] = append([]testEvent{
+		{"8", "qaz-vpc", "qaz-vpc", "qaz-vpc", "AWS::CloudFormation::Stack", "ROLLBACK_COMPLETE", ""},
+		{"7", "qaz-vpc", "VPC", "vpc-123", "AWS::EC2::VPC", "DELETE_COMPLETE", ""},
+	}, events["qaz-vpc"]...)
+
+	assert.NoError(t, e.Poll(context.Background()))
+	assert.Equal(t, []string{"qaz-vpc/VPC/DELETE_COMPLETE", "qaz-vpc/qaz-vpc/ROLLBACK_COMPLETE"}, got)
+}
+
+func TestEventStreamerRetry(t *testing.T) {
+	events := eventsServer(map[string][]testEvent{
+		"qaz-vpc": {
+			{"2", "qaz-vpc", "VPC", "vpc-123", "AWS::EC2::VPC", "CREATE_COMPLETE", ""},
+			{"1", "qaz-vpc", "qaz-vpc", "qaz-vpc", "AWS::CloudFormation::Stack", "CREATE_IN_PROGRESS", "User Initiated"},
+		},
+	})
+	defer events.Close()
+
+	// the first request is throttled, the stack is unknown to later streams
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch {
+		case r.Form.Get("StackName") == "qaz-db":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`<ErrorResponse><Error><Code>ValidationError</Code><Message>Stack [qaz-db] does not exist</Message></Error></ErrorResponse>`))
+		case atomic.AddInt32(&requests, 1) == 1:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`<ErrorResponse><Error><Code>Throttling</Code><Message>Rate exceeded</Message></Error></ErrorResponse>`))
+		default:
+			events.Config.Handler.ServeHTTP(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("eu-west-1"),
+		Endpoint:    aws.String(srv.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	var got []string
+	e := (&stacks.Stack{Stackname: "qaz-vpc", Session: sess}).EventStreamer(time.Time{})
+	e.Emit = func(ev stacks.Event) {
+		got = append(got, ev.LogicalID+"/"+ev.Status)
+		if len(got) == 2 {
+			cancel()
+		}
+	}
+
+	assert.NoError(t, e.Stream(ctx))
+	assert.Equal(t, []string{"qaz-vpc/CREATE_IN_PROGRESS", "VPC/CREATE_COMPLETE"}, got)
+	assert.True(t, atomic.LoadInt32(&requests) > 1)
+
+	// streams of stacks that don't exist fail
+	err := (&stacks.Stack{Stackname: "qaz-db", Session: sess}).EventStreamer(time.Time{}).Stream(context.Background())
+	assert.Contains(t, err.Error(), "does not exist")
+}
@@ -0,0 +1,65 @@
+package testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRootCause(t *testing.T) {
+	events := []stacks.Event{
+		{Stackname: "qaz-vpc", LogicalID: "qaz-vpc", Type: "AWS::CloudFormation::Stack", Status: "CREATE_IN_PROGRESS", Reason: "User Initiated"},
+		{Stackname: "qaz-vpc-Nested-1", LogicalID: "Queue", Type: "AWS::SQS::Queue", Status: "CREATE_FAILED", Reason: "queue name already exists"},
+		{Stackname: "qaz-vpc", LogicalID: "VPC", Type: "AWS::EC2::VPC", Status: "CREATE_FAILED", Reason: "Resource creation cancelled"},
+		{Stackname: "qaz-vpc", LogicalID: "Nested", Type: "AWS::CloudFormation::Stack", Status: "CREATE_FAILED", Reason: "Embedded stack qaz-vpc-Nested-1 was not successfully created: The following resource(s) failed to create: [Queue]."},
+		{Stackname: "qaz-vpc", LogicalID: "qaz-vpc", Type: "AWS::CloudFormation::Stack", Status: "ROLLBACK_COMPLETE"},
+	}
+
+	f := stacks.RootCause(events)
+	assert.NotNil(t, f)
+	assert.Equal(t, "Queue", f.RootCause.LogicalID)
+	assert.Equal(t, "qaz-vpc-Nested-1", f.RootCause.Stackname)
+	assert.Len(t, f.Failed, 3)
+	assert.Len(t, f.Cancelled, 1)
+	assert.Equal(t, "VPC", f.Cancelled[0].LogicalID)
+	assert.Equal(t, "qaz-vpc-Nested-1 - CREATE_FAILED - AWS::SQS::Queue [Queue]: queue name already exists", f.Error())
+
+	f.Stack, f.Stackname = "vpc", "qaz-vpc"
+	var buf bytes.Buffer
+	f.Print(&buf)
+	assert.Contains(t, buf.String(), "in nested: qaz-vpc-Nested-1")
+	assert.Contains(t, buf.String(), "cancelled: VPC")
+
+	// cascaded failures only, the first failure is reported
+	f = stacks.RootCause(events[2:])
+	assert.Equal(t, "VPC", f.RootCause.LogicalID)
+
+	assert.Nil(t, stacks.RootCause(events[4:]))
+}
+
+func TestResultDocument(t *testing.T) {
+	f := stacks.RootCause([]stacks.Event{{Stackname: "qaz-vpc", LogicalID: "VPC", Status: "CREATE_FAILED", Reason: "invalid cidr"}})
+	r := stacks.Results{{
+		Stack:    "vpc",
+		Action:   "deploy",
+		Result:   stacks.ActionFailed,
+		Duration: 90 * time.Second,
+		Err:      errors.New("invalid cidr"),
+		Failure:  f,
+	}}
+
+	b, err := json.Marshal(r)
+	assert.NoError(t, err)
+
+	var doc []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &doc))
+	assert.Equal(t, "failed", doc[0]["result"])
+	assert.Equal(t, "1m30s", doc[0]["duration"])
+	assert.Equal(t, "invalid cidr", doc[0]["error"])
+	assert.Equal(t, "VPC", doc[0]["failure"].(map[string]interface{})["root_cause"].(map[string]interface{})["logical_id"])
+}
@@ -0,0 +1,82 @@
+package testing
+
+import (
+	"testing"
+
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+)
+
+func stackMap(deps map[string][]string) *stacks.Map {
+	var m stacks.Map
+	for name, d := range deps {
+		m.Add(name, &stacks.Stack{Name: name, DependsOn: d})
+	}
+	return &m
+}
+
+func TestGraphWaves(t *testing.T) {
+	g, err := stacks.NewGraph(stackMap(map[string][]string{
+		"vpc":     nil,
+		"iam":     nil,
+		"subnet":  {"vpc"},
+		"cluster": {"subnet", "iam"},
+		"app":     {"cluster"},
+	}))
+	assert.NoError(t, err)
+
+	assert.Equal(t, [][]string{
+		{"iam", "vpc"},
+		{"subnet"},
+		{"cluster"},
+		{"app"},
+	}, g.Waves())
+
+	assert.Equal(t, []string{"iam", "subnet"}, g.Dependencies("cluster"))
+	assert.Equal(t, []string{"cluster"}, g.Dependents("iam"))
+}
+
+func TestGraphErrors(t *testing.T) {
+	_, err := stacks.NewGraph(stackMap(map[string][]string{
+		"a": {"b"},
+		"b": {"c"},
+		"c": {"a"},
+	}))
+	assert.EqualError(t, err, "dependency cycle detected: a -> b -> c -> a")
+
+	_, err = stacks.NewGraph(stackMap(map[string][]string{
+		"a": {"missing"},
+	}))
+	assert.EqualError(t, err, "bad dependency: stack [a] depends on [missing], which is not defined")
+}
+
+func TestGraphRender(t *testing.T) {
+	g, err := stacks.NewGraph(stackMap(map[string][]string{
+		"vpc":        nil,
+		"app-subnet": {"vpc"},
+	}))
+	assert.NoError(t, err)
+
+	status := map[string]string{"vpc": "CREATE_COMPLETE"}
+
+	assert.Equal(t, `digraph "qaz" {
+  rankdir=LR;
+  node [shape=box];
+  "app-subnet" [label="app-subnet"];
+  "vpc" [label="vpc\nCREATE_COMPLETE"];
+  "vpc" -> "app-subnet";
+}
+`, g.DOT("qaz", status))
+
+	assert.Equal(t, `graph LR
+  app_subnet["app-subnet"]
+  vpc["vpc<br/>CREATE_COMPLETE"]
+  vpc --> app_subnet
+`, g.Mermaid(status))
+
+	assert.Equal(t, `wave 1:
+  vpc - CREATE_COMPLETE
+wave 2:
+  app-subnet <- [vpc]
+`, g.ASCII(status))
+}
@@ -0,0 +1,68 @@
+package testing
+
+import (
+	"testing"
+
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestHooksConfig(t *testing.T) {
+	src := `project: qaz-test
+stacks:
+  vpc:
+    hooks:
+      pre_deploy:
+        - cmd: ./check.sh
+      post_deploy:
+        - cmd: ./smoke-test.sh
+          on_failure: rollback
+        - lambda: warm-cache
+          on_failure: warn
+`
+	assert.Nil(t, validate(t, src, yaml.Unmarshal))
+
+	var c stacks.Config
+	assert.NoError(t, yaml.Unmarshal([]byte(src), &c))
+
+	hooks := c.Stacks["vpc"].Hooks
+	assert.Len(t, hooks.PreDeploy, 1)
+	assert.Equal(t, stacks.Hook{Lambda: "warm-cache", OnFailure: stacks.HookWarn}, hooks.PostDeploy[1])
+
+	src = `project: qaz-test
+stacks:
+  vpc:
+    hooks:
+      pre_terminate:
+        - cmd: ./backup.sh
+          on_failure: rollback
+`
+	errs := validate(t, src, yaml.Unmarshal)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "config:4: stack [vpc]: pre_terminate hook 1: on_failure [rollback] is only valid for post_deploy & post_update hooks", errs[0].Error())
+
+	assert.Error(t, (&stacks.Hooks{PostUpdate: []stacks.Hook{{Cmd: "true", Lambda: "fn"}}}).Validate())
+	assert.Error(t, (&stacks.Hooks{PreUpdate: []stacks.Hook{{Cmd: "true", OnFailure: "ignore"}}}).Validate())
+}
+
+func TestHookPayloadEnv(t *testing.T) {
+	p := stacks.HookPayload{
+		Event:     stacks.HookPostDeploy,
+		Project:   "qaz",
+		Stack:     "vpc",
+		Stackname: "qaz-vpc",
+		Region:    "eu-west-1",
+		Outputs:   map[string]string{"vpcid": "vpc-123", "Cidr": "10.0.0.0/16"},
+	}
+
+	assert.Equal(t, []string{
+		"QAZ_EVENT=post_deploy",
+		"QAZ_PROJECT=qaz",
+		"QAZ_STACK=vpc",
+		"QAZ_STACKNAME=qaz-vpc",
+		"QAZ_REGION=eu-west-1",
+		"QAZ_OUTPUT_CIDR=10.0.0.0/16",
+		"QAZ_OUTPUT_VPCID=vpc-123",
+	}, p.Env())
+}
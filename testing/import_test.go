@@ -0,0 +1,91 @@
+package testing
+
+import (
+	"context"
+	"testing"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/daidokoro/qaz/clients/fake"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourcesToImport(t *testing.T) {
+	tpl := `AWSTemplateFormatVersion: '2010-09-09'
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    DeletionPolicy: Retain
+    Properties:
+      BucketName: !Ref Name
+  Table:
+    Type: AWS::DynamoDB::Table
+    Properties:
+      TableName: table
+`
+	m, err := stacks.LoadImportMapping([]byte(`{"Bucket": {"BucketName": "my-bucket"}}`))
+	assert.NoError(t, err)
+
+	resources, err := stacks.ResourcesToImport(tpl, m)
+	assert.NoError(t, err)
+	assert.Len(t, resources, 1)
+	assert.Equal(t, "Bucket", aws.StringValue(resources[0].LogicalResourceId))
+	assert.Equal(t, "AWS::S3::Bucket", aws.StringValue(resources[0].ResourceType))
+	assert.Equal(t, map[string]string{"BucketName": "my-bucket"}, aws.StringValueMap(resources[0].ResourceIdentifier))
+
+	m, err = stacks.LoadImportMapping([]byte(`
+Table:
+  TableName: table
+Queue:
+  QueueUrl: https://sqs.eu-west-1.amazonaws.com/123456789012/queue
+`))
+	assert.NoError(t, err)
+
+	_, err = stacks.ResourcesToImport(tpl, m)
+	assert.EqualError(t, err, "invalid import mapping:\n"+
+		"  resource [Queue] is not defined in template\n"+
+		"  resource [Table] must have a DeletionPolicy to be imported")
+
+	_, err = stacks.LoadImportMapping([]byte(""))
+	assert.Error(t, err)
+}
+
+func TestImport(t *testing.T) {
+	b := fake.New("eu-west-1")
+	ctx := context.Background()
+
+	delims := "<<:>>"
+	s := &stacks.Stack{
+		Name:           "storage",
+		Stackname:      "qaz-storage",
+		Session:        sess,
+		Clients:        b.Clients(),
+		Template:       "Resources:\n  Topic:\n    Type: AWS::SNS::Topic\n",
+		DeployDelims:   &delims,
+		DeployTimeFunc: &template.FuncMap{},
+		TemplateValues: map[string]interface{}{},
+	}
+	assert.NoError(t, s.Deploy(ctx))
+
+	s.Template += "  Bucket:\n    Type: AWS::S3::Bucket\n    DeletionPolicy: Retain\n    Properties:\n      BucketName: my-bucket\n"
+	s.Imports = stacks.ImportMapping{"Bucket": {"BucketName": "my-bucket"}}
+
+	// planning doesn't change the stack
+	changes, err := s.ImportPlan(ctx, "import-bucket")
+	assert.NoError(t, err)
+	if assert.Len(t, changes, 1) {
+		assert.Equal(t, cloudformation.ChangeActionImport, aws.StringValue(changes[0].ResourceChange.Action))
+	}
+
+	status, err := s.StackStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, cloudformation.StackStatusCreateComplete, status)
+
+	// the import is only complete once the stack reaches IMPORT_COMPLETE
+	assert.NoError(t, s.ExecuteImport(ctx, "import-bucket"))
+	status, err = s.StackStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, cloudformation.StackStatusImportComplete, status)
+}
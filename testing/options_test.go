@@ -0,0 +1,62 @@
+package testing
+
+import (
+	"testing"
+
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestInferCapabilities(t *testing.T) {
+	iam := []string{"CAPABILITY_IAM", "CAPABILITY_NAMED_IAM"}
+	all := []string{"CAPABILITY_AUTO_EXPAND", "CAPABILITY_IAM", "CAPABILITY_NAMED_IAM"}
+
+	for _, tc := range []struct {
+		tpl  string
+		caps []string
+	}{
+		{"Description: manages AWS::IAM roles elsewhere\nResources:\n  Bucket:\n    Type: AWS::S3::Bucket\n", nil},
+		{"Resources:\n  Role:\n    Type: AWS::IAM::Role\n", iam},
+		{"Transform: AWS::Serverless-2016-10-31\nResources:\n  Fn:\n    Type: AWS::Serverless::Function\n", all},
+		{"Resources:\n  Nested:\n    Type: AWS::CloudFormation::Stack\n", all},
+		{`{"Transform": ["MyMacro"], "Resources": {"Topic": {"Type": "AWS::SNS::Topic"}}}`, all},
+	} {
+		assert.Equal(t, tc.caps, stacks.InferCapabilities(tc.tpl), tc.tpl)
+	}
+}
+
+func TestStackOptionsConfig(t *testing.T) {
+	src := `project: qaz-test
+stacks:
+  vpc:
+    capabilities:
+      - CAPABILITY_IAM
+    on_failure: DELETE
+    termination_protection: true
+    role_arn: arn:aws:iam::123456789012:role/cfn
+    rollback_triggers:
+      monitoring_time: 10
+      alarms:
+        - arn:aws:cloudwatch:eu-west-1:123456789012:alarm:errors
+`
+	assert.Nil(t, validate(t, src, yaml.Unmarshal))
+
+	var c stacks.Config
+	assert.NoError(t, yaml.Unmarshal([]byte(src), &c))
+	assert.True(t, *c.Stacks["vpc"].TerminationProtection)
+	assert.Equal(t, int64(10), c.Stacks["vpc"].RollbackTriggers.MonitoringTime)
+
+	src = `project: qaz-test
+stacks:
+  vpc:
+    on_failure: RETRY
+  subnet:
+    capabilities:
+      - CAPABILITY_ADMIN
+`
+	errs := validate(t, src, yaml.Unmarshal)
+	assert.Len(t, errs, 2)
+	assert.Equal(t, "config:5: stack [subnet]: invalid capability [CAPABILITY_ADMIN], must be one of: CAPABILITY_IAM, CAPABILITY_NAMED_IAM, CAPABILITY_AUTO_EXPAND", errs[0].Error())
+	assert.Equal(t, "config:3: stack [vpc]: invalid on_failure [RETRY], must be one of: DO_NOTHING, ROLLBACK, DELETE", errs[1].Error())
+}
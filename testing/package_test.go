@@ -0,0 +1,198 @@
+package testing
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daidokoro/qaz/clients/fake"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qaz-package")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name, body string) {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, ioutil.WriteFile(path, []byte(body), 0644))
+	}
+
+	write("src/index.js", "exports.handler = () => {}")
+	write("src/lib/util.js", "module.exports = {}")
+	write("include.yml", "Description: included")
+	write("nested/nested.yml", "Resources:\n  Fn:\n    Type: AWS::Lambda::Function\n    Properties:\n      Code: ../src\n")
+
+	tpl := `Resources:
+  Fn:
+    Type: AWS::Lambda::Function
+    Properties:
+      Code: ./src
+      Role: !GetAtt Role.Arn
+  Api:
+    Type: AWS::Serverless::Function
+    Properties:
+      CodeUri: "./src"
+      CodeLocation: ./src
+  Nested:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: nested/nested.yml
+  Remote:
+    Type: AWS::Serverless::Function
+    Properties:
+      CodeUri: s3://bucket/code.zip
+  Fn::Transform:
+    Name: AWS::Include
+    Parameters:
+      Location: include.yml
+`
+
+	uploads := make(map[string][]byte)
+	p := &stacks.Packager{
+		Bucket: "assets-bucket",
+		Region: "eu-west-1",
+		Upload: func(key string, body []byte) error {
+			uploads[key] = body
+			return nil
+		},
+	}
+
+	out, err := p.Template(tpl, dir)
+	assert.NoError(t, err)
+
+	// code, include & nested template, the nested code zip is the same object
+	assert.Len(t, uploads, 3)
+	var code, nested, include string
+	for k := range uploads {
+		switch {
+		case strings.HasSuffix(k, ".zip"):
+			code = k
+		case string(uploads[k]) == "Description: included":
+			include = k
+		default:
+			nested = k
+		}
+	}
+
+	assert.Contains(t, out, `Code: {"S3Bucket":"assets-bucket","S3Key":"`+code+`"}`)
+	assert.Contains(t, out, `CodeUri: "s3://assets-bucket/`+code+`"`)
+	assert.Contains(t, out, `TemplateURL: "https://assets-bucket.s3.eu-west-1.amazonaws.com/`+nested+`"`)
+	assert.Contains(t, out, `Location: "s3://assets-bucket/`+include+`"`)
+	assert.Contains(t, out, "Role: !GetAtt Role.Arn")
+	assert.Contains(t, out, "CodeLocation: ./src")
+	assert.Contains(t, out, "CodeUri: s3://bucket/code.zip")
+	assert.Contains(t, string(uploads[nested]), `Code: {"S3Bucket":"assets-bucket","S3Key":"`+code+`"}`)
+
+	// zip contents & determinism
+	zr, err := zip.NewReader(bytes.NewReader(uploads[code]), int64(len(uploads[code])))
+	assert.NoError(t, err)
+	assert.Equal(t, "index.js", zr.File[0].Name)
+	assert.Equal(t, "lib/util.js", zr.File[1].Name)
+
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "src/index.js"), time.Now(), time.Now().Add(time.Hour)))
+	b, err := stacks.Zip(filepath.Join(dir, "src"))
+	assert.NoError(t, err)
+	assert.Equal(t, uploads[code], b)
+
+	// local artifacts require a bucket
+	_, err = (&stacks.Packager{}).Template(tpl, dir)
+	assert.Error(t, err)
+
+	// templates without local artifacts are unchanged
+	out, err = (&stacks.Packager{}).Template("Resources:\n  Topic:\n    Type: AWS::SNS::Topic\n", dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "Resources:\n  Topic:\n    Type: AWS::SNS::Topic\n", out)
+}
+
+func TestPackagerIntrinsics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qaz-package")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// a file named like the referenced parameter is not packaged
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ChildUrl"), []byte("Description: child"), 0644))
+
+	tpl := `Resources:
+  Ref:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: !Ref ChildUrl
+  Sub:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: !Sub "${Base}/child.yml"
+  Plain:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: child.yml
+  Fn:
+    Type: AWS::Lambda::Function
+    Properties:
+      Code:
+        Fn::If: [HasCode, {ZipFile: code}, !Ref AWS::NoValue]
+`
+
+	// without a bucket
+	out, err := (&stacks.Packager{}).Template(tpl, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, tpl, out)
+
+	// with a bucket
+	uploads := make(map[string][]byte)
+	p := &stacks.Packager{
+		Bucket: "assets-bucket",
+		Region: "eu-west-1",
+		Upload: func(key string, body []byte) error {
+			uploads[key] = body
+			return nil
+		},
+	}
+
+	out, err = p.Template(tpl, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, tpl, out)
+	assert.Empty(t, uploads)
+
+	// explicit local prefixes must exist
+	_, err = p.Template("Resources:\n  Child:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      TemplateURL: ./child.yml\n", dir)
+	assert.Contains(t, err.Error(), "TemplateURL [./child.yml] is not a valid local path")
+
+	out, err = p.Template("Resources:\n  Child:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      TemplateURL: file://ChildUrl\n", dir)
+	assert.NoError(t, err)
+	assert.Contains(t, out, `TemplateURL: "https://assets-bucket.s3.eu-west-1.amazonaws.com/`)
+	assert.Len(t, uploads, 1)
+}
+
+func TestStackPackageBucket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qaz-package")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "src"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "src", "index.js"), []byte("exports.handler = () => {}"), 0644))
+
+	b := fake.New("eu-west-1")
+	s := &stacks.Stack{
+		Name:     "fn",
+		Source:   filepath.Join(dir, "fn.yml"),
+		Bucket:   "qaz-new-bucket",
+		Session:  sess,
+		Clients:  b.Clients(),
+		Template: "Resources:\n  Fn:\n    Type: AWS::Lambda::Function\n    Properties:\n      Code: ./src\n",
+	}
+
+	// the bucket is created before the first upload
+	assert.NoError(t, s.Package())
+	_, ok := b.S3.Settings("qaz-new-bucket")
+	assert.True(t, ok)
+	assert.Contains(t, s.Template, `"S3Bucket":"qaz-new-bucket"`)
+}
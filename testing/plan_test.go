@@ -0,0 +1,126 @@
+package testing
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/daidokoro/qaz/clients/fake"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+)
+
+func resourceChange(action, id, typ, replacement string) *cloudformation.Change {
+	rc := &cloudformation.ResourceChange{
+		Action:            aws.String(action),
+		LogicalResourceId: aws.String(id),
+		ResourceType:      aws.String(typ),
+	}
+
+	if replacement != "" {
+		rc.Replacement = aws.String(replacement)
+	}
+	return &cloudformation.Change{ResourceChange: rc}
+}
+
+func TestPlan(t *testing.T) {
+	vpc := &stacks.PlanStack{
+		Name:        "vpc",
+		Stackname:   "project-vpc",
+		Type:        "UPDATE",
+		ChangeSetID: "arn:aws:cloudformation:eu-west-1:123456789012:changeSet/qaz-plan-1/abc",
+		StackStatus: "UPDATE_COMPLETE",
+		LastUpdated: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	vpc.SetChanges([]*cloudformation.Change{
+		resourceChange("Add", "Subnet", "AWS::EC2::Subnet", ""),
+		resourceChange("Modify", "VPC", "AWS::EC2::VPC", "True"),
+		resourceChange("Modify", "Route", "AWS::EC2::Route", "False"),
+		resourceChange("Remove", "Gateway", "AWS::EC2::InternetGateway", ""),
+	})
+
+	assert.Equal(t, 1, vpc.Adds)
+	assert.Equal(t, 2, vpc.Modifies)
+	assert.Equal(t, 1, vpc.Removes)
+	assert.Equal(t, 1, vpc.Replacements)
+	assert.True(t, vpc.HasChanges())
+
+	app := &stacks.PlanStack{
+		Name:      "app",
+		Stackname: "project-app",
+		Type:      "CREATE",
+		Deferred:  true,
+		Reason:    "depends on [db], which is created by this plan, run plan again after apply",
+	}
+	assert.False(t, app.HasChanges())
+
+	p := &stacks.Plan{
+		Project:   "project",
+		ChangeSet: "qaz-plan-1",
+		Created:   time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Stacks:    []*stacks.PlanStack{vpc, app},
+	}
+
+	// save & load round trip
+	dir, err := ioutil.TempDir("", "qaz-plan")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "qaz.plan.json")
+	assert.NoError(t, p.Save(path))
+
+	loaded, err := stacks.LoadPlan(path)
+	assert.NoError(t, err)
+	assert.Equal(t, p, loaded)
+
+	ps, ok := loaded.Get("vpc")
+	assert.True(t, ok)
+	assert.Equal(t, vpc, ps)
+
+	var buf bytes.Buffer
+	p.Print(&buf)
+	assert.Equal(t, `STACK   TYPE     ADD   MODIFY   REMOVE   REPLACE   STATUS
+vpc     UPDATE   1     2        1        1         pending
+app     CREATE   0     0        0        0         deferred
+
+vpc:
+  Add      Subnet    AWS::EC2::Subnet            
+  Modify   VPC       AWS::EC2::VPC               replacement: True
+  Modify   Route     AWS::EC2::Route             
+  Remove   Gateway   AWS::EC2::InternetGateway   
+
+app: deferred - depends on [db], which is created by this plan, run plan again after apply
+`, buf.String())
+}
+
+func TestApplyFailure(t *testing.T) {
+	b := fake.New("eu-west-1")
+	ctx := context.Background()
+
+	stks := configureStacks(t, b)
+	p, err := stacks.PlanHandler(ctx, stks, "qaz-test", stacks.HandlerOptions{})
+	assert.NoError(t, err)
+
+	// failed change-sets report the root cause of the failure
+	b.CloudFormation.Fail = map[string]string{"VPC": "The CIDR '10.10.0.0/16' is invalid."}
+	results, err := stacks.ApplyHandler(ctx, configureStacks(t, b), p, stacks.HandlerOptions{})
+	assert.IsType(t, &stacks.HandlerError{}, err)
+
+	for _, r := range results {
+		if r.Stack != "vpc" {
+			continue
+		}
+
+		assert.Equal(t, stacks.ActionFailed, r.Result)
+		if assert.NotNil(t, r.Failure) {
+			assert.Equal(t, "VPC", r.Failure.RootCause.LogicalID)
+		}
+	}
+}
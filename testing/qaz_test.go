@@ -0,0 +1,245 @@
+package testing
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/daidokoro/qaz/clients"
+	"github.com/daidokoro/qaz/clients/fake"
+	"github.com/daidokoro/qaz/qaz"
+	"github.com/daidokoro/qaz/repo"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+)
+
+// loadProject - loads the fake config under the given project name
+func loadProject(t *testing.T, name string, c clients.Provider) *qaz.Project {
+	p, err := qaz.Load(qaz.Options{
+		Config:  strings.Replace(fakeConfig, "project: qaz-test", "project: "+name, 1),
+		Region:  "eu-west-1",
+		Clients: c,
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return p
+}
+
+func TestProjectLoad(t *testing.T) {
+	p := loadProject(t, "qaz-lib", nil)
+	assert.Equal(t, "qaz-lib", p.Name())
+	assert.NoError(t, p.Validate())
+
+	m, err := p.Stacks()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, m.Count())
+	assert.Equal(t, "qaz-lib-vpc", m.MustGet("vpc").Stackname)
+
+	// every call returns new stacks
+	n, err := p.Stacks()
+	assert.NoError(t, err)
+	assert.False(t, m.MustGet("vpc") == n.MustGet("vpc"))
+
+	_, err = qaz.Load(qaz.Options{Config: "project: [qaz", Region: "eu-west-1"})
+	assert.IsType(t, &qaz.ConfigError{}, err)
+
+	_, err = qaz.Load(qaz.Options{ConfigSource: "does-not-exist.yml", Region: "eu-west-1"})
+	assert.IsType(t, &qaz.ConfigError{}, err)
+
+	_, err = qaz.Load(qaz.Options{Config: fakeConfig, Env: "prod", Region: "eu-west-1"})
+	assert.EqualError(t, err, "environment [prod] not found in config or overlay file")
+}
+
+func TestProjectRender(t *testing.T) {
+	p := loadProject(t, "qaz-lib", nil)
+
+	templates, err := p.Render(qaz.RunOptions{Stacks: []string{"vpc"}})
+	assert.NoError(t, err)
+	assert.Len(t, templates, 1)
+	assert.Contains(t, templates["vpc"], "CidrBlock: 10.10.0.0/16")
+
+	_, err = p.Render(qaz.RunOptions{Stacks: []string{"db"}})
+	assert.Equal(t, &qaz.StackNotFoundError{Stack: "db"}, err)
+
+	// failing template functions are returned, not exited on
+	dir, err := ioutil.TempDir("", "qaz")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "vpc.yml")
+	assert.NoError(t, ioutil.WriteFile(src, []byte(`Description: {{ cat "does-not-exist.txt" }}`), 0644))
+
+	_, err = p.Render(qaz.RunOptions{Stacks: []string{"vpc"}, Sources: map[string]string{"vpc": src}})
+	if assert.IsType(t, &qaz.RenderError{}, err) {
+		assert.Equal(t, "vpc", err.(*qaz.RenderError).Stack)
+		assert.Contains(t, err.Error(), "does-not-exist.txt")
+	}
+}
+
+func TestProjectConcurrent(t *testing.T) {
+	b := fake.New("eu-west-1")
+
+	projects := []*qaz.Project{loadProject(t, "qaz-a", b.Clients()), loadProject(t, "qaz-b", b.Clients())}
+	results := make([]stacks.Results, len(projects))
+	errs := make([]error, len(projects))
+
+	var wg sync.WaitGroup
+	for i, p := range projects {
+		wg.Add(1)
+		go func(i int, p *qaz.Project) {
+			defer wg.Done()
+			results[i], errs[i] = p.Deploy(context.Background(), qaz.RunOptions{})
+		}(i, p)
+	}
+	wg.Wait()
+
+	for i := range projects {
+		assert.NoError(t, errs[i])
+		assert.Len(t, results[i], 2)
+		for _, r := range results[i] {
+			assert.Equal(t, stacks.ActionCreated, r.Result, r.Stack)
+		}
+	}
+	assert.Equal(t, []string{"qaz-a-subnet", "qaz-a-vpc", "qaz-b-subnet", "qaz-b-vpc"}, b.CloudFormation.Stacks())
+
+	// each subnet resolves the vpc output of its own project
+	exports, err := stacks.ListExports(sess, b.Clients())
+	assert.NoError(t, err)
+	assert.Len(t, exports, 2)
+	for _, e := range exports {
+		project := strings.TrimSuffix(e.Name, "-vpc-vpcid")
+		assert.True(t, strings.HasPrefix(e.Value, project+"-vpc-VPC-"), fmt.Sprint(e))
+	}
+
+	for _, p := range projects {
+		_, err := p.Terminate(context.Background(), qaz.RunOptions{})
+		assert.NoError(t, err)
+	}
+	assert.Empty(t, b.CloudFormation.Stacks())
+}
+
+func TestProjectDeployFailure(t *testing.T) {
+	b := fake.New("eu-west-1")
+	b.CloudFormation.Fail = map[string]string{"VPC": "The CIDR '10.10.0.0/16' is invalid."}
+
+	results, err := loadProject(t, "qaz-lib", b.Clients()).Deploy(context.Background(), qaz.RunOptions{})
+	if assert.IsType(t, &stacks.HandlerError{}, err) {
+		assert.False(t, err.(*stacks.HandlerError).Partial())
+	}
+
+	for _, r := range results {
+		assert.Equal(t, r.Stack == "vpc", r.Failure != nil, r.Stack)
+	}
+}
+
+func TestProjectConcurrentHandlers(t *testing.T) {
+	b := fake.New("eu-west-1")
+
+	a, c := loadProject(t, "qaz-a", b.Clients()), loadProject(t, "qaz-c", b.Clients())
+	_, err := a.Deploy(context.Background(), qaz.RunOptions{})
+	assert.NoError(t, err)
+
+	// terminate one project while deploying another
+	var wg sync.WaitGroup
+	var terr, derr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, terr = a.Terminate(context.Background(), qaz.RunOptions{})
+	}()
+	go func() {
+		defer wg.Done()
+		_, derr = c.Deploy(context.Background(), qaz.RunOptions{})
+	}()
+	wg.Wait()
+
+	assert.NoError(t, terr)
+	assert.NoError(t, derr)
+	assert.Equal(t, []string{"qaz-c-subnet", "qaz-c-vpc"}, b.CloudFormation.Stacks())
+}
+
+func TestProjectOverlay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qaz")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := fakeConfig + "\nenvironments:\n  prod:\n    region: us-east-1\n"
+	src := filepath.Join(dir, "config.yml")
+	assert.NoError(t, ioutil.WriteFile(src, []byte(config), 0644))
+
+	// missing overlays are skipped
+	p, err := qaz.Load(qaz.Options{ConfigSource: src, Env: "prod", Region: "eu-west-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "us-east-1", p.Config().Region)
+
+	b := fake.New("eu-west-1")
+	_, err = b.S3.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String("qaz-config")})
+	assert.NoError(t, err)
+	_, err = b.S3.PutObject(&s3.PutObjectInput{Bucket: aws.String("qaz-config"), Key: aws.String("config.yml"), Body: strings.NewReader(config)})
+	assert.NoError(t, err)
+
+	p, err = qaz.Load(qaz.Options{ConfigSource: "s3://qaz-config/config.yml", Env: "prod", Region: "eu-west-1", Clients: b.Clients()})
+	assert.NoError(t, err)
+	assert.Equal(t, "us-east-1", p.Config().Region)
+
+	// overlays that can't be read fail the load
+	overlay := filepath.Join(dir, "config.prod.yml")
+	assert.NoError(t, os.Mkdir(overlay, 0755))
+	_, err = qaz.Load(qaz.Options{ConfigSource: src, Env: "prod", Region: "eu-west-1"})
+	if assert.IsType(t, &qaz.ConfigError{}, err) {
+		assert.Equal(t, overlay, err.(*qaz.ConfigError).Source)
+	}
+}
+
+func TestProjectClients(t *testing.T) {
+	a, c := fake.New("eu-west-1"), fake.New("eu-west-1")
+	projects := map[*fake.Backend]*qaz.Project{
+		a: loadProject(t, "qaz-a", a.Clients()),
+		c: loadProject(t, "qaz-c", c.Clients()),
+	}
+
+	// projects only call the backends of their own clients
+	var wg sync.WaitGroup
+	for _, p := range projects {
+		wg.Add(1)
+		go func(p *qaz.Project) {
+			defer wg.Done()
+			_, err := p.Deploy(context.Background(), qaz.RunOptions{})
+			assert.NoError(t, err)
+		}(p)
+	}
+	wg.Wait()
+
+	assert.Equal(t, []string{"qaz-a-subnet", "qaz-a-vpc"}, a.CloudFormation.Stacks())
+	assert.Equal(t, []string{"qaz-c-subnet", "qaz-c-vpc"}, c.CloudFormation.Stacks())
+}
+
+func TestProjectRepo(t *testing.T) {
+	r := &repo.Repo{
+		URL:   "https://github.com/daidokoro/qaz-test",
+		Files: map[string]string{"templates/vpc.yml": "Description: from {{ .vpc.cidr }} in git"},
+	}
+
+	p, err := qaz.Load(qaz.Options{Config: fakeConfig, Region: "eu-west-1", Repo: r})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// file sources are read from the repo of the project, then the file system
+	templates, err := p.Render(qaz.RunOptions{Sources: map[string]string{"vpc": "templates/vpc.yml"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "Description: from 10.10.0.0/16 in git", templates["vpc"])
+	assert.Contains(t, templates["subnet"], "Subnet")
+
+	// other projects don't see the repo
+	_, err = loadProject(t, "qaz-lib", nil).Render(qaz.RunOptions{Sources: map[string]string{"vpc": "templates/vpc.yml"}})
+	assert.IsType(t, &qaz.RenderError{}, err)
+}
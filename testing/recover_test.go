@@ -0,0 +1,86 @@
+package testing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/daidokoro/qaz/clients/fake"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+)
+
+func stackEvent(id, typ, status, reason string) *cloudformation.StackEvent {
+	stackID := "arn:aws:cloudformation:eu-west-1:123456789012:stack/project-vpc/abc"
+	physical := id
+	if typ == "AWS::CloudFormation::Stack" {
+		physical = stackID
+	}
+
+	return &cloudformation.StackEvent{
+		StackId:              aws.String(stackID),
+		LogicalResourceId:    aws.String(id),
+		PhysicalResourceId:   aws.String(physical),
+		ResourceType:         aws.String(typ),
+		ResourceStatus:       aws.String(status),
+		ResourceStatusReason: aws.String(reason),
+	}
+}
+
+func TestParseFailedResources(t *testing.T) {
+	// events newest first
+	events := []*cloudformation.StackEvent{
+		stackEvent("project-vpc", "AWS::CloudFormation::Stack", "UPDATE_ROLLBACK_FAILED", ""),
+		stackEvent("Subnet", "AWS::EC2::Subnet", "UPDATE_FAILED", "subnet in use"),
+		stackEvent("Route", "AWS::EC2::Route", "UPDATE_COMPLETE", ""),
+		stackEvent("Route", "AWS::EC2::Route", "UPDATE_FAILED", "throttled"),
+		stackEvent("project-vpc", "AWS::CloudFormation::Stack", "UPDATE_ROLLBACK_IN_PROGRESS", ""),
+		stackEvent("Gateway", "AWS::EC2::InternetGateway", "UPDATE_FAILED", "original failure"),
+	}
+
+	assert.Equal(t, []stacks.FailedResource{
+		{LogicalID: "Subnet", Type: "AWS::EC2::Subnet", Status: "UPDATE_FAILED", Reason: "subnet in use"},
+	}, stacks.ParseFailedResources(events, "UPDATE_ROLLBACK_FAILED"))
+
+	events = []*cloudformation.StackEvent{
+		stackEvent("project-vpc", "AWS::CloudFormation::Stack", "DELETE_FAILED", ""),
+		stackEvent("Bucket", "AWS::S3::Bucket", "DELETE_FAILED", "bucket not empty"),
+		stackEvent("project-vpc", "AWS::CloudFormation::Stack", "DELETE_IN_PROGRESS", ""),
+	}
+
+	assert.Equal(t, []stacks.FailedResource{
+		{LogicalID: "Bucket", Type: "AWS::S3::Bucket", Status: "DELETE_FAILED", Reason: "bucket not empty"},
+	}, stacks.ParseFailedResources(events, "DELETE_FAILED"))
+
+	assert.Nil(t, stacks.ParseFailedResources(events, "UPDATE_COMPLETE"))
+	assert.True(t, stacks.Recoverable("DELETE_FAILED"))
+	assert.False(t, stacks.Recoverable("CREATE_COMPLETE"))
+}
+
+func TestRecoverDelete(t *testing.T) {
+	b := fake.New("eu-west-1")
+	b.CloudFormation.Step = time.Millisecond * 10
+	ctx := context.Background()
+
+	stks := configureStacks(t, b)
+	_, err := stacks.DeployHandler(ctx, stks, stacks.HandlerOptions{})
+	assert.NoError(t, err)
+
+	b.CloudFormation.Fail = map[string]string{"publicSubnet": "subnet in use"}
+	_, err = stacks.TerminateHandler(ctx, stks, stacks.HandlerOptions{})
+	assert.Error(t, err)
+
+	subnet := stks.MustGet("subnet")
+	status, failed, err := subnet.FailedResources(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, cloudformation.StackStatusDeleteFailed, status)
+	if assert.Len(t, failed, 1) {
+		assert.Equal(t, "publicSubnet", failed[0].LogicalID)
+	}
+
+	// the retried delete is only done once the stack is gone
+	assert.NoError(t, subnet.Recover(ctx, nil, []string{"publicSubnet"}))
+	assert.False(t, subnet.StackExists())
+}
@@ -0,0 +1,101 @@
+package testing
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/daidokoro/qaz/qaz"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+)
+
+// renderErr - returns the TemplateError of err, fails the test if err is not one
+func renderErr(t *testing.T, err error) *stacks.TemplateError {
+	if e, ok := err.(*qaz.RenderError); ok {
+		err = e.Err
+	}
+
+	if e, ok := err.(*qaz.ConfigError); ok {
+		err = e.Err
+	}
+
+	e, ok := err.(*stacks.TemplateError)
+	if !assert.True(t, ok, "expected *stacks.TemplateError, got: %v", err) {
+		t.FailNow()
+	}
+	return e
+}
+
+func TestTemplateStrict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qaz")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "vpc.yml")
+	assert.NoError(t, ioutil.WriteFile(src, []byte("Resources:\n  VPC:\n    Properties:\n      CidrBlock: {{ .vpc.cdr }}\n"), 0644))
+	run := qaz.RunOptions{Stacks: []string{"vpc"}, Sources: map[string]string{"vpc": src}}
+
+	// missing keys fail with the position & surrounding lines
+	_, err = loadProject(t, "qaz-lib", nil).Render(run)
+	e := renderErr(t, err)
+	assert.Equal(t, src, e.Template)
+	assert.Equal(t, 4, e.Line)
+	assert.Equal(t, 25, e.Column)
+	assert.Equal(t, `at <.vpc.cdr>: map has no entry for key "cdr"`, e.Msg)
+	assert.Equal(t, ""+
+		"  2 |   VPC:\n"+
+		"  3 |     Properties:\n"+
+		"> 4 |       CidrBlock: {{ .vpc.cdr }}\n"+
+		"    |                         ^", e.Context)
+
+	// lenient projects render missing keys as <no value>
+	p, err := qaz.Load(qaz.Options{Config: fakeConfig, Region: "eu-west-1", Lenient: true})
+	assert.NoError(t, err)
+	templates, err := p.Render(run)
+	assert.NoError(t, err)
+	assert.Contains(t, templates["vpc"], "CidrBlock: <no value>")
+
+	// parse errors have no column
+	assert.NoError(t, ioutil.WriteFile(src, []byte("Resources:\n  {{ .vpc.cidr }\n"), 0644))
+	_, err = p.Render(run)
+	e = renderErr(t, err)
+	assert.Equal(t, 2, e.Line)
+	assert.Equal(t, 0, e.Column)
+	assert.Contains(t, e.Error(), src+":2: unexpected \"}\" in operand")
+
+	// function errors are returned in both modes
+	assert.NoError(t, ioutil.WriteFile(src, []byte("Description: {{ cat \"does-not-exist.txt\" }}\n"), 0644))
+	_, err = p.Render(run)
+	e = renderErr(t, err)
+	assert.Equal(t, 1, e.Line)
+	assert.Contains(t, e.Msg, "error calling cat")
+
+	// config functions & keys
+	_, err = qaz.Load(qaz.Options{Config: fakeConfig + "\n# {{ .env }} {{ .region }}\n", Region: "eu-west-1"})
+	e = renderErr(t, err)
+	assert.Equal(t, "config", e.Template)
+	assert.Contains(t, e.Msg, `map has no entry for key "region"`)
+}
+
+func TestTemplateStrictDeployTime(t *testing.T) {
+	delims := "<<:>>"
+	s := &stacks.Stack{
+		Name:           "vpc",
+		Source:         "templates/vpc.yml",
+		Template:       "Outputs:\n  Value: << .vpc.cidr >>\n  Missing: << .vpc.nope >>\n",
+		DeployDelims:   &delims,
+		DeployTimeFunc: &template.FuncMap{},
+		TemplateValues: map[string]interface{}{"vpc": map[string]interface{}{"cidr": "10.10.0.0/16"}},
+	}
+
+	e := renderErr(t, s.DeployTimeParser())
+	assert.Equal(t, "templates/vpc.yml (deploy-time)", e.Template)
+	assert.Equal(t, 3, e.Line)
+
+	s.Lenient = true
+	assert.NoError(t, s.DeployTimeParser())
+	assert.Equal(t, "Outputs:\n  Value: 10.10.0.0/16\n  Missing: <no value>\n", s.Template)
+}
@@ -0,0 +1,59 @@
+package testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/daidokoro/qaz/log"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestReportDocuments(t *testing.T) {
+	o := stacks.StackOutputs{
+		StackInfo: stacks.StackInfo{
+			Stack:     "vpc",
+			Stackname: "qaz-test-vpc",
+			Region:    "eu-west-1",
+			Status:    "CREATE_COMPLETE",
+			Created:   "2020-01-01T00:00:00Z",
+		},
+		Outputs: []stacks.Output{{Key: "VpcId", Value: "vpc-123", ExportName: "qaz-vpc"}},
+	}
+
+	// stack info fields are flattened in both formats
+	j, err := json.Marshal(o)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"stack": "vpc",
+		"stackname": "qaz-test-vpc",
+		"region": "eu-west-1",
+		"status": "CREATE_COMPLETE",
+		"created": "2020-01-01T00:00:00Z",
+		"outputs": [{"key": "VpcId", "value": "vpc-123", "export_name": "qaz-vpc"}]
+	}`, string(j))
+
+	y, err := yaml.Marshal(o)
+	assert.NoError(t, err)
+
+	var doc map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal(y, &doc))
+	assert.Equal(t, "vpc", doc["stack"])
+	assert.Equal(t, "CREATE_COMPLETE", doc["status"])
+	assert.NotContains(t, doc, "updated")
+	assert.Len(t, doc["outputs"], 1)
+}
+
+func TestLoggerOutput(t *testing.T) {
+	var buf bytes.Buffer
+	l := log.NewDefaultLogger(false, false).(*log.DefaultLogger)
+	l.SetOutput(&buf)
+
+	l.Info("status: %s", "ok")
+	l.Warn("careful")
+	assert.True(t, strings.Contains(buf.String(), "status: ok"))
+	assert.True(t, strings.Contains(buf.String(), "careful"))
+}
@@ -0,0 +1,199 @@
+package testing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+)
+
+func actioned(deps map[string][]string) *stacks.Map {
+	m := stackMap(deps)
+	m.Range(func(_ string, s *stacks.Stack) bool {
+		s.Actioned = true
+		return true
+	})
+	return m
+}
+
+func TestSchedulerOrder(t *testing.T) {
+	for _, reverse := range []bool{false, true} {
+		m := actioned(map[string][]string{
+			"vpc":    nil,
+			"subnet": {"vpc"},
+			"app":    {"subnet", "vpc"},
+		})
+
+		sc, err := stacks.NewScheduler(m, stacks.HandlerOptions{})
+		assert.NoError(t, err)
+		sc.Reverse = reverse
+
+		var mu sync.Mutex
+		var order []string
+		errs := sc.Run(context.Background(), func(s *stacks.Stack) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, s.Name)
+			return nil
+		})
+
+		assert.Empty(t, errs)
+		if reverse {
+			assert.Equal(t, []string{"app", "subnet", "vpc"}, order)
+			continue
+		}
+		assert.Equal(t, []string{"vpc", "subnet", "app"}, order)
+	}
+}
+
+func TestSchedulerFailure(t *testing.T) {
+	m := actioned(map[string][]string{
+		"vpc":    nil,
+		"iam":    nil,
+		"subnet": {"vpc"},
+		"app":    {"subnet"},
+	})
+
+	sc, err := stacks.NewScheduler(m, stacks.HandlerOptions{})
+	assert.NoError(t, err)
+
+	errs := sc.Run(context.Background(), func(s *stacks.Stack) error {
+		if s.Name == "vpc" {
+			return fmt.Errorf("failed")
+		}
+		return nil
+	})
+
+	assert.Len(t, errs, 3)
+	assert.EqualError(t, errs["vpc"], "failed")
+	assert.Equal(t, &stacks.DependencyError{Stack: "subnet", Dependency: "vpc"}, errs["subnet"])
+	assert.Equal(t, &stacks.DependencyError{Stack: "app", Dependency: "subnet"}, errs["app"])
+}
+
+func TestSchedulerParallel(t *testing.T) {
+	deps := make(map[string][]string)
+	for i := 0; i < 10; i++ {
+		deps[fmt.Sprintf("stack-%d", i)] = nil
+	}
+
+	sc, err := stacks.NewScheduler(actioned(deps), stacks.HandlerOptions{Parallel: 2})
+	assert.NoError(t, err)
+
+	var mu sync.Mutex
+	var running, max int
+	sc.Run(context.Background(), func(s *stacks.Stack) error {
+		mu.Lock()
+		running++
+		if running > max {
+			max = running
+		}
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond * 10)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+
+	assert.Equal(t, 2, max)
+}
+
+func TestSchedulerExternal(t *testing.T) {
+	m := stackMap(map[string][]string{
+		"vpc":    nil,
+		"subnet": {"vpc"},
+	})
+	m.MustGet("subnet").Actioned = true
+
+	sc, err := stacks.NewScheduler(m, stacks.HandlerOptions{})
+	assert.NoError(t, err)
+
+	var external []string
+	sc.External = func(_ context.Context, s *stacks.Stack) error {
+		external = append(external, s.Name)
+		return nil
+	}
+
+	var ran []string
+	assert.Empty(t, sc.Run(context.Background(), func(s *stacks.Stack) error {
+		ran = append(ran, s.Name)
+		return nil
+	}))
+
+	assert.Equal(t, []string{"vpc"}, external)
+	assert.Equal(t, []string{"subnet"}, ran)
+}
+
+func TestSchedulerFailFast(t *testing.T) {
+	sc, err := stacks.NewScheduler(actioned(map[string][]string{
+		"a": nil,
+		"b": nil,
+		"c": nil,
+	}), stacks.HandlerOptions{Parallel: 1, FailFast: true})
+	assert.NoError(t, err)
+
+	var ran int
+	errs := sc.Run(context.Background(), func(s *stacks.Stack) error {
+		ran++
+		return fmt.Errorf("failed")
+	})
+
+	assert.Equal(t, 1, ran)
+	assert.Len(t, errs, 3)
+
+	var cancelled int
+	for _, err := range errs {
+		if err == stacks.ErrFailFast {
+			cancelled++
+		}
+	}
+	assert.Equal(t, 2, cancelled)
+}
+
+func TestSchedulerInterrupt(t *testing.T) {
+	sc, err := stacks.NewScheduler(actioned(map[string][]string{
+		"vpc":    nil,
+		"subnet": {"vpc"},
+	}), stacks.HandlerOptions{})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := sc.Run(ctx, func(s *stacks.Stack) error {
+		// interrupt while the first stack is in progress
+		cancel()
+		return ctx.Err()
+	})
+
+	assert.Equal(t, context.Canceled, errs["vpc"])
+	assert.Equal(t, stacks.ErrInterrupted, errs["subnet"])
+}
+
+func TestResults(t *testing.T) {
+	results := stacks.Results{
+		{Stack: "app", Action: "deploy", Result: stacks.ActionCancelled, Err: &stacks.DependencyError{Stack: "app", Dependency: "vpc"}},
+		{Stack: "iam", Action: "deploy", Result: stacks.ActionCreated, Duration: time.Second * 61},
+		{Stack: "vpc", Action: "deploy", Result: stacks.ActionFailed, Err: fmt.Errorf("boom")},
+	}
+
+	err := results.Err()
+	assert.EqualError(t, err, "2 of 3 stack(s) failed")
+	assert.True(t, err.(*stacks.HandlerError).Partial())
+	assert.False(t, (&stacks.HandlerError{Results: results[2:]}).Partial())
+	assert.Equal(t, 1, results.Succeeded())
+	assert.NoError(t, results[1:2].Err())
+
+	var buf bytes.Buffer
+	results.Table(&buf)
+	assert.Equal(t, `STACK   ACTION   RESULT      DURATION   REASON
+app     deploy   cancelled   0s         [app] cancelled due to failure of [vpc]
+iam     deploy   created     1m1s       
+vpc     deploy   failed      0s         boom
+`, buf.String())
+}
@@ -1,13 +1,29 @@
 package testing
 
 import (
+	"context"
+	"io/ioutil"
+	"strings"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/daidokoro/qaz/clients/fake"
 	"github.com/daidokoro/qaz/commands"
+	"github.com/daidokoro/qaz/qaz"
+	"github.com/daidokoro/qaz/stacks"
 	"github.com/stretchr/testify/assert"
 )
 
-var testConfigSource = "https://raw.githubusercontent.com/daidokoro/qaz/master/examples/vpc/config.yml"
+// example config, templates are read from the local examples
+const testConfigSource = "../examples/vpc/config.yml"
+
+// testConfig - returns the example config with local template sources
+func testConfig(t *testing.T) string {
+	b, err := ioutil.ReadFile(testConfigSource)
+	assert.NoError(t, err)
+	return strings.Replace(string(b), "https://raw.githubusercontent.com/daidokoro/qaz/master/examples/vpc/templates/", "../examples/vpc/templates/", -1)
+}
 
 func TestGenerate(t *testing.T) {
 	expected := `AWSTemplateFormatVersion: '2010-09-09'
@@ -28,7 +44,7 @@ Outputs:
     Export:
       Name: !Sub "${AWS::StackName}-vpcid"
 `
-	stks, err := commands.Configure(testConfigSource, "")
+	stks, err := commands.Configure(testConfigSource, testConfig(t))
 	assert.NoError(t, err)
 
 	// deploying stack
@@ -37,31 +53,187 @@ Outputs:
 	assert.Equal(t, expected, stks.MustGet("vpc").Template)
 }
 
-// func TestDeploy(t *testing.T) {
-// 	stks, err := commands.Configure(testConfigSource, "")
-// 	assert.NoError(t, err)
+// config deployed against the fake backend
+const fakeConfig = `
+region: eu-west-1
+project: qaz-test
+
+global:
+  tags:
+    - code: go
+    - service: example
+
+stacks:
+  vpc:
+    source: ../examples/vpc/templates/vpc.yml
+    cf:
+      cidr: 10.10.0.0/16
+
+  subnet:
+    depends_on:
+      - vpc
+    source: ../examples/vpc/templates/subnet.yml
+    cf:
+      subnets:
+        - private: 10.10.0.0/24
+        - public: 10.10.2.0/24
+`
+
+// configureStacks - returns the fake config stacks with generated templates, all stacks are actioned
+func configureStacks(t *testing.T, b *fake.Backend) *stacks.Map {
+	p, err := qaz.Load(qaz.Options{Config: fakeConfig, Region: "eu-west-1", Clients: b.Clients()})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	stks, err := p.Stacks()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	stks.Range(func(_ string, s *stacks.Stack) bool {
+		s.Actioned = true
+		assert.NoError(t, s.GenTimeParser())
+		return true
+	})
+	return stks
+}
 
-// 	stks.MustGet("vpc").GenTimeParser()
+func TestDeployHandler(t *testing.T) {
+	b := fake.New("eu-west-1")
+
+	stks := configureStacks(t, b)
+	results, err := stacks.DeployHandler(context.Background(), stks, stacks.HandlerOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	for _, r := range results {
+		assert.Equal(t, stacks.ActionCreated, r.Result, r.Stack)
+	}
+	assert.Equal(t, []string{"qaz-test-subnet", "qaz-test-vpc"}, b.CloudFormation.Stacks())
+
+	// the subnet template resolves the vpc output at deploy time
+	vpc := stks.MustGet("vpc")
+	assert.NoError(t, vpc.Outputs())
+	vpcid := aws.StringValue(vpc.Output.Stacks[0].Outputs[0].OutputValue)
+	assert.True(t, strings.HasPrefix(vpcid, "qaz-test-vpc-VPC-"), vpcid)
+	assert.Contains(t, stks.MustGet("subnet").Template, "VpcId: "+vpcid)
+
+	exports, err := stacks.ListExports(sess, b.Clients())
+	assert.NoError(t, err)
+	assert.Equal(t, []stacks.Export{{Name: "qaz-test-vpc-vpcid", Value: vpcid, StackID: aws.StringValue(vpc.Output.Stacks[0].StackId)}}, exports)
+
+	// deployed stacks without changes are left unchanged
+	stks = configureStacks(t, b)
+	results, err = stacks.DeployHandler(context.Background(), stks, stacks.HandlerOptions{})
+	assert.NoError(t, err)
+	for _, r := range results {
+		assert.Equal(t, stacks.ActionUnchanged, r.Result, r.Stack)
+	}
+
+	results, err = stacks.TerminateHandler(context.Background(), stks, stacks.HandlerOptions{})
+	assert.NoError(t, err)
+	for _, r := range results {
+		assert.Equal(t, stacks.ActionTerminated, r.Result, r.Stack)
+	}
+	assert.Empty(t, b.CloudFormation.Stacks())
+}
 
-// 	// deploying stack
-// 	err = stks.MustGet("vpc").Deploy()
-// 	assert.NoError(t, err)
-// }
+func TestDeployFailure(t *testing.T) {
+	b := fake.New("eu-west-1")
+	b.CloudFormation.Fail = map[string]string{"privateSubnet": "The CIDR '10.10.0.0/24' is invalid."}
 
-// func TestExists(t *testing.T) {
-// 	stks, err := commands.Configure(testConfigSource, "")
-// 	assert.NoError(t, err)
+	stks := configureStacks(t, b)
+	results, err := stacks.DeployHandler(context.Background(), stks, stacks.HandlerOptions{})
+	assert.IsType(t, &stacks.HandlerError{}, err)
 
-// 	// deploying stack
-// 	r := stks.MustGet("vpc").StackExists()
-// 	assert.Equal(t, true, r)
-// }
+	for _, r := range results {
+		if r.Stack == "vpc" {
+			assert.Equal(t, stacks.ActionCreated, r.Result)
+			continue
+		}
 
-// func TestTerminate(t *testing.T) {
-// 	stks, err := commands.Configure(testConfigSource, "")
-// 	assert.NoError(t, err)
+		assert.Equal(t, stacks.ActionFailed, r.Result)
+		if assert.NotNil(t, r.Failure) {
+			assert.Equal(t, "privateSubnet", r.Failure.RootCause.LogicalID)
+			assert.Equal(t, "The CIDR '10.10.0.0/24' is invalid.", r.Failure.RootCause.Reason)
+			assert.Equal(t, "publicSubnet", r.Failure.Cancelled[0].LogicalID)
+		}
+	}
 
-// 	// deploying stack
-// 	err = stks.MustGet("vpc").Terminate()
-// 	assert.NoError(t, err)
-// }
+	status, err := stks.MustGet("subnet").StackStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, cloudformation.StackStatusRollbackComplete, status)
+}
+
+func TestRedeploy(t *testing.T) {
+	b := fake.New("eu-west-1")
+	b.CloudFormation.Fail = map[string]string{"VPC": "The CIDR '10.10.0.0/16' is invalid."}
+
+	ctx := context.Background()
+	_, err := stacks.DeployHandler(ctx, configureStacks(t, b), stacks.HandlerOptions{})
+	assert.IsType(t, &stacks.HandlerError{}, err)
+
+	// stacks in ROLLBACK_COMPLETE are deleted & recreated
+	b.CloudFormation.Fail = nil
+	stks := configureStacks(t, b)
+	status, err := stks.MustGet("vpc").StackStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, cloudformation.StackStatusRollbackComplete, status)
+
+	results, err := stacks.DeployHandler(ctx, stks, stacks.HandlerOptions{})
+	assert.NoError(t, err)
+	for _, r := range results {
+		assert.Equal(t, stacks.ActionCreated, r.Result, r.Stack)
+	}
+
+	// stacks that need recovery are left in place
+	b.CloudFormation.Fail = map[string]string{"publicSubnet": "subnet in use"}
+	_, err = stacks.TerminateHandler(ctx, configureStacks(t, b), stacks.HandlerOptions{})
+	assert.Error(t, err)
+
+	stks = configureStacks(t, b)
+	subnet := stks.MustGet("subnet")
+	status, err = subnet.StackStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, cloudformation.StackStatusDeleteFailed, status)
+
+	results, err = stacks.DeployHandler(ctx, stks, stacks.HandlerOptions{})
+	assert.IsType(t, &stacks.HandlerError{}, err)
+	for _, r := range results {
+		if r.Stack == "subnet" {
+			assert.Contains(t, r.Err.Error(), "qaz recover subnet")
+		}
+	}
+	assert.True(t, subnet.StackExists())
+}
+
+func TestUpdate(t *testing.T) {
+	b := fake.New("eu-west-1")
+
+	ctx := context.Background()
+	vpc := configureStacks(t, b).MustGet("vpc")
+	assert.Error(t, vpc.Update(ctx))
+	assert.NoError(t, vpc.Deploy(ctx))
+	assert.NoError(t, vpc.Outputs())
+	vpcid := vpc.Output.Stacks[0].Outputs[0].OutputValue
+
+	// changed resources keep their physical id
+	assert.NoError(t, vpc.GenTimeParser())
+	vpc.Template = strings.Replace(vpc.Template, "10.10.0.0/16", "10.20.0.0/16", 1)
+	assert.NoError(t, vpc.Update(ctx))
+	assert.NoError(t, vpc.Outputs())
+	assert.Equal(t, vpcid, vpc.Output.Stacks[0].Outputs[0].OutputValue)
+	assert.Equal(t, stacks.ErrNoUpdates, vpc.Update(ctx))
+
+	// failed updates are rolled back
+	b.CloudFormation.Fail = map[string]string{"VPC": "CidrBlock cannot be modified"}
+	vpc.Template = strings.Replace(vpc.Template, "10.20.0.0/16", "10.30.0.0/16", 1)
+	err := vpc.Update(ctx)
+	if assert.IsType(t, &stacks.Failure{}, err) {
+		assert.Equal(t, "VPC", err.(*stacks.Failure).RootCause.LogicalID)
+	}
+
+	status, err := vpc.StackStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, cloudformation.StackStatusUpdateRollbackComplete, status)
+}
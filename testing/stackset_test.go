@@ -0,0 +1,64 @@
+package testing
+
+import (
+	"testing"
+
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestStackSetConfig(t *testing.T) {
+	src := `project: qaz-test
+stacks:
+  baseline:
+    source: baseline.yml
+    stackset:
+      accounts:
+        - "111111111111"
+        - "222222222222"
+      regions:
+        - eu-west-1
+        - us-east-1
+      preferences:
+        max_concurrent_count: 2
+  guardrails:
+    stackset:
+      organizational_units:
+        - ou-abcd-12345678
+      regions:
+        - eu-west-1
+      auto_deployment: true
+`
+	assert.Nil(t, validate(t, src, yaml.Unmarshal))
+
+	var c stacks.Config
+	assert.NoError(t, yaml.Unmarshal([]byte(src), &c))
+
+	ss := c.Stacks["baseline"].StackSet
+	assert.NotNil(t, ss)
+	assert.Equal(t, []string{"111111111111", "222222222222"}, ss.Accounts)
+	assert.Equal(t, int64(2), ss.Preferences.MaxConcurrentCount)
+	assert.True(t, c.Stacks["guardrails"].StackSet.AutoDeployment)
+	assert.Nil(t, c.Stacks["vpc"].StackSet)
+
+	// missing targets
+	assert.Error(t, (&stacks.StackSetConfig{Accounts: []string{"111111111111"}}).Validate())
+	assert.Error(t, (&stacks.StackSetConfig{Regions: []string{"eu-west-1"}}).Validate())
+	assert.Error(t, (&stacks.StackSetConfig{
+		Regions:         []string{"eu-west-1"},
+		PermissionModel: "SERVICE_MANAGED",
+		Accounts:        []string{"111111111111"},
+	}).Validate())
+
+	src = `project: qaz-test
+stacks:
+  baseline:
+    stackset:
+      accounts:
+        - "111111111111"
+`
+	errs := validate(t, src, yaml.Unmarshal)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "config:4: stack [baseline]: stackset requires at least one region", errs[0].Error())
+}
@@ -0,0 +1,90 @@
+package testing
+
+import (
+	"testing"
+
+	"github.com/daidokoro/hcl"
+	"github.com/daidokoro/qaz/stacks"
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func validate(t *testing.T, src string, unmarshal func([]byte, interface{}) error) stacks.ConfigErrors {
+	c := stacks.Config{String: src, File: "config"}
+	assert.NoError(t, unmarshal([]byte(src), &c))
+
+	err := c.Validate()
+	if err == nil {
+		return nil
+	}
+
+	errs, ok := err.(stacks.ConfigErrors)
+	assert.True(t, ok)
+	return errs
+}
+
+func TestValidateYAML(t *testing.T) {
+	src := `project: qaz-test
+gen_time: "[["
+stacks:
+  vpc:
+    source: vpc.yml
+  subnet:
+    depend_on:
+      - vpc
+    depends_on:
+      - vcp
+    cf:
+      vpc: '<< stack_output "network::vpcid" >>'
+`
+	errs := validate(t, src, yaml.Unmarshal)
+	assert.Len(t, errs, 4)
+	assert.Equal(t, "config:7: unknown key [depend_on] in stack config", errs[0].Error())
+	assert.Equal(t, 2, errs[1].Line)
+	assert.Equal(t, "config:10: stack [subnet] depends on [vcp], which is not defined in config", errs[2].Error())
+	assert.Equal(t, 12, errs[3].Line)
+}
+
+func TestValidateJSON(t *testing.T) {
+	src := `{
+  "project": "qaz-test",
+  "stacks": {
+    "vpc": {
+      "notification_arns": []
+    }
+  }
+}`
+	errs := validate(t, src, yaml.Unmarshal)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "config:5: unknown key [notification_arns] in stack config", errs[0].Error())
+}
+
+func TestValidateHCL(t *testing.T) {
+	src := `project = "qaz-test"
+
+stacks "vpc" {
+  source = "vpc.yml"
+  regoin = "eu-west-1"
+}
+
+stacks "subnet" {
+  depends_on = ["vpc"]
+}
+`
+	errs := validate(t, src, hcl.Unmarshal)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "config:5: unknown key [regoin] in config.stacks.vpc", errs[0].Error())
+}
+
+func TestValidateValid(t *testing.T) {
+	src := `project: qaz-test
+deploy_time: "[[:]]"
+stacks:
+  vpc:
+    source: vpc.yml
+  subnet:
+    depends_on:
+      - vpc
+`
+	assert.Nil(t, validate(t, src, yaml.Unmarshal))
+}